@@ -13,6 +13,7 @@ import (
 
 	"github.com/nttlong/regorm/dberrors"
 	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
 
 	"gopkg.in/yaml.v2"
 	"gorm.io/gorm"
@@ -38,6 +39,8 @@ type IDbConfigBase interface {
 	GetAllModelsInEntity(entity interface{}) []interface{}
 	ToSnakeCase(s string) string
 	GetTableName(entity interface{}) string
+	//schema of the entity for compiling expressions against its columns
+	GetExprSchema(entity interface{}) *compiler.Schema
 }
 
 type IStorage interface {
@@ -49,17 +52,44 @@ type IStorage interface {
 	Create(entity interface{}) error
 	CreateInBatches(value interface{}, batchSize int) error
 
+	// the condition (args[0] / conds[0]) of Delete, First, Update, Find, FindWithOptions, Count,
+	// Aggregate and AggregateScan is an expression string, a *compiler.SimpleExprTree or an
+	// *expr.Builder such as expr.Field("Code").Eq(expr.Param()). Find, FindWithOptions, First,
+	// Count, Update and Delete also accept an *expr.Filter (a JSON filter document) alone.
+	// Conditions of Find, FindWithOptions, First, Count and Aggregate may use fields of related
+	// entities (User.Username), the related tables are joined automatically.
 	Delete(value interface{}, args ...interface{}) error
 	First(dest interface{}, args ...interface{}) error
 	GetParser() expr.IExpr
 	SetParser(parser expr.IExpr)
 	Update(entity interface{}, conds ...interface{}) error
 	Find(dest interface{}, conds ...interface{}) error
+	// Find with sorting, paging and projection, see FindOptions
+	FindWithOptions(dest interface{}, options FindOptions, conds ...interface{}) error
+	// Aggregate runs "SELECT selectExprs FROM entity WHERE conds GROUP BY groupBy HAVING having",
+	// e.g. Aggregate(&Order{}, "year(CreatedOn) as Year, sum(Price) as Total", "Year", "Total > ?", "Status == ?", "paid", 1000).
+	// conds[0] is the condition ("" for none), the values bind first to its parameters then to the ones of having.
+	// selectExprs, groupBy and having are expression strings ("" for none), trees or builders like the condition.
+	Aggregate(entity interface{}, selectExprs interface{}, groupBy interface{}, having interface{}, conds ...interface{}) ([]map[string]interface{}, error)
+	// AggregateScan is Aggregate scanning the rows into dest, a pointer to a slice of structs
+	// whose fields match the snake_case aliases
+	AggregateScan(dest interface{}, entity interface{}, selectExprs interface{}, groupBy interface{}, having interface{}, conds ...interface{}) error
 
 	Exec(sql string, values ...interface{}) error
 	Count(entity interface{}, conds ...interface{}) (int64, error)
 	GetDbName() string
 }
+
+// FindOptions are the options of IStorage.FindWithOptions. OrderBy and Select are
+// compiled by the expression compiler like conditions, so field names are resolved to
+// columns and validated, and parameters are rejected. Like conditions they are an
+// expression string, a *compiler.SimpleExprTree or an *expr.Builder (nil or "" for none).
+type FindOptions struct {
+	OrderBy interface{} // sort spec, e.g. "CreatedOn desc, len(Name) asc" or expr.Func("len", expr.Field("Name"))
+	Select  interface{} // projection, e.g. "ID, Name, year(CreatedOn) as Year"
+	Limit   int         // 0 means no limit
+	Offset  int
+}
 type IDbConfig interface {
 	IDbConfigBase
 	GetConectionString(dbname string) string
@@ -215,6 +245,7 @@ type ColumInfo struct {
 	Typ          reflect.StructField
 	DefaultValue string
 	HasDefault   bool
+	Search       []string // search indexes from the tag search:fulltext,trgm
 }
 
 func (c *DbConfigBase) GetColumInfoOfField(field reflect.StructField) *ColumInfo {
@@ -292,7 +323,7 @@ func getColumInfoOfField(field reflect.StructField) *ColumInfo {
 	if tag == "" {
 		return nil
 	}
-	if strings.HasPrefix(tag, "foreignKey:") {
+	if hasForeignKey(tag) {
 		return nil
 	}
 
@@ -321,6 +352,8 @@ func getColumInfoOfField(field reflect.StructField) *ColumInfo {
 					if err == nil {
 						ret.Length = length
 					}
+				} else {
+					ret.DbType = value
 				}
 
 			}
@@ -339,6 +372,11 @@ func getColumInfoOfField(field reflect.StructField) *ColumInfo {
 				ret.DefaultValue = value
 				ret.HasDefault = true
 			}
+			if key == "search" {
+				for _, kind := range strings.Split(value, ",") {
+					ret.Search = append(ret.Search, strings.ToLower(strings.TrimSpace(kind)))
+				}
+			}
 		}
 		if t == "primaryKey" || t == "primary_key" {
 			ret.IsPk = true
@@ -371,6 +409,205 @@ func (c *DbConfigBase) GetAllColumnsInfoFromEntity(entity interface{}) []ColumIn
 	return ret
 
 }
+
+// GetIndexColumns returns the columns of entity in the index indexName: the index names
+// of the gorm tags or the names gorm gives to indexes without one (idx_table_column, uni_table_column).
+// Drivers use it to tell which columns a duplicate key error is about.
+func (c *DbConfigBase) GetIndexColumns(entity interface{}, indexName string) []string {
+	tableName := c.GetTableName(entity)
+	ret := make([]string, 0)
+	for _, col := range c.GetAllColumnsInfoFromEntity(entity) {
+		if col.IndexName == indexName ||
+			indexName == "idx_"+tableName+"_"+col.Name ||
+			indexName == "uni_"+tableName+"_"+col.Name {
+			ret = append(ret, col.Name)
+		}
+	}
+	return ret
+}
+
+// GetPrimaryKeyColumns returns the primary key columns of entity
+func (c *DbConfigBase) GetPrimaryKeyColumns(entity interface{}) []string {
+	ret := make([]string, 0)
+	for _, col := range c.GetAllColumnsInfoFromEntity(entity) {
+		if col.IsPk {
+			ret = append(ret, col.Name)
+		}
+	}
+	return ret
+}
+
+var (
+	cacheExprSchema = make(map[reflect.Type]*compiler.Schema)
+	lockExprSchema  = new(sync.RWMutex)
+)
+
+// GetExprSchema build the schema used by IExpr.CompileExprWithSchema from the columns
+// returned by GetAllColumnsInfoFromEntity, the result is cached by entity type.
+// Fields with a foreignKey tag (or a slice of entities) become relations of the schema,
+// so expressions can use fields of related entities such as User.Username
+func (c *DbConfigBase) GetExprSchema(entity interface{}) *compiler.Schema {
+	typ := reflect.TypeOf(entity)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	lockExprSchema.RLock()
+	ret, ok := cacheExprSchema[typ]
+	lockExprSchema.RUnlock()
+	if ok {
+		return ret
+	}
+	lockExprSchema.Lock()
+	defer lockExprSchema.Unlock()
+	// related entities may refer back to this one, every schema being built is kept here
+	building := make(map[reflect.Type]*compiler.Schema)
+	ret = c.buildExprSchema(typ, building)
+	for t, schema := range building {
+		cacheExprSchema[t] = schema
+	}
+	return ret
+}
+
+// buildExprSchema builds the schema of typ and of its related entities, lockExprSchema must be held
+func (c *DbConfigBase) buildExprSchema(typ reflect.Type, building map[reflect.Type]*compiler.Schema) *compiler.Schema {
+	if ret, ok := cacheExprSchema[typ]; ok {
+		return ret
+	}
+	if ret, ok := building[typ]; ok {
+		return ret
+	}
+	entity := reflect.New(typ).Interface()
+	cols := c.GetAllColumnsInfoFromEntity(entity)
+	schemaCols := make([]compiler.SchemaColumn, 0, len(cols))
+	for _, col := range cols {
+		if col.Content == "-" {
+			continue
+		}
+		schemaCols = append(schemaCols, compiler.SchemaColumn{
+			Field:  col.Typ.Name,
+			Name:   col.Name,
+			DbType: col.DbType,
+		})
+	}
+	ret := compiler.NewSchema(typ.Name(), c.GetTableName(entity), schemaCols)
+	building[typ] = ret
+	for _, field := range relationFields(typ) {
+		target, many := relationTarget(field.Type)
+		targetSchema := c.buildExprSchema(target, building)
+		targetPk := primaryKeyField(c.GetAllColumnsInfoFromEntity(reflect.New(target).Interface()))
+		if rel := newRelation(ret, primaryKeyField(cols), field, targetSchema, targetPk, many); rel != nil {
+			ret.AddRelation(rel)
+		}
+	}
+	return ret
+}
+
+// relationFields returns the fields of typ (and of its embedded structs) which refer to other
+// entities: a struct or pointer to struct with a foreignKey tag, or a slice of entities
+func relationFields(typ reflect.Type) []reflect.StructField {
+	var ret []reflect.StructField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("gorm")
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !hasForeignKey(tag) {
+			ret = append(ret, relationFields(field.Type)...)
+			continue
+		}
+		target, many := relationTarget(field.Type)
+		if target == nil {
+			continue
+		}
+		if many || hasForeignKey(tag) {
+			ret = append(ret, field)
+		}
+	}
+	return ret
+}
+
+// relationTarget returns the entity type of a relation field, many is true for slices
+func relationTarget(typ reflect.Type) (reflect.Type, bool) {
+	many := false
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+		many = true
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ.PkgPath() == "time" {
+		return nil, false
+	}
+	return typ, many
+}
+
+// newRelation finds the join columns of a relation the way gorm guesses it: has one / has many
+// when the related entity has the foreign key (default <Owner>ID), otherwise belongs to when
+// this entity has it (default <Field>ID). The other side is the references tag or the primary key.
+// It returns nil when no foreign key is found
+func newRelation(owner *compiler.Schema, ownerPk string, field reflect.StructField, target *compiler.Schema, targetPk string, many bool) *compiler.SchemaRelation {
+	settings := gormSettings(field.Tag.Get("gorm"))
+	fk, ref := settings["foreignkey"], settings["references"]
+
+	hasFk := fk
+	if hasFk == "" {
+		hasFk = owner.Name + "ID"
+	}
+	if refCol, ok := target.Column(hasFk); ok {
+		if ref == "" {
+			ref = ownerPk
+		}
+		if col, ok := owner.Column(ref); ok {
+			return &compiler.SchemaRelation{Field: field.Name, Target: target, Column: col.Name, RefColumn: refCol.Name, Many: many}
+		}
+		return nil
+	}
+	if many {
+		return nil
+	}
+	if fk == "" {
+		fk = field.Name + "ID"
+	}
+	col, ok := owner.Column(fk)
+	if !ok {
+		return nil
+	}
+	if ref == "" {
+		ref = targetPk
+	}
+	if refCol, ok := target.Column(ref); ok {
+		return &compiler.SchemaRelation{Field: field.Name, Target: target, Column: col.Name, RefColumn: refCol.Name}
+	}
+	return nil
+}
+
+// gormSettings returns the settings of a gorm tag by lower case key,
+// "constraint:OnDelete:CASCADE;foreignKey:DeptID" has constraint and foreignkey
+func gormSettings(tag string) map[string]string {
+	settings := map[string]string{}
+	for _, t := range strings.Split(tag, ";") {
+		if kv := strings.SplitN(t, ":", 2); len(kv) == 2 {
+			settings[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+		}
+	}
+	return settings
+}
+
+// hasForeignKey reports whether a gorm tag has a foreignKey setting, in any position
+func hasForeignKey(tag string) bool {
+	_, ok := gormSettings(tag)["foreignkey"]
+	return ok
+}
+
+// primaryKeyField returns the Go name of the primary key column, "ID" when none is tagged
+func primaryKeyField(cols []ColumInfo) string {
+	for _, col := range cols {
+		if col.IsPk {
+			return col.Typ.Name
+		}
+	}
+	return "ID"
+}
+
 func (c *DbConfigBase) GetAllModelsInEntity(entity interface{}) []interface{} {
 	dupCheck := make(map[reflect.Type]bool)
 	typ := reflect.TypeOf(entity)
@@ -382,8 +619,7 @@ func (c *DbConfigBase) GetAllModelsInEntity(entity interface{}) []interface{} {
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
 		if field.Type.Kind() == reflect.Struct {
-			tag := strings.ToLower(field.Tag.Get("gorm"))
-			if strings.HasPrefix(tag, "foreignkey:") {
+			if hasForeignKey(field.Tag.Get("gorm")) {
 				//create new entity
 				if dupCheck[field.Type] {
 					continue
@@ -395,8 +631,7 @@ func (c *DbConfigBase) GetAllModelsInEntity(entity interface{}) []interface{} {
 
 		}
 		if field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
-			tag := strings.ToLower(field.Tag.Get("gorm"))
-			if strings.HasPrefix(tag, "foreignkey:") {
+			if hasForeignKey(field.Tag.Get("gorm")) {
 				//create new entity
 				if dupCheck[field.Type.Elem()] {
 					continue
@@ -429,8 +664,7 @@ func (c *DbConfigBase) GetAllModelsInEntity(entity interface{}) []interface{} {
 
 		}
 		if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
-			tag := strings.ToLower(field.Tag.Get("gorm"))
-			if strings.HasPrefix(tag, "foreignkey:") {
+			if hasForeignKey(field.Tag.Get("gorm")) {
 				//create new entity
 				if dupCheck[field.Type.Elem()] {
 					continue
@@ -463,8 +697,11 @@ func getAllColumnsInfoFromEntity(typ reflect.Type) []ColumInfo {
 	var columInfos []ColumInfo = make([]ColumInfo, 0)
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
-		if field.Type.Kind() == reflect.Struct {
-			if strings.HasPrefix(field.Tag.Get("gorm"), "foreignKey:") {
+		tag := field.Tag.Get("gorm")
+		// a tagged struct field which is not embedded (such as time.Time) is a column
+		isColumn := !field.Anonymous && tag != "" && !strings.Contains(tag, "embedded")
+		if field.Type.Kind() == reflect.Struct && !isColumn {
+			if hasForeignKey(tag) {
 				continue
 			}
 			subColumInfos := getAllColumnsInfoFromEntity(field.Type)
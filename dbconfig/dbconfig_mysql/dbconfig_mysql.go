@@ -1,28 +1,55 @@
 package dbconfig_mysql
 
 import (
+	"errors"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/nttlong/regorm/dbconfig"
 	"github.com/nttlong/regorm/dberrors"
 
+	"github.com/nttlong/regorm/expr/exprmysql"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 type MySqlDbConfig struct {
 	dbconfig.DbConfigBase
-	DbName   string `yaml:"dbname"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
+	DbName string `yaml:"dbname"`
+}
+
+// MySqlStorage is the storage of a mysql database, conditions are compiled by exprmysql
+type MySqlStorage struct {
+	*dbconfig.Storage
+}
+
+// defaultOptions are added to the connection string when they are not in Options:
+// utf8mb4 for the whole unicode range and parseTime to scan DATETIME into time.Time
+var defaultOptions = map[string]string{
+	"charset":   "utf8mb4",
+	"parseTime": "True",
 }
 
 func (c *MySqlDbConfig) GetConectionString(dbname string) string {
-	strOps := ""
+	ops := make(map[string]string)
+	for k, v := range defaultOptions {
+		ops[k] = v
+	}
 	for k, v := range c.Options {
-		strOps += k + "=" + v + "&"
+		ops[k] = v
+	}
+	keys := make([]string, 0, len(ops))
+	for k := range ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	strOps := ""
+	for _, k := range keys {
+		strOps += k + "=" + ops[k] + "&"
 	}
 	if len(strOps) > 0 {
 		strOps = strOps[:len(strOps)-1]
@@ -44,7 +71,33 @@ func (c *MySqlDbConfig) PingDb() error {
 	}
 	return nil
 }
+
+var (
+	cacheCreateDbIfNotExist = make(map[string]bool)
+	lockCreateDbIfNotExist  = sync.RWMutex{}
+)
+
 func (c *MySqlDbConfig) CreateDbIfNotExist(dbname string) error {
+	lockCreateDbIfNotExist.RLock()
+	isCreated := cacheCreateDbIfNotExist[dbname]
+	lockCreateDbIfNotExist.RUnlock()
+	if isCreated {
+		return nil
+	}
+	lockCreateDbIfNotExist.Lock()
+	defer lockCreateDbIfNotExist.Unlock()
+	if cacheCreateDbIfNotExist[dbname] {
+		return nil
+	}
+	err := c.createDbIfNotExist(dbname)
+	if err != nil {
+		return err
+	}
+	cacheCreateDbIfNotExist[dbname] = true
+	return nil
+}
+
+func (c *MySqlDbConfig) createDbIfNotExist(dbname string) error {
 	//create mysql connection string without database name
 	dns := c.GetConectionStringNoDatabase()
 	//create new connection
@@ -52,19 +105,147 @@ func (c *MySqlDbConfig) CreateDbIfNotExist(dbname string) error {
 	if err != nil {
 		return err
 	}
-	ret := db.Exec("CREATE DATABASE `" + dbname + "`")
+	ret := db.Exec(createDatabaseSQL(dbname, c.Options["collation"]))
 	if ret.Error != nil && !strings.Contains(ret.Error.Error(), "Error 1007") {
 		return ret.Error
 	}
 	return nil
 }
 
+// createDatabaseSQL creates the database in utf8mb4, the tables created by AutoMigrate
+// inherit its character set and collation
+func createDatabaseSQL(dbname string, collation string) string {
+	sql := "CREATE DATABASE IF NOT EXISTS `" + strings.ReplaceAll(dbname, "`", "``") + "` CHARACTER SET utf8mb4"
+	if collation != "" {
+		sql += " COLLATE " + collation
+	}
+	return sql
+}
+
+var (
+	cacheGetStorage = make(map[string]dbconfig.IStorage)
+	lockGetStorage  = sync.RWMutex{}
+)
+
 func (c *MySqlDbConfig) GetStorage(dbName string) (dbconfig.IStorage, error) {
-	panic("implement me")
+	//check if storage is cached
+	lockGetStorage.RLock()
+	storage := cacheGetStorage[dbName]
+	lockGetStorage.RUnlock()
+	if storage != nil {
+		return storage, nil
+	}
+	lockGetStorage.Lock()
+	defer lockGetStorage.Unlock()
+	if cacheGetStorage[dbName] != nil {
+		return cacheGetStorage[dbName], nil
+	}
+	//create new storage
+	storage, err := c.createStorage(dbName)
+	if err != nil {
+		return nil, err
+	}
+	cacheGetStorage[dbName] = storage
+	return storage, nil
+}
+
+func (c *MySqlDbConfig) createStorage(dbName string) (dbconfig.IStorage, error) {
+	err := c.PingDb()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.CreateDbIfNotExist(dbName); err != nil {
+		return nil, err
+	}
+	dns := c.GetConectionString(dbName)
+	d, err := gorm.Open(mysql.Open(dns), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return NewStorage(d, c, dbName), nil
 }
+
+// NewStorage creates the storage of the mysql database dbName opened as db
+func NewStorage(db *gorm.DB, cfg *MySqlDbConfig, dbName string) *MySqlStorage {
+	return &MySqlStorage{
+		Storage: dbconfig.NewStorage(db, cfg, exprmysql.New(), dbName, nil),
+	}
+}
+
+// TranslateError maps the mysql error numbers to the codes of dberrors, so a caller sees
+// the same DataActionError on mysql and postgres. RefColumns are the snake_case columns
+// of the violated key, foreign key or column.
 func (c *MySqlDbConfig) TranslateError(err error, entity interface{}, action string) dberrors.DataActionError {
-	panic("implement me")
+	ret := dberrors.DataActionError{
+		Err:    err,
+		Action: action,
+	}
+	var myErr *mysqldriver.MySQLError
+	if !errors.As(err, &myErr) {
+		return ret
+	}
+	if entity != nil {
+		ret.RefTableName = c.GetTableName(entity)
+	}
+	switch myErr.Number {
+	case 1062:
+		// Duplicate entry 'admin' for key 'users.idx_users_username'
+		ret.Code = dberrors.Duplicate
+		if entity != nil {
+			ret.RefColumns = c.keyColumns(entity, quotedAfter(myErr.Message, "for key "))
+		}
+	case 1451, 1452:
+		// Cannot add or update a child row: a foreign key constraint fails (`db`.`emps`,
+		// CONSTRAINT `fk_emps_dept` FOREIGN KEY (`dept_id`) REFERENCES `depts` (`id`))
+		ret.Code = dberrors.Reference
+		if m := foreignKeyRe.FindStringSubmatch(myErr.Message); m != nil {
+			for _, col := range strings.Split(m[2], ",") {
+				ret.RefColumns = append(ret.RefColumns, strings.Trim(strings.TrimSpace(col), "`"))
+			}
+			// 1452: the parent row is missing, 1451: a child row still references the parent
+			ret.RefTableName = m[3]
+			if myErr.Number == 1451 {
+				ret.RefTableName = m[1]
+			}
+		}
+	case 1048, 1364:
+		// Column 'name' cannot be null, Field 'name' doesn't have a default value
+		ret.Code = dberrors.Require
+		ret.RefColumns = []string{quotedAfter(myErr.Message, "")}
+	case 1406:
+		// Data too long for column 'name' at row 1
+		ret.Code = dberrors.InvalidLen
+		ret.RefColumns = []string{quotedAfter(myErr.Message, "column ")}
+	}
+	return ret
 }
+
+var foreignKeyRe = regexp.MustCompile("\\(`[^`]*`\\.`([^`]*)`, CONSTRAINT `[^`]*` FOREIGN KEY \\(([^)]*)\\) REFERENCES `([^`]*)`")
+
+// quotedAfter returns the first 'quoted' name after prefix in msg
+func quotedAfter(msg string, prefix string) string {
+	i := strings.Index(msg, prefix+"'")
+	if i < 0 {
+		return ""
+	}
+	name := msg[i+len(prefix)+1:]
+	if j := strings.Index(name, "'"); j >= 0 {
+		name = name[:j]
+	}
+	return name
+}
+
+// keyColumns resolves the key named in a duplicate entry error to the columns of entity,
+// PRIMARY is the primary key
+func (c *MySqlDbConfig) keyColumns(entity interface{}, key string) []string {
+	// mysql 8 prefixes the key with the table name
+	key = strings.TrimPrefix(key, c.GetTableName(entity)+".")
+	if key == "PRIMARY" {
+		return c.GetPrimaryKeyColumns(entity)
+	}
+	return c.GetIndexColumns(entity, key)
+}
+
 func New() *MySqlDbConfig {
 	return &MySqlDbConfig{}
 }
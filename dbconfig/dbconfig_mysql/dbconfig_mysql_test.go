@@ -4,9 +4,15 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/nttlong/regorm/dbconfig"
 	"github.com/nttlong/regorm/dbconfig/dbconfig_mysql"
+	"github.com/nttlong/regorm/dberrors"
+	"github.com/nttlong/regorm/expr/exprmysql"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	assert "github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
 var yamlFile = "E:/Docker/go/quicky-go/be/gormex/config.yaml"
@@ -20,3 +26,103 @@ func TestNew(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+type Dept struct {
+	Id   string `gorm:"type:char(36);primaryKey"`
+	Code string `gorm:"type:varchar(50)"`
+	Name string `gorm:"type:varchar(255)"`
+}
+
+// dryRunStorage opens a mysql storage that only builds sql, lastSQL returns the last query
+func dryRunStorage(t *testing.T) (*dbconfig_mysql.MySqlStorage, func() string) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "root:123456@tcp(localhost:3306)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.NoError(t, err)
+	var sql string
+	err = db.Callback().Query().After("gorm:query").Register("test:sql", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+	assert.NoError(t, err)
+	storage := dbconfig_mysql.NewStorage(db, dbconfig_mysql.New(), "test")
+	return storage, func() string { return sql }
+}
+
+func TestGetConectionString(t *testing.T) {
+	cfg := dbconfig_mysql.New()
+	cfg.User, cfg.Password, cfg.Host, cfg.Port = "root", "123456", "localhost", "3306"
+	assert.Equal(t, "root:123456@tcp(localhost:3306)/", cfg.GetConectionStringNoDatabase())
+	assert.Equal(t, "root:123456@tcp(localhost:3306)/test?charset=utf8mb4&parseTime=True", cfg.GetConectionString("test"))
+	cfg.Options = map[string]string{"loc": "Local", "charset": "latin1"}
+	assert.Equal(t, "root:123456@tcp(localhost:3306)/test?charset=latin1&loc=Local&parseTime=True", cfg.GetConectionString("test"))
+}
+
+func TestStorageFind(t *testing.T) {
+	storage, lastSQL := dryRunStorage(t)
+	var _ dbconfig.IStorage = storage
+	assert.Equal(t, "test", storage.GetDbName())
+	assert.Same(t, exprmysql.New(), storage.GetParser())
+
+	var depts []Dept
+	assert.NoError(t, storage.FindWithOptions(&depts, dbconfig.FindOptions{OrderBy: "Name desc", Limit: 10},
+		"Code == ? && len(Name) > 3", "IT"))
+	assert.Equal(t, "SELECT * FROM `depts` WHERE `code` = ? AND CHAR_LENGTH(`name`) > 3 ORDER BY `name` DESC LIMIT ?", lastSQL())
+
+	var dept Dept
+	assert.NoError(t, storage.First(&dept, "Name like ?", "a%"))
+	assert.Equal(t, "SELECT * FROM `depts` WHERE `name` LIKE ? COLLATE utf8mb4_bin ORDER BY `depts`.`id` LIMIT ?", lastSQL())
+
+	_, err := storage.Count(&Dept{}, "Code == ?", "IT")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM `depts` WHERE `code` = ?", lastSQL())
+
+	err = storage.Find(&depts, "Code ==")
+	assert.Error(t, err)
+}
+
+type User struct {
+	ID       string `gorm:"type:char(36);primaryKey"`
+	Username string `gorm:"type:varchar(50);uniqueIndex:idx_users_username"`
+	Email    string `gorm:"type:varchar(100);unique"`
+	TenantId string `gorm:"type:char(36);uniqueIndex:idx_users_tenant_code"`
+	Code     string `gorm:"type:varchar(20);uniqueIndex:idx_users_tenant_code"`
+}
+
+func TestTranslateError(t *testing.T) {
+	cfg := dbconfig_mysql.New()
+	testData := []struct {
+		number     uint16
+		message    string
+		code       dberrors.ErrorCode
+		refColumns []string
+		refTable   string
+	}{
+		{1062, "Duplicate entry '1' for key 'users.PRIMARY'", dberrors.Duplicate, []string{"id"}, "users"},
+		{1062, "Duplicate entry '1' for key 'PRIMARY'", dberrors.Duplicate, []string{"id"}, "users"},
+		{1062, "Duplicate entry 'admin' for key 'users.idx_users_username'", dberrors.Duplicate, []string{"username"}, "users"},
+		{1062, "Duplicate entry 'a@b.c' for key 'users.uni_users_email'", dberrors.Duplicate, []string{"email"}, "users"},
+		{1062, "Duplicate entry 't-1' for key 'users.idx_users_tenant_code'", dberrors.Duplicate, []string{"tenant_id", "code"}, "users"},
+		{1452, "Cannot add or update a child row: a foreign key constraint fails (`test`.`users`, CONSTRAINT `fk_users_dept` FOREIGN KEY (`dept_id`, `tenant_id`) REFERENCES `depts` (`id`, `tenant_id`))",
+			dberrors.Reference, []string{"dept_id", "tenant_id"}, "depts"},
+		{1451, "Cannot delete or update a parent row: a foreign key constraint fails (`test`.`emps`, CONSTRAINT `fk_emps_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))",
+			dberrors.Reference, []string{"user_id"}, "emps"},
+		{1048, "Column 'username' cannot be null", dberrors.Require, []string{"username"}, "users"},
+		{1364, "Field 'code' doesn't have a default value", dberrors.Require, []string{"code"}, "users"},
+		{1406, "Data too long for column 'username' at row 1", dberrors.InvalidLen, []string{"username"}, "users"},
+		{1146, "Table 'test.users' doesn't exist", dberrors.Unknown, nil, "users"},
+	}
+	for _, d := range testData {
+		myErr := &mysqldriver.MySQLError{Number: d.number, Message: d.message}
+		ret := cfg.TranslateError(fmt.Errorf("save: %w", myErr), &User{}, "save")
+		assert.Equal(t, d.code, ret.Code, d.message)
+		assert.Equal(t, d.refColumns, ret.RefColumns, d.message)
+		assert.Equal(t, d.refTable, ret.RefTableName, d.message)
+		assert.Equal(t, "save", ret.Action)
+		assert.ErrorIs(t, ret.Err, myErr)
+	}
+
+	ret := cfg.TranslateError(fmt.Errorf("connection refused"), &User{}, "save")
+	assert.Equal(t, dberrors.Unknown, ret.Code)
+	assert.Empty(t, ret.RefTableName)
+}
@@ -2,13 +2,11 @@ package dbconfig_postgres
 
 import (
 	"fmt"
-	"reflect"
 	"strings"
 	"sync"
 
 	"github.com/nttlong/regorm/dbconfig"
 	"github.com/nttlong/regorm/dberrors"
-	"github.com/nttlong/regorm/expr"
 
 	"github.com/nttlong/regorm/expr/exprpostgres"
 
@@ -19,11 +17,11 @@ import (
 type PostgresDbConfig struct {
 	dbconfig.DbConfigBase
 }
+
+// PostgresStorage is the storage of a postgres database, varchar columns are migrated
+// to citext and the search indexes of the entities are created (see AutoMigrate)
 type PostgresStorage struct {
-	db       *gorm.DB
-	dbConfig dbconfig.IDbConfig
-	parser   expr.IExpr
-	dbName   string
+	*dbconfig.Storage
 }
 
 func (c *PostgresDbConfig) GetConectionString(dbname string) string {
@@ -65,211 +63,6 @@ func (c *PostgresDbConfig) PingDb() error {
 	return nil
 }
 
-var (
-	cacheAutoMigrate = make(map[string]bool)
-	lockAutoMigrate  = sync.RWMutex{}
-)
-
-func (s *PostgresStorage) AutoMigrate(entity interface{}) error {
-	key := s.GetDbName() + ":" + reflect.TypeOf(entity).Name()
-	lockAutoMigrate.RLock()
-	isAutoMigrated := cacheAutoMigrate[key]
-	lockAutoMigrate.RUnlock()
-	if isAutoMigrated {
-		return nil
-	}
-	lockAutoMigrate.Lock()
-	defer lockAutoMigrate.Unlock()
-	if cacheAutoMigrate[key] {
-		return nil
-	}
-	entities := s.dbConfig.GetAllModelsInEntity(entity)
-	err := AutoMigrate(s.db, s.dbConfig, entities...)
-
-	if err != nil {
-		return err
-	}
-	cacheAutoMigrate[key] = true
-	return nil
-}
-func (s *PostgresStorage) Save(entity interface{}) error {
-	err := s.AutoMigrate(entity)
-	if err != nil {
-		return err
-	}
-	return s.db.Save(entity).Error
-}
-func (s *PostgresStorage) Create(entity interface{}) error {
-	err := s.AutoMigrate(entity)
-	if err != nil {
-		return err
-	}
-	return s.db.Create(entity).Error
-}
-func (s *PostgresStorage) CreateInBatches(entities interface{}, batchSize int) error {
-	typ := reflect.TypeOf(entities)
-	if typ.Kind() == reflect.Slice {
-		typ = typ.Elem()
-		err := s.AutoMigrate(reflect.New(typ).Interface())
-		if err != nil {
-			return err
-		}
-
-	}
-
-	return s.db.CreateInBatches(entities, batchSize).Error
-}
-func (s *PostgresStorage) Exec(sql string, values ...interface{}) error {
-	return s.db.Exec(sql, values...).Error
-}
-func (s *PostgresStorage) Find(dest interface{}, conds ...interface{}) error {
-	typ := reflect.TypeOf(dest)
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
-	}
-	if typ.Kind() == reflect.Slice {
-		typ = typ.Elem()
-		erMisMigrate := s.AutoMigrate(reflect.New(typ).Interface())
-		if erMisMigrate != nil {
-			return erMisMigrate
-		}
-	}
-
-	if conds != nil || len(conds) > 0 {
-		if reflect.TypeOf(conds[0]) == reflect.TypeOf("string") {
-			strCon := conds[0].(string)
-			node, err := s.parser.CompileExpr(strCon)
-			if err == nil {
-				conds[0] = node
-				// //var newCnds []interface{} = conds[1:]
-				// sliceType := reflect.SliceOf(typ)
-				// ret := reflect.New(sliceType).Interface()
-				// newCons := make([]interface{}, len(conds))
-				// for i := 1; i < len(conds); i++ {
-				// 	newCons[i] = conds[i]
-				// }
-				err := s.db.Find(dest, conds...).Error
-				if err != nil {
-					return err
-				}
-				// reflect.ValueOf(ret).Elem().Set(reflect.ValueOf(dest))
-
-				return nil
-			}
-		}
-
-	}
-	return s.db.Find(dest, conds).Error
-}
-
-func (s *PostgresStorage) Update(entity interface{}, conds ...interface{}) error {
-	erMigrate := s.AutoMigrate(entity)
-	if erMigrate != nil {
-		return erMigrate
-	}
-
-	if conds != nil || len(conds) > 0 {
-		if reflect.TypeOf(conds[0]) == reflect.TypeOf("string") {
-			strCon := conds[0].(string)
-			node, err := s.parser.CompileExpr(strCon)
-			if err == nil {
-				conds[0] = node
-				return s.db.Model(entity).Where(node, conds[1:]).Updates(entity).Error
-			}
-		}
-
-	}
-	return s.db.Model(entity).Updates(entity).Error
-}
-
-func (s *PostgresStorage) First(dest interface{}, conds ...interface{}) error {
-
-	erMigrate := s.AutoMigrate(dest)
-	if erMigrate != nil {
-		return erMigrate
-	}
-	//parse condition
-	if conds != nil || len(conds) > 0 {
-		if reflect.TypeOf(conds[0]) == reflect.TypeOf("string") {
-			strCon := conds[0].(string)
-			node, err := s.parser.CompileExpr(strCon)
-			if err == nil {
-				conds[0] = node
-				return s.db.First(dest, conds).Error
-
-			}
-		}
-
-	}
-
-	return s.db.First(dest, conds).Error
-}
-func (s *PostgresStorage) Delete(value interface{}, conds ...interface{}) error {
-	erMigrate := s.AutoMigrate(value)
-	if erMigrate != nil {
-		return erMigrate
-	}
-	if conds != nil || len(conds) > 0 {
-		if reflect.TypeOf(conds[0]) == reflect.TypeOf("string") {
-			strCon := conds[0].(string)
-			node, err := s.parser.CompileExpr(strCon)
-			if err == nil {
-				conds[0] = node
-				return s.db.Delete(value, conds).Error
-
-			}
-		}
-
-	}
-	return s.db.Delete(value, conds).Error
-}
-func (s *PostgresStorage) Count(entity interface{}, conds ...interface{}) (int64, error) {
-	erMigrate := s.AutoMigrate(entity)
-	if erMigrate != nil {
-		return 0, erMigrate
-	}
-	var ret int64
-	if conds != nil || len(conds) > 0 {
-		if reflect.TypeOf(conds[0]) == reflect.TypeOf("string") {
-			strCon := conds[0].(string)
-			node, err := s.parser.CompileExpr(strCon)
-			if err == nil {
-				conds[0] = node
-				err := s.db.Model(entity).Where(node, conds[1:]...).Count(&ret).Error
-				if err != nil {
-					return 0, err
-				}
-				return ret, nil
-
-			}
-		}
-	}
-
-	errL := s.db.Model(&entity).Count(&ret).Error
-	if errL != nil {
-		return 0, errL
-	}
-	return ret, nil
-}
-func (s *PostgresStorage) SetDbConfig(config dbconfig.IDbConfig) {
-	s.dbConfig = config
-}
-func (s *PostgresStorage) GetDbConfig() dbconfig.IDbConfig {
-	return s.dbConfig
-}
-func (s *PostgresStorage) GetDb() *gorm.DB {
-	return s.db
-}
-func (c *PostgresStorage) GetParser() expr.IExpr {
-	return c.parser
-}
-func (c *PostgresStorage) SetParser(parser expr.IExpr) {
-	c.parser = parser
-}
-func (c *PostgresStorage) GetDbName() string {
-	return c.dbName
-}
-
 var (
 	cacheGetStorage = make(map[string]dbconfig.IStorage)
 	lockGetStorage  = sync.RWMutex{}
@@ -312,10 +105,7 @@ func (c *PostgresDbConfig) createStorage(dbName string) (dbconfig.IStorage, erro
 		return nil, err
 	}
 	return &PostgresStorage{
-		db:       d,
-		dbConfig: c,
-		parser:   exprpostgres.New(),
-		dbName:   dbName,
+		Storage: dbconfig.NewStorage(d, c, exprpostgres.New(), dbName, AutoMigrate),
 	}, nil
 
 }
@@ -452,8 +242,36 @@ func AutoMigrate(db *gorm.DB, cfg dbconfig.IDbConfig, entities ...interface{}) e
 			if err != nil {
 				return err
 			}
+			for _, kind := range col.Search {
+				if errIdx := createSearchIndex(db, tablbName, cfg.ToSnakeCase(col.Name), kind); errIdx != nil {
+					return errIdx
+				}
+			}
 		}
 
 	}
 	return nil
 }
+
+const postgresSQLEnableTrgmExtension = "CREATE EXTENSION IF NOT EXISTS pg_trgm"
+
+// createSearchIndex creates the GIN index used by search() (kind "fulltext") or by
+// similar() and ilike (kind "trgm") on a column tagged with search:fulltext,trgm.
+// The indexed expressions are the ones exprpostgres generates, so the planner can use them.
+func createSearchIndex(db *gorm.DB, tableName string, colName string, kind string) error {
+	var sql string
+	switch kind {
+	case "fulltext":
+		sql = fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s_fts ON %s USING GIN (to_tsvector('%s', %s))",
+			tableName, colName, tableName, exprpostgres.SearchConfig(), colName)
+	case "trgm":
+		if err := db.Exec(postgresSQLEnableTrgmExtension).Error; err != nil {
+			return err
+		}
+		sql = fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s_trgm ON %s USING GIN ((CAST(%s AS text)) gin_trgm_ops)",
+			tableName, colName, tableName, colName)
+	default:
+		return fmt.Errorf("unknown search index '%s' on %s.%s, expected fulltext or trgm", kind, tableName, colName)
+	}
+	return db.Exec(sql).Error
+}
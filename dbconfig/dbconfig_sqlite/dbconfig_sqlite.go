@@ -0,0 +1,270 @@
+package dbconfig_sqlite
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nttlong/regorm/dbconfig"
+	"github.com/nttlong/regorm/dberrors"
+
+	"github.com/nttlong/regorm/expr/exprsqlite"
+
+	"github.com/mattn/go-sqlite3"
+	"gopkg.in/yaml.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Memory is the database name of an in-memory database, it lives as long as its storage
+const Memory = ":memory:"
+
+// SqliteDbConfig opens the database dbName as the file Dir/dbName.db
+// (dbName itself when it has an extension or is an absolute path), or in memory for Memory
+type SqliteDbConfig struct {
+	dbconfig.DbConfigBase `yaml:",inline"`
+	Dir                   string `yaml:"dir"`
+}
+
+// SqliteStorage is the storage of a sqlite database, conditions are compiled by exprsqlite
+type SqliteStorage struct {
+	*dbconfig.Storage
+}
+
+// defaultOptions are added to the connection string when they are not in Options:
+// sqlite checks foreign keys only when asked to, as postgres and mysql always do
+var defaultOptions = map[string]string{
+	"_foreign_keys": "1",
+}
+
+// LoadFromYamlFile reads the db section of yamlFile, a sqlite file has no user, password,
+// host or port so only dir and options are read:
+//
+//	db:
+//	  dir: "data"
+//	  options:
+//	    _busy_timeout: "5000"
+func (c *SqliteDbConfig) LoadFromYamlFile(yamlFile string) error {
+	content, err := os.ReadFile(yamlFile)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	if err = yaml.Unmarshal(content, &config); err != nil {
+		return err
+	}
+	bffContent, err := yaml.Marshal(config["db"])
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(bffContent, c); err != nil {
+		return err
+	}
+	if c.Options == nil {
+		c.Options = make(map[string]string)
+	}
+	c.IsLoaded = true
+	return nil
+}
+
+// GetFilePath returns the file of the database dbname, or Memory
+func (c *SqliteDbConfig) GetFilePath(dbname string) string {
+	if dbname == Memory {
+		return Memory
+	}
+	path := dbname
+	if filepath.Ext(path) == "" {
+		path += ".db"
+	}
+	if c.Dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(c.Dir, path)
+	}
+	return path
+}
+
+func (c *SqliteDbConfig) GetConectionString(dbname string) string {
+	ops := make(map[string]string)
+	for k, v := range defaultOptions {
+		ops[k] = v
+	}
+	for k, v := range c.Options {
+		ops[k] = v
+	}
+	keys := make([]string, 0, len(ops))
+	for k := range ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	strOps := ""
+	for _, k := range keys {
+		strOps += k + "=" + ops[k] + "&"
+	}
+	if len(strOps) > 0 {
+		strOps = strOps[:len(strOps)-1]
+	}
+	return c.GetFilePath(dbname) + "?" + strOps
+}
+
+// GetConectionStringNoDatabase returns the directory of the database files
+func (c *SqliteDbConfig) GetConectionStringNoDatabase() string {
+	return c.Dir
+}
+
+// PingDb checks that the directory of the database files exists
+func (c *SqliteDbConfig) PingDb() error {
+	if c.Dir == "" {
+		return nil
+	}
+	info, err := os.Stat(c.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(c.Dir + " is not a directory")
+	}
+	return nil
+}
+
+var (
+	cacheCreateDbIfNotExist = make(map[string]bool)
+	lockCreateDbIfNotExist  = sync.RWMutex{}
+)
+
+// CreateDbIfNotExist creates the file of the database dbname (and its directory),
+// an in-memory database is created when it is opened
+func (c *SqliteDbConfig) CreateDbIfNotExist(dbname string) error {
+	path := c.GetFilePath(dbname)
+	if path == Memory {
+		return nil
+	}
+	lockCreateDbIfNotExist.RLock()
+	isCreated := cacheCreateDbIfNotExist[path]
+	lockCreateDbIfNotExist.RUnlock()
+	if isCreated {
+		return nil
+	}
+	lockCreateDbIfNotExist.Lock()
+	defer lockCreateDbIfNotExist.Unlock()
+	if cacheCreateDbIfNotExist[path] {
+		return nil
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	cacheCreateDbIfNotExist[path] = true
+	return nil
+}
+
+var (
+	cacheGetStorage = make(map[string]dbconfig.IStorage)
+	lockGetStorage  = sync.RWMutex{}
+)
+
+func (c *SqliteDbConfig) GetStorage(dbName string) (dbconfig.IStorage, error) {
+	//check if storage is cached
+	key := c.GetFilePath(dbName)
+	lockGetStorage.RLock()
+	storage := cacheGetStorage[key]
+	lockGetStorage.RUnlock()
+	if storage != nil {
+		return storage, nil
+	}
+	lockGetStorage.Lock()
+	defer lockGetStorage.Unlock()
+	if cacheGetStorage[key] != nil {
+		return cacheGetStorage[key], nil
+	}
+	//create new storage
+	storage, err := c.createStorage(dbName)
+	if err != nil {
+		return nil, err
+	}
+	cacheGetStorage[key] = storage
+	return storage, nil
+}
+
+func (c *SqliteDbConfig) createStorage(dbName string) (dbconfig.IStorage, error) {
+	err := c.PingDb()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.CreateDbIfNotExist(dbName); err != nil {
+		return nil, err
+	}
+	d, err := gorm.Open(sqlite.Open(c.GetConectionString(dbName)), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	sqlDb, err := d.DB()
+	if err != nil {
+		return nil, err
+	}
+	// each connection to :memory: is a new database, a file is written by one connection at a time
+	sqlDb.SetMaxOpenConns(1)
+	return NewStorage(d, c, dbName), nil
+}
+
+// NewStorage creates the storage of the sqlite database dbName opened as db
+func NewStorage(db *gorm.DB, cfg *SqliteDbConfig, dbName string) *SqliteStorage {
+	return &SqliteStorage{
+		Storage: dbconfig.NewStorage(db, cfg, exprsqlite.New(), dbName, nil),
+	}
+}
+
+// TranslateError maps the constraint errors of sqlite to the codes of dberrors,
+// RefColumns are the columns named in the message: UNIQUE constraint failed: users.id
+func (c *SqliteDbConfig) TranslateError(err error, entity interface{}, action string) dberrors.DataActionError {
+	ret := dberrors.DataActionError{
+		Err:    err,
+		Action: action,
+	}
+	var liteErr sqlite3.Error
+	if !errors.As(err, &liteErr) {
+		return ret
+	}
+	if entity != nil {
+		ret.RefTableName = c.GetTableName(entity)
+	}
+	switch liteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		ret.Code = dberrors.Duplicate
+		ret.RefColumns = failedColumns(liteErr.Error())
+	case sqlite3.ErrConstraintNotNull:
+		ret.Code = dberrors.Require
+		ret.RefColumns = failedColumns(liteErr.Error())
+	case sqlite3.ErrConstraintForeignKey:
+		// sqlite does not tell which foreign key failed
+		ret.Code = dberrors.Reference
+	}
+	return ret
+}
+
+// failedColumns returns the columns of "... constraint failed: users.tenant_id, users.code"
+func failedColumns(msg string) []string {
+	i := strings.Index(msg, "constraint failed: ")
+	if i < 0 {
+		return nil
+	}
+	ret := make([]string, 0)
+	for _, col := range strings.Split(msg[i+len("constraint failed: "):], ",") {
+		col = strings.TrimSpace(col)
+		ret = append(ret, col[strings.LastIndex(col, ".")+1:])
+	}
+	return ret
+}
+
+func New() *SqliteDbConfig {
+	return &SqliteDbConfig{}
+}
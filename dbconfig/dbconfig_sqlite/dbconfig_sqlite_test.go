@@ -0,0 +1,181 @@
+package dbconfig_sqlite_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nttlong/regorm/dbconfig"
+	"github.com/nttlong/regorm/dbconfig/dbconfig_sqlite"
+	"github.com/nttlong/regorm/dberrors"
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/exprsqlite"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+type User struct {
+	ID        string    `gorm:"type:char(36);primaryKey"`
+	Username  string    `gorm:"type:varchar(50);uniqueIndex:idx_users_username"`
+	Email     *string   `gorm:"type:varchar(100);not null"`
+	Salary    float64   `gorm:"type:numeric"`
+	CreatedOn time.Time `gorm:"type:datetime"`
+}
+
+func newUser(id string, username string, createdOn time.Time, salary float64) *User {
+	email := username + "@test.com"
+	return &User{ID: id, Username: username, Email: &email, Salary: salary, CreatedOn: createdOn}
+}
+
+func TestGetConectionString(t *testing.T) {
+	cfg := dbconfig_sqlite.New()
+	assert.Equal(t, "test.db?_foreign_keys=1", cfg.GetConectionString("test"))
+	assert.Equal(t, ":memory:?_foreign_keys=1", cfg.GetConectionString(dbconfig_sqlite.Memory))
+	cfg.Dir = "data"
+	cfg.Options = map[string]string{"_busy_timeout": "5000"}
+	assert.Equal(t, filepath.Join("data", "test.sqlite")+"?_busy_timeout=5000&_foreign_keys=1", cfg.GetConectionString("test.sqlite"))
+	assert.Equal(t, "data", cfg.GetConectionStringNoDatabase())
+}
+
+func TestLoadFromYamlFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sqlite.yaml")
+	yaml := "db:\n  dir: \"data\"\n  options:\n    _busy_timeout: \"5000\"\n"
+	assert.NoError(t, os.WriteFile(path, []byte(yaml), 0o644))
+	cfg := dbconfig_sqlite.New()
+	assert.NoError(t, cfg.LoadFromYamlFile(path))
+	assert.True(t, cfg.CheckIsLoaded())
+	assert.Equal(t, filepath.Join("data", "test.db"), cfg.GetFilePath("test"))
+	assert.Equal(t, map[string]string{"_busy_timeout": "5000"}, cfg.GetOptions())
+	assert.Equal(t, filepath.Join("data", "test.db")+"?_busy_timeout=5000&_foreign_keys=1", cfg.GetConectionString("test"))
+
+	// a file without options nor dir
+	assert.NoError(t, os.WriteFile(path, []byte("db:\n  dir: \"\"\n"), 0o644))
+	cfg = dbconfig_sqlite.New()
+	assert.NoError(t, cfg.LoadFromYamlFile(path))
+	assert.Equal(t, "test.db", cfg.GetFilePath("test"))
+	assert.Error(t, cfg.LoadFromYamlFile(filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestCreateDbIfNotExist(t *testing.T) {
+	cfg := dbconfig_sqlite.New()
+	cfg.Dir = filepath.Join(t.TempDir(), "dbs")
+	assert.Error(t, cfg.PingDb())
+	assert.NoError(t, cfg.CreateDbIfNotExist("test"))
+	_, err := os.Stat(filepath.Join(cfg.Dir, "test.db"))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.PingDb())
+	assert.NoError(t, cfg.CreateDbIfNotExist(dbconfig_sqlite.Memory))
+}
+
+func TestStorage(t *testing.T) {
+	cfg := dbconfig_sqlite.New()
+	cfg.Dir = t.TempDir()
+	s, err := cfg.GetStorage("test")
+	assert.NoError(t, err)
+	s2, err := cfg.GetStorage("test")
+	assert.NoError(t, err)
+	assert.Same(t, s, s2)
+	assert.IsType(t, &dbconfig_sqlite.SqliteStorage{}, s)
+	assert.Same(t, exprsqlite.New(), s.GetParser())
+	assert.Equal(t, "test", s.GetDbName())
+
+	users := []*User{
+		newUser("1", "admin", time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC), 1000),
+		newUser("2", "Alice", time.Date(2024, 2, 10, 8, 0, 0, 0, time.UTC), 2000),
+		newUser("3", "bob", time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC), 3000),
+	}
+	assert.NoError(t, s.CreateInBatches(users, 10))
+
+	var found []User
+	assert.NoError(t, s.Find(&found, "year(CreatedOn) == ?", 2024))
+	assert.Len(t, found, 2)
+	assert.NoError(t, s.Find(&found, "year(CreatedOn) == 2024 && month(CreatedOn) == 3"))
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "bob", found[0].Username)
+	}
+	assert.NoError(t, s.FindWithOptions(&found, dbconfig.FindOptions{OrderBy: "Username desc", Limit: 2}, "Username like ?", "a%"))
+	if assert.Len(t, found, 2) {
+		assert.Equal(t, "admin", found[0].Username)
+		assert.Equal(t, "Alice", found[1].Username)
+	}
+
+	var user User
+	assert.NoError(t, s.First(&user, "len(Username) == ? && Salary > ?", 3, 2500))
+	assert.Equal(t, "3", user.ID)
+
+	count, err := s.Count(&User{}, "CreatedOn >= date '2024-01-01'")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	// the time of a builder is bound between the parameters given to Count
+	count, err = s.Count(&User{}, expr.Field("CreatedOn").Gte(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).And(expr.Field("Salary").Gt(expr.Param())), 2500)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	rows, err := s.Aggregate(&User{}, "year(CreatedOn) as Year, sum(Salary) as Total", "Year", "Total > ?", "", 1500)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.EqualValues(t, 2024, rows[0]["year"])
+		assert.EqualValues(t, 5000, rows[0]["total"])
+	}
+	// the options of aggregate and find take builders like the conditions
+	rows, err = s.Aggregate(&User{}, "year(CreatedOn) as Year, sum(Salary) as Total", expr.Field("Year"),
+		expr.Func("sum", expr.Field("Salary")).Gt(expr.Param()), expr.Field("Salary").Gt(expr.Param()), 2500, 1500)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.EqualValues(t, 3000, rows[0]["total"])
+	}
+	assert.NoError(t, s.FindWithOptions(&found, dbconfig.FindOptions{OrderBy: expr.Func("len", expr.Field("Username")), Limit: 1}))
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "bob", found[0].Username)
+	}
+	assert.Error(t, s.FindWithOptions(&found, dbconfig.FindOptions{OrderBy: 1}))
+
+	assert.NoError(t, s.Update(&User{Salary: 1500}, "Username == ?", "admin"))
+	var admin User
+	assert.NoError(t, s.First(&admin, "ID == ?", "1"))
+	assert.Equal(t, float64(1500), admin.Salary)
+
+	assert.NoError(t, s.Delete(&User{}, "Salary < ?", 2000))
+	count, err = s.Count(&User{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestMemoryStorage(t *testing.T) {
+	cfg := dbconfig_sqlite.New()
+	s, err := cfg.GetStorage(dbconfig_sqlite.Memory)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Save(newUser("m1", "memory", time.Now(), 1)))
+	count, err := s.Count(&User{}, "Username == ?", "memory")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestTranslateError(t *testing.T) {
+	cfg := dbconfig_sqlite.New()
+	cfg.Dir = t.TempDir()
+	s, err := cfg.GetStorage("errors")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Create(newUser("1", "admin", time.Now(), 1)))
+
+	err = s.Create(newUser("1", "other", time.Now(), 1))
+	ft := cfg.TranslateError(err, &User{}, "save")
+	assert.Equal(t, dberrors.Duplicate, ft.Code)
+	assert.Equal(t, "save", ft.Action)
+	assert.Equal(t, []string{"id"}, ft.RefColumns)
+	assert.Equal(t, "users", ft.RefTableName)
+
+	err = s.Create(newUser("2", "admin", time.Now(), 1))
+	ft = cfg.TranslateError(err, &User{}, "save")
+	assert.Equal(t, dberrors.Duplicate, ft.Code)
+	assert.Equal(t, []string{"username"}, ft.RefColumns)
+
+	err = s.Create(&User{ID: "3", Username: "nomail"})
+	ft = cfg.TranslateError(err, &User{}, "save")
+	assert.Equal(t, dberrors.Require, ft.Code)
+	assert.Equal(t, []string{"email"}, ft.RefColumns)
+
+	ft = cfg.TranslateError(os.ErrNotExist, &User{}, "save")
+	assert.Equal(t, dberrors.Unknown, ft.Code)
+}
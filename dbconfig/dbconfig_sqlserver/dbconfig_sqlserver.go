@@ -0,0 +1,262 @@
+package dbconfig_sqlserver
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nttlong/regorm/dbconfig"
+	"github.com/nttlong/regorm/dberrors"
+
+	"github.com/nttlong/regorm/expr/exprsqlserver"
+
+	mssql "github.com/microsoft/go-mssqldb"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+type SqlServerDbConfig struct {
+	dbconfig.DbConfigBase
+}
+
+// SqlServerStorage is the storage of a sql server database, conditions are compiled by
+// exprsqlserver and paging is rendered as TOP or OFFSET FETCH (see registerClauseBuilders)
+type SqlServerStorage struct {
+	*dbconfig.Storage
+}
+
+func (c *SqlServerDbConfig) GetConectionString(dbname string) string {
+	query := url.Values{}
+	for k, v := range c.Options {
+		if k == "collation" {
+			continue
+		}
+		query.Set(k, v)
+	}
+	query.Set("database", dbname)
+	return c.GetConectionStringNoDatabase() + "?" + query.Encode()
+}
+
+func (c *SqlServerDbConfig) GetConectionStringNoDatabase() string {
+	u := url.URL{
+		Scheme: "sqlserver",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   c.Host + ":" + c.Port,
+	}
+	return u.String()
+}
+
+func (c *SqlServerDbConfig) PingDb() error {
+	d := sqlserver.New(sqlserver.Config{
+		DSN: c.GetConectionStringNoDatabase(),
+	})
+	_, err := gorm.Open(d, &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+var (
+	cacheCreateDbIfNotExist = make(map[string]bool)
+	lockCreateDbIfNotExist  = sync.RWMutex{}
+)
+
+func (c *SqlServerDbConfig) CreateDbIfNotExist(dbname string) error {
+	lockCreateDbIfNotExist.RLock()
+	isCreated := cacheCreateDbIfNotExist[dbname]
+	lockCreateDbIfNotExist.RUnlock()
+	if isCreated {
+		return nil
+	}
+	lockCreateDbIfNotExist.Lock()
+	defer lockCreateDbIfNotExist.Unlock()
+	if cacheCreateDbIfNotExist[dbname] {
+		return nil
+	}
+	err := c.createDbIfNotExist(dbname)
+	if err != nil {
+		return err
+	}
+	cacheCreateDbIfNotExist[dbname] = true
+	return nil
+}
+
+func (c *SqlServerDbConfig) createDbIfNotExist(dbname string) error {
+	//create sql server connection string without database name
+	dns := c.GetConectionStringNoDatabase()
+	//create new connection
+	db, err := gorm.Open(sqlserver.Open(dns), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	return db.Exec(createDatabaseSQL(dbname, c.Options["collation"])).Error
+}
+
+// createDatabaseSQL creates the database when it is missing, with the collation of Options
+// (e.g. Vietnamese_CI_AS) or the one of the server
+func createDatabaseSQL(dbname string, collation string) string {
+	name := strings.ReplaceAll(dbname, "'", "''")
+	sql := "IF DB_ID(N'" + name + "') IS NULL CREATE DATABASE [" + strings.ReplaceAll(dbname, "]", "]]") + "]"
+	if collation != "" {
+		sql += " COLLATE " + collation
+	}
+	return sql
+}
+
+var (
+	cacheGetStorage = make(map[string]dbconfig.IStorage)
+	lockGetStorage  = sync.RWMutex{}
+)
+
+func (c *SqlServerDbConfig) GetStorage(dbName string) (dbconfig.IStorage, error) {
+	//check if storage is cached
+	lockGetStorage.RLock()
+	storage := cacheGetStorage[dbName]
+	lockGetStorage.RUnlock()
+	if storage != nil {
+		return storage, nil
+	}
+	lockGetStorage.Lock()
+	defer lockGetStorage.Unlock()
+	if cacheGetStorage[dbName] != nil {
+		return cacheGetStorage[dbName], nil
+	}
+	//create new storage
+	storage, err := c.createStorage(dbName)
+	if err != nil {
+		return nil, err
+	}
+	cacheGetStorage[dbName] = storage
+	return storage, nil
+}
+
+func (c *SqlServerDbConfig) createStorage(dbName string) (dbconfig.IStorage, error) {
+	err := c.PingDb()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.CreateDbIfNotExist(dbName); err != nil {
+		return nil, err
+	}
+	dns := c.GetConectionString(dbName)
+	d, err := gorm.Open(sqlserver.Open(dns), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return NewStorage(d, c, dbName), nil
+}
+
+// NewStorage creates the storage of the sql server database dbName opened as db,
+// the paging of db is rendered as TOP or OFFSET FETCH
+func NewStorage(db *gorm.DB, cfg *SqlServerDbConfig, dbName string) *SqlServerStorage {
+	registerClauseBuilders(db)
+	return &SqlServerStorage{
+		Storage: dbconfig.NewStorage(db, cfg, exprsqlserver.New(), dbName, nil),
+	}
+}
+
+// TranslateError maps the sql server error numbers to the codes of dberrors, so a caller sees
+// the same DataActionError on every database. RefColumns are the snake_case columns
+// of the violated key, foreign key or column.
+func (c *SqlServerDbConfig) TranslateError(err error, entity interface{}, action string) dberrors.DataActionError {
+	ret := dberrors.DataActionError{
+		Err:    err,
+		Action: action,
+	}
+	var msErr mssql.Error
+	if !errors.As(err, &msErr) {
+		return ret
+	}
+	if entity != nil {
+		ret.RefTableName = c.GetTableName(entity)
+	}
+	msg := msErr.Message
+	switch msErr.Number {
+	case 2627:
+		// Violation of PRIMARY KEY constraint 'PK__users__3213E83F'. Cannot insert duplicate key in object 'dbo.users'.
+		// Violation of UNIQUE KEY constraint 'uni_users_email'. Cannot insert duplicate key in object 'dbo.users'.
+		ret.Code = dberrors.Duplicate
+		if entity != nil {
+			if strings.Contains(msg, "PRIMARY KEY") {
+				ret.RefColumns = c.GetPrimaryKeyColumns(entity)
+			} else {
+				ret.RefColumns = c.GetIndexColumns(entity, quotedAfter(msg, "constraint "))
+			}
+		}
+	case 2601:
+		// Cannot insert duplicate key row in object 'dbo.users' with unique index 'idx_users_username'.
+		ret.Code = dberrors.Duplicate
+		if entity != nil {
+			ret.RefColumns = c.GetIndexColumns(entity, quotedAfter(msg, "unique index "))
+		}
+	case 547:
+		// 547 is also the number of CHECK constraints, which are not references
+		if !strings.Contains(msg, "FOREIGN KEY") && !strings.Contains(msg, "REFERENCE") {
+			return ret
+		}
+		// like mysql, RefColumns are the foreign key columns of the referencing table
+		// and RefTableName is the table on the other side
+		ret.Code = dberrors.Reference
+		m := conflictRe.FindStringSubmatch(msg)
+		if m == nil {
+			return ret
+		}
+		ret.RefTableName = m[1][strings.LastIndex(m[1], ".")+1:]
+		if strings.Contains(msg, "REFERENCE constraint") {
+			// The DELETE statement conflicted with the REFERENCE constraint "fk_emps_dept".
+			// The conflict occurred in database "test", table "dbo.emps", column 'dept_id'.
+			// the child table and its foreign key column, as mysql 1451
+			ret.RefColumns = []string{m[2]}
+		} else if entity != nil {
+			// The INSERT statement conflicted with the FOREIGN KEY constraint "fk_emps_dept".
+			// The conflict occurred in database "test", table "dbo.depts", column 'id'.
+			// the parent table and its key, the foreign key is found in the relations of entity
+			ret.RefColumns = c.foreignKeyColumns(entity, ret.RefTableName, m[2])
+		}
+	case 515:
+		// Cannot insert the value NULL into column 'email', table 'test.dbo.users'; column does not allow nulls.
+		ret.Code = dberrors.Require
+		ret.RefColumns = []string{quotedAfter(msg, "column ")}
+	case 8152, 2628:
+		// String or binary data would be truncated.
+		// String or binary data would be truncated in table 'test.dbo.users', column 'username'. (2628, sql server 2019)
+		ret.Code = dberrors.InvalidLen
+		if col := quotedAfter(msg, "column "); col != "" {
+			ret.RefColumns = []string{col}
+		}
+	}
+	return ret
+}
+
+// foreignKeyColumns returns the columns of entity referring to column of table, nil when
+// entity has no relation (field with a foreignKey tag) to table
+func (c *SqlServerDbConfig) foreignKeyColumns(entity interface{}, table string, column string) []string {
+	for _, rel := range c.GetExprSchema(entity).Relations {
+		if !rel.Many && rel.Target.Table == table && rel.RefColumn == column {
+			return []string{rel.Column}
+		}
+	}
+	return nil
+}
+
+var conflictRe = regexp.MustCompile(`table "([^"]*)", column '([^']*)'`)
+
+// quotedAfter returns the first 'quoted' name after prefix in msg
+func quotedAfter(msg string, prefix string) string {
+	i := strings.Index(msg, prefix+"'")
+	if i < 0 {
+		return ""
+	}
+	name := msg[i+len(prefix)+1:]
+	if j := strings.Index(name, "'"); j >= 0 {
+		name = name[:j]
+	}
+	return name
+}
+
+func New() *SqlServerDbConfig {
+	return &SqlServerDbConfig{}
+}
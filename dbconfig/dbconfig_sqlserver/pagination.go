@@ -0,0 +1,86 @@
+package dbconfig_sqlserver
+
+import (
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// topKey and buildClausesKey are the settings of a statement rendered with TOP:
+// the number of rows and the clauses to build before LIMIT was left out
+const (
+	topKey          = "sqlserver:top"
+	buildClausesKey = "sqlserver:build_clauses"
+)
+
+// registerClauseBuilders renders a limit without offset of a query as SELECT TOP (n), the other
+// paging is left to the OFFSET n ROWS FETCH NEXT m ROWS ONLY of the driver
+// (which orders by the primary key when the query has no order by)
+func registerClauseBuilders(db *gorm.DB) {
+	db.ClauseBuilders["SELECT"] = func(c clause.Clause, builder clause.Builder) {
+		if stmt, ok := builder.(*gorm.Statement); ok {
+			if n, ok := stmt.Settings.Load(topKey); ok {
+				c.AfterNameExpression = clause.Expr{SQL: "TOP (" + strconv.Itoa(n.(int)) + ")"}
+			}
+		}
+		c.Build(builder)
+	}
+	// the callbacks are registered once per db, an error would only come from their order
+	_ = db.Callback().Query().Before("gorm:query").Register("sqlserver:top", useTop)
+	_ = db.Callback().Query().After("gorm:query").Register("sqlserver:top_reset", resetTop)
+	_ = db.Callback().Row().Before("gorm:row").Register("sqlserver:top", useTop)
+	_ = db.Callback().Row().After("gorm:row").Register("sqlserver:top_reset", resetTop)
+}
+
+// useTop leaves LIMIT out of the clauses to build when the rows are limited by TOP
+func useTop(db *gorm.DB) {
+	stmt := db.Statement
+	n, ok := topRows(stmt)
+	if !ok {
+		return
+	}
+	stmt.Settings.Store(topKey, n)
+	stmt.Settings.Store(buildClausesKey, stmt.BuildClauses)
+	clauses := make([]string, 0, len(stmt.BuildClauses))
+	for _, name := range stmt.BuildClauses {
+		if name != "LIMIT" {
+			clauses = append(clauses, name)
+		}
+	}
+	stmt.BuildClauses = clauses
+}
+
+// resetTop gives back the clauses of the statement, so it can be run again with other paging
+func resetTop(db *gorm.DB) {
+	stmt := db.Statement
+	stmt.Settings.Delete(topKey)
+	if clauses, ok := stmt.Settings.LoadAndDelete(buildClausesKey); ok {
+		stmt.BuildClauses = clauses.([]string)
+	}
+}
+
+// topRows returns n when the query is limited to n rows without offset,
+// DISTINCT queries keep OFFSET FETCH since TOP must follow DISTINCT
+func topRows(stmt *gorm.Statement) (int, bool) {
+	c, ok := stmt.Clauses["LIMIT"]
+	if !ok {
+		return 0, false
+	}
+	limit, ok := c.Expression.(clause.Limit)
+	if !ok || limit.Limit == nil || *limit.Limit < 0 || limit.Offset > 0 || stmt.Distinct {
+		return 0, false
+	}
+	switch sel := stmt.Clauses["SELECT"].Expression.(type) {
+	case clause.Select:
+		if sel.Distinct {
+			return 0, false
+		}
+	case clause.Expr:
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sel.SQL)), "DISTINCT") {
+			return 0, false
+		}
+	}
+	return *limit.Limit, true
+}
@@ -102,7 +102,8 @@ func TestGetColumnsInfo(t *testing.T) {
 	assert.Equal(t, cols, cols2)
 
 	assert.Equal(t, cols, cols2)
-	assert.True(t, len(cols) == 9)
+	// bases.CreatedOn (time.Time) is a column, not a struct to scan into
+	assert.True(t, len(cols) == 10)
 
 }
 func TestGetAllModelsInEntity(t *testing.T) {
@@ -128,3 +129,125 @@ func TestToSnakeCase(t *testing.T) {
 	}
 
 }
+
+type schemaStruct struct {
+	bases
+	ID        string `gorm:"type:char(36);primaryKey"`
+	Code      string `gorm:"column:emp_code;type:varchar(20)"`
+	Attrs     string `gorm:"type:jsonb"`
+	Title     string `gorm:"type:text;search:fulltext,trgm"`
+	NoTgField string
+	Child     TestChildStruct `gorm:"foreignKey:Id"`
+}
+
+func TestGetExprSchema(t *testing.T) {
+	cfg := dbconfig.NewDbConfigBase()
+	schema := cfg.GetExprSchema(&schemaStruct{})
+	assert.Same(t, schema, cfg.GetExprSchema(schemaStruct{}))
+	assert.Equal(t, "schema_structs", schema.Table)
+
+	col, ok := schema.Column("Code")
+	assert.True(t, ok)
+	assert.Equal(t, "emp_code", col.Name)
+	col, ok = schema.Column("emp_code")
+	assert.True(t, ok)
+	assert.Equal(t, "Code", col.Field)
+	col, ok = schema.Column("CreatedOn")
+	assert.True(t, ok)
+	assert.Equal(t, "created_on", col.Name)
+	col, ok = schema.Column("Attrs")
+	assert.True(t, ok)
+	assert.Equal(t, "jsonb", col.DbType)
+	assert.True(t, col.IsJSON())
+
+	for _, info := range cfg.GetAllColumnsInfoFromEntity(&schemaStruct{}) {
+		if info.Typ.Name == "Title" {
+			assert.Equal(t, []string{"fulltext", "trgm"}, info.Search)
+		}
+	}
+
+	for _, name := range []string{"NoTgField", "Child", "Name"} {
+		_, ok = schema.Column(name)
+		assert.False(t, ok, name)
+	}
+}
+
+type relUser struct {
+	ID       string `gorm:"type:varchar(36);primary_key"`
+	Username string `gorm:"type:varchar(50)"`
+}
+type relWork struct {
+	ID   string   `gorm:"type:varchar(36);primary_key"`
+	User *relUser `gorm:"foreignKey:ID"`
+}
+type relEmp struct {
+	ID           string     `gorm:"type:varchar(36);primary_key"`
+	DepartmentID string     `gorm:"type:varchar(36)"`
+	User         *relUser   `gorm:"foreignKey:ID"`
+	Works        []*relWork `gorm:"foreignKey:ID"`
+	Dept         *relDept   `gorm:"foreignKey:DepartmentID"`
+}
+type relDept struct {
+	ID   string    `gorm:"type:varchar(36);primary_key"`
+	Emps []*relEmp `gorm:"foreignKey:DepartmentID"`
+}
+
+func TestGetExprSchemaRelations(t *testing.T) {
+	cfg := dbconfig.NewDbConfigBase()
+	schema := cfg.GetExprSchema(&relEmp{})
+	tests := []struct {
+		field, table, column, refColumn string
+		many                            bool
+	}{
+		{"User", "rel_users", "id", "id", false},            // has one: rel_users.id = rel_emps.id
+		{"Works", "rel_works", "id", "id", true},            // has many
+		{"Dept", "rel_depts", "department_id", "id", false}, // belongs to: rel_depts.id = rel_emps.department_id
+	}
+	for _, tt := range tests {
+		rel, ok := schema.Relation(tt.field)
+		if assert.True(t, ok, tt.field) {
+			assert.Equal(t, tt.table, rel.Target.Table)
+			assert.Equal(t, tt.column, rel.Column, tt.field)
+			assert.Equal(t, tt.refColumn, rel.RefColumn, tt.field)
+			assert.Equal(t, tt.many, rel.Many, tt.field)
+		}
+	}
+
+	// the schemas of related entities are the cached ones, cycles share them
+	dept := cfg.GetExprSchema(&relDept{})
+	rel, _ := schema.Relation("Dept")
+	assert.Same(t, dept, rel.Target)
+	rel, ok := dept.Relation("emps")
+	assert.True(t, ok)
+	assert.Same(t, schema, rel.Target)
+	assert.Equal(t, "id", rel.Column)
+	assert.Equal(t, "department_id", rel.RefColumn)
+	assert.Same(t, schema.Qualified(), schema.Qualified())
+}
+
+type relBoss struct {
+	ID       string   `gorm:"type:varchar(36);primary_key"`
+	DeptID   string   `gorm:"type:varchar(36)"`
+	Dept     relDept  `gorm:"constraint:OnDelete:CASCADE;foreignKey:DeptID"`
+	MainDept *relDept `gorm:"constraint:OnUpdate:CASCADE; foreignKey:DeptID"`
+}
+
+func TestForeignKeyNotLeading(t *testing.T) {
+	cfg := dbconfig.NewDbConfigBase()
+	names := []string{}
+	for _, info := range cfg.GetAllColumnsInfoFromEntity(&relBoss{}) {
+		names = append(names, info.Name)
+	}
+	assert.Equal(t, []string{"id", "dept_id"}, names)
+
+	schema := cfg.GetExprSchema(&relBoss{})
+	for _, field := range []string{"Dept", "MainDept"} {
+		rel, ok := schema.Relation(field)
+		if assert.True(t, ok, field) {
+			assert.Equal(t, "rel_depts", rel.Target.Table)
+			assert.Equal(t, "dept_id", rel.Column)
+			assert.Equal(t, "id", rel.RefColumn)
+		}
+	}
+	assert.Len(t, cfg.GetAllModelsInEntity(&relBoss{}), 2)
+}
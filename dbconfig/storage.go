@@ -0,0 +1,448 @@
+package dbconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+
+	"gorm.io/gorm"
+)
+
+// MigrateFunc creates or updates the tables of entities in db, a driver adds its own
+// column types and indexes after gorm's AutoMigrate
+type MigrateFunc func(db *gorm.DB, cfg IDbConfig, entities ...interface{}) error
+
+// Storage implements IStorage with gorm and the expression dialect of a driver.
+// A driver package wraps it in its own storage type and gives the migration of its database.
+type Storage struct {
+	db       *gorm.DB
+	dbConfig IDbConfig
+	parser   expr.IExpr
+	dbName   string
+	migrate  MigrateFunc
+
+	migratedLock sync.RWMutex
+	migrated     map[reflect.Type]bool
+}
+
+// NewStorage creates the storage of the database dbName opened as db,
+// migrate is nil for gorm's AutoMigrate
+func NewStorage(db *gorm.DB, dbConfig IDbConfig, parser expr.IExpr, dbName string, migrate MigrateFunc) *Storage {
+	if migrate == nil {
+		migrate = func(db *gorm.DB, cfg IDbConfig, entities ...interface{}) error {
+			return db.AutoMigrate(entities...)
+		}
+	}
+	return &Storage{
+		db:       db,
+		dbConfig: dbConfig,
+		parser:   parser,
+		dbName:   dbName,
+		migrate:  migrate,
+		migrated: make(map[reflect.Type]bool),
+	}
+}
+
+// AutoMigrate migrates the entity type behind entity (an entity, a pointer to it or
+// a pointer to a slice of it) and its related entities once per storage
+func (s *Storage) AutoMigrate(entity interface{}) error {
+	typ := reflect.TypeOf(entity)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	s.migratedLock.RLock()
+	isAutoMigrated := s.migrated[typ]
+	s.migratedLock.RUnlock()
+	if isAutoMigrated {
+		return nil
+	}
+	s.migratedLock.Lock()
+	defer s.migratedLock.Unlock()
+	if s.migrated[typ] {
+		return nil
+	}
+	entities := s.dbConfig.GetAllModelsInEntity(reflect.New(typ).Interface())
+	if err := s.migrate(s.db, s.dbConfig, entities...); err != nil {
+		return err
+	}
+	s.migrated[typ] = true
+	return nil
+}
+func (s *Storage) Save(entity interface{}) error {
+	err := s.AutoMigrate(entity)
+	if err != nil {
+		return err
+	}
+	return s.db.Save(entity).Error
+}
+func (s *Storage) Create(entity interface{}) error {
+	err := s.AutoMigrate(entity)
+	if err != nil {
+		return err
+	}
+	return s.db.Create(entity).Error
+}
+func (s *Storage) CreateInBatches(entities interface{}, batchSize int) error {
+	typ := reflect.TypeOf(entities)
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+		err := s.AutoMigrate(reflect.New(typ).Interface())
+		if err != nil {
+			return err
+		}
+
+	}
+
+	return s.db.CreateInBatches(entities, batchSize).Error
+}
+func (s *Storage) Exec(sql string, values ...interface{}) error {
+	return s.db.Exec(sql, values...).Error
+}
+func (s *Storage) Find(dest interface{}, conds ...interface{}) error {
+	typ := reflect.TypeOf(dest)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+		erMisMigrate := s.AutoMigrate(reflect.New(typ).Interface())
+		if erMisMigrate != nil {
+			return erMisMigrate
+		}
+	}
+
+	conds, joins, err := s.compileConds(dest, conds)
+	if err != nil {
+		return err
+	}
+	return withJoins(s.db, joins).Find(dest, conds...).Error
+}
+
+func (s *Storage) FindWithOptions(dest interface{}, options FindOptions, conds ...interface{}) error {
+	erMigrate := s.AutoMigrate(dest)
+	if erMigrate != nil {
+		return erMigrate
+	}
+	conds, joins, err := s.compileConds(dest, conds)
+	if err != nil {
+		return err
+	}
+	schema := s.exprSchema(dest)
+	if len(joins) > 0 && schema != nil {
+		// the joined tables may have columns of the same name
+		schema = schema.Qualified()
+	}
+	tx, err := s.applyFindOptions(withJoins(s.db, joins), schema, options)
+	if err != nil {
+		return err
+	}
+	return tx.Find(dest, conds...).Error
+}
+
+// applyFindOptions adds the compiled projection, sort and paging of options to tx
+func (s *Storage) applyFindOptions(tx *gorm.DB, schema *compiler.Schema, options FindOptions) (*gorm.DB, error) {
+	selects, err := exprText("select", options.Select)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := exprText("order by", options.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	if selects != "" {
+		sql, err := s.parser.CompileSelect(selects, schema)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Select(sql)
+	}
+	if orderBy != "" {
+		sql, err := s.parser.CompileOrderBy(orderBy, schema)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Order(sql)
+	}
+	if options.Limit > 0 {
+		tx = tx.Limit(options.Limit)
+	}
+	if options.Offset > 0 {
+		tx = tx.Offset(options.Offset)
+	}
+	return tx, nil
+}
+
+func (s *Storage) Aggregate(entity interface{}, selectExprs interface{}, groupBy interface{}, having interface{}, conds ...interface{}) ([]map[string]interface{}, error) {
+	var ret []map[string]interface{}
+	err := s.AggregateScan(&ret, entity, selectExprs, groupBy, having, conds...)
+	if err != nil {
+		return nil, err
+	}
+	// gorm scans the columns of unknown type (sqlite expressions) as *interface{}
+	for _, row := range ret {
+		for k, v := range row {
+			if p, ok := v.(*interface{}); ok && p != nil {
+				row[k] = *p
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (s *Storage) AggregateScan(dest interface{}, entity interface{}, selectExprs interface{}, groupBy interface{}, having interface{}, conds ...interface{}) error {
+	erMigrate := s.AutoMigrate(entity)
+	if erMigrate != nil {
+		return erMigrate
+	}
+	tx, err := s.aggregateQuery(entity, selectExprs, groupBy, having, conds)
+	if err != nil {
+		return err
+	}
+	return tx.Scan(dest).Error
+}
+
+// aggregateQuery builds the aggregate query of AggregateScan. The parameters of the
+// condition and of having are bound together, so a map or struct can serve both.
+func (s *Storage) aggregateQuery(entity interface{}, selectExprs interface{}, groupBy interface{}, having interface{}, conds []interface{}) (*gorm.DB, error) {
+	schema := s.exprSchema(entity)
+	var where *expr.CompiledExpr
+	var cond interface{}
+	var args []interface{}
+	selectsText, err := exprText("select", selectExprs)
+	if err != nil {
+		return nil, err
+	}
+	groupByText, err := exprText("group by", groupBy)
+	if err != nil {
+		return nil, err
+	}
+	havingText, err := exprText("having", having)
+	if err != nil {
+		return nil, err
+	}
+	if len(conds) > 0 {
+		strCon, ok, err := expr.CondText(conds[0])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("aggregate: the condition must be an expression string, tree or builder, got %T", conds[0])
+		}
+		if strCon != "" {
+			if where, err = s.parser.CompileCond(strCon, schema); err != nil {
+				return nil, err
+			}
+		}
+		cond, args = conds[0], conds[1:]
+	}
+	if args, err = expr.CondArgs([]interface{}{cond, having}, args); err != nil {
+		return nil, err
+	}
+	if where != nil && len(where.Joins) > 0 && schema != nil {
+		// the joined tables may have columns of the same name
+		schema = schema.Qualified()
+	}
+	agg, err := s.parser.CompileAggregate(selectsText, groupByText, havingText, schema)
+	if err != nil {
+		return nil, err
+	}
+	all := &expr.CompiledExpr{}
+	if where != nil {
+		all.Append(where)
+	}
+	if agg.Having != nil {
+		all.Append(agg.Having)
+	}
+	args, err = all.Bind(args...)
+	if err != nil {
+		return nil, fmt.Errorf("error binding aggregate parameters: %w", err)
+	}
+	if len(args) != len(all.Params) {
+		return nil, fmt.Errorf("aggregate: expected %d parameter value(s), got %d", len(all.Params), len(args))
+	}
+
+	tx := s.db.Model(entity).Select(agg.Select)
+	if where != nil {
+		tx = withJoins(tx, where.Joins)
+		tx = tx.Where(where.SQL, args[:len(where.Params)]...)
+		args = args[len(where.Params):]
+	}
+	if agg.GroupBy != "" {
+		tx = tx.Group(agg.GroupBy)
+	}
+	if agg.Having != nil {
+		tx = tx.Having(agg.Having.SQL, args...)
+	}
+	return tx, nil
+}
+
+func (s *Storage) Update(entity interface{}, conds ...interface{}) error {
+	erMigrate := s.AutoMigrate(entity)
+	if erMigrate != nil {
+		return erMigrate
+	}
+
+	conds, joins, err := s.compileConds(entity, conds)
+	if err != nil {
+		return err
+	}
+	if len(joins) > 0 {
+		return fmt.Errorf("fields of related entities cannot be used in the condition of update")
+	}
+	if len(conds) > 0 {
+		return s.db.Model(entity).Where(conds[0], conds[1:]...).Updates(entity).Error
+	}
+	return s.db.Model(entity).Updates(entity).Error
+}
+
+func (s *Storage) First(dest interface{}, conds ...interface{}) error {
+
+	erMigrate := s.AutoMigrate(dest)
+	if erMigrate != nil {
+		return erMigrate
+	}
+
+	conds, joins, err := s.compileConds(dest, conds)
+	if err != nil {
+		return err
+	}
+	return withJoins(s.db, joins).First(dest, conds...).Error
+}
+func (s *Storage) Delete(value interface{}, conds ...interface{}) error {
+	erMigrate := s.AutoMigrate(value)
+	if erMigrate != nil {
+		return erMigrate
+	}
+	conds, joins, err := s.compileConds(value, conds)
+	if err != nil {
+		return err
+	}
+	if len(joins) > 0 {
+		return fmt.Errorf("fields of related entities cannot be used in the condition of delete")
+	}
+	return s.db.Delete(value, conds...).Error
+}
+func (s *Storage) Count(entity interface{}, conds ...interface{}) (int64, error) {
+	erMigrate := s.AutoMigrate(entity)
+	if erMigrate != nil {
+		return 0, erMigrate
+	}
+	var ret int64
+	conds, joins, err := s.compileConds(entity, conds)
+	if err != nil {
+		return 0, err
+	}
+	tx := withJoins(s.db.Model(entity), joins)
+	if len(conds) > 0 {
+		tx = tx.Where(conds[0], conds[1:]...)
+	}
+	errL := tx.Count(&ret).Error
+	if errL != nil {
+		return 0, errL
+	}
+	return ret, nil
+}
+
+// compileConds compiles the expression in conds[0] (if it is a string, a *compiler.SimpleExprTree,
+// an *expr.Builder or an *expr.Filter, whose values are bound as parameters) to the sql of the storage dialect.
+// Field names are resolved against the columns of model (an entity, a pointer to it
+// or a pointer to a slice of it), so unknown fields fail here instead of in the database.
+// The remaining items are the values of the "?" placeholders, so gorm can
+// expand a slice bound to "in ?" or "in (?)".
+// When the expression uses named parameters (@name or :name) the remaining item is
+// a map or a struct (see expr.CompiledExpr.Bind) and is turned into positional values.
+// An invalid expression is returned as an error wrapping *compiler.ParseError
+// instead of being sent to the database.
+// joins are the "LEFT JOIN ..." clauses needed by fields of related entities (User.Username).
+func (s *Storage) compileConds(model interface{}, conds []interface{}) ([]interface{}, []string, error) {
+	conds, err := expr.ExpandFilter(conds)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conds) == 0 {
+		return conds, nil, nil
+	}
+	strCon, ok, err := expr.CondText(conds[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return conds, nil, nil
+	}
+	compiled, err := s.parser.CompileCond(strCon, s.exprSchema(model))
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err := expr.CondArgs(conds[:1], conds[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err = compiled.Bind(args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error binding expression %q: %w", strCon, err)
+	}
+	ret := make([]interface{}, 0, len(args)+1)
+	ret = append(ret, compiled.SQL)
+	return append(ret, args...), compiled.Joins, nil
+}
+
+// exprText returns the text of an expression option (select, order by, group by, having):
+// a string, a *compiler.SimpleExprTree or an *expr.Builder, "" for nil
+func exprText(name string, v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	text, ok, err := expr.CondText(v)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%s must be an expression string, tree or builder, got %T", name, v)
+	}
+	return text, nil
+}
+
+// withJoins adds the joins of a compiled condition to tx
+func withJoins(tx *gorm.DB, joins []string) *gorm.DB {
+	for _, j := range joins {
+		tx = tx.Joins(j)
+	}
+	return tx
+}
+
+// exprSchema returns the expression schema of the entity type behind model,
+// or nil when model is not a struct (or pointer / slice of struct)
+func (s *Storage) exprSchema(model interface{}) *compiler.Schema {
+	if model == nil || s.dbConfig == nil {
+		return nil
+	}
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return s.dbConfig.GetExprSchema(reflect.New(typ).Interface())
+}
+func (s *Storage) SetDbConfig(config IDbConfig) {
+	s.dbConfig = config
+}
+func (s *Storage) GetDbConfig() IDbConfig {
+	return s.dbConfig
+}
+func (s *Storage) GetDb() *gorm.DB {
+	return s.db
+}
+func (s *Storage) GetParser() expr.IExpr {
+	return s.parser
+}
+func (s *Storage) SetParser(parser expr.IExpr) {
+	s.parser = parser
+}
+func (s *Storage) GetDbName() string {
+	return s.dbName
+}
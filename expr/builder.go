@@ -0,0 +1,447 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// minimum precedence of operands which the parser reads without parentheses
+const (
+	anyPrec     = 1 // function arguments
+	comparePrec = 3 // operand of not, is null, in and between ("not a == b" is "not (a == b)")
+	itemPrec    = 4 // items of an in list and bounds of between
+)
+
+// Builder builds a *compiler.SimpleExprTree in Go instead of formatting an expression string:
+//
+//	expr.Field("Code").Eq(expr.Param()).And(expr.Func("year", expr.Field("CreatedOn")).Gte(2024))
+//
+// Operands may be another *Builder, a *compiler.SimpleExprTree or a Go value (numbers, string,
+// bool, nil) which becomes a literal. A time.Time is bound as a "?" parameter instead, a
+// literal would lose its zone; BindArgs returns it with the values of the other parameters.
+// Parentheses are added where needed, so String() gives an expression which parses back
+// to the same tree.
+// A Builder is immutable, every method returns a new one. The first error (such as an invalid
+// field name or an unsupported value) is kept and returned by Build.
+type Builder struct {
+	tree *compiler.SimpleExprTree
+	err  error
+	// one item per "?" of tree in order: the bound value, or unbound for a parameter
+	// whose value is given to BindArgs
+	slots []interface{}
+}
+
+// unbound marks a "?" of a Builder whose value is not bound by the builder
+type unbound struct{}
+
+// Field is a field of the entity (Go field name or column name), or a json path such as "Data.address.city"
+func Field(name string) *Builder {
+	tree, err := compiler.ParseExpr(name)
+	if err != nil || (tree.Nt != "field" && tree.Nt != "json") {
+		return &Builder{err: fmt.Errorf("invalid field name '%s'", name)}
+	}
+	return &Builder{tree: tree}
+}
+
+// Param is a positional parameter "?"
+func Param() *Builder {
+	return &Builder{tree: &compiler.SimpleExprTree{V: "?", Nt: "param"}, slots: []interface{}{unbound{}}}
+}
+
+// NamedParam is a named parameter "@name"
+func NamedParam(name string) *Builder {
+	if !compiler.IsValidColumnName(name) {
+		return &Builder{err: fmt.Errorf("invalid parameter name '%s'", name)}
+	}
+	return &Builder{tree: &compiler.SimpleExprTree{V: "@" + name, Nt: "param"}}
+}
+
+// Value is a literal, or a bound parameter for a time.Time
+func Value(v interface{}) *Builder {
+	ret := &Builder{}
+	ret.tree = ret.value(v)
+	return ret.checked()
+}
+
+// Func is a function call such as Func("year", Field("CreatedOn"))
+func Func(name string, args ...interface{}) *Builder {
+	if !compiler.IsValidColumnName(name) {
+		return &Builder{err: fmt.Errorf("invalid function name '%s'", name)}
+	}
+	ret := &Builder{tree: &compiler.SimpleExprTree{V: name, Nt: "func"}}
+	for _, arg := range args {
+		ret.tree.Ns = append(ret.tree.Ns, ret.operand(arg, anyPrec))
+	}
+	return ret.checked()
+}
+
+// And joins the conditions with "and", nil items are skipped
+func And(conds ...interface{}) *Builder {
+	return join("and", conds)
+}
+
+// Or joins the conditions with "or", nil items are skipped
+func Or(conds ...interface{}) *Builder {
+	return join("or", conds)
+}
+
+// Not negates a condition
+func Not(cond interface{}) *Builder {
+	ret := &Builder{}
+	ret.tree = &compiler.SimpleExprTree{Op: "not", Nt: "unary"}
+	ret.tree.Ns = []*compiler.SimpleExprTree{ret.operand(cond, comparePrec)}
+	return ret.checked()
+}
+
+func (b *Builder) Eq(v interface{}) *Builder      { return b.binary("==", v) }
+func (b *Builder) Ne(v interface{}) *Builder      { return b.binary("!=", v) }
+func (b *Builder) Lt(v interface{}) *Builder      { return b.binary("<", v) }
+func (b *Builder) Lte(v interface{}) *Builder     { return b.binary("<=", v) }
+func (b *Builder) Gt(v interface{}) *Builder      { return b.binary(">", v) }
+func (b *Builder) Gte(v interface{}) *Builder     { return b.binary(">=", v) }
+func (b *Builder) Like(v interface{}) *Builder    { return b.binary("like", v) }
+func (b *Builder) ILike(v interface{}) *Builder   { return b.binary("ilike", v) }
+func (b *Builder) NotLike(v interface{}) *Builder { return b.binary("not like", v) }
+func (b *Builder) Add(v interface{}) *Builder     { return b.binary("+", v) }
+func (b *Builder) Sub(v interface{}) *Builder     { return b.binary("-", v) }
+func (b *Builder) Mul(v interface{}) *Builder     { return b.binary("*", v) }
+func (b *Builder) Div(v interface{}) *Builder     { return b.binary("/", v) }
+func (b *Builder) Mod(v interface{}) *Builder     { return b.binary("%", v) }
+
+// And joins b and the conditions with "and"
+func (b *Builder) And(conds ...interface{}) *Builder {
+	return join("and", append([]interface{}{b}, conds...))
+}
+
+// Or joins b and the conditions with "or"
+func (b *Builder) Or(conds ...interface{}) *Builder {
+	return join("or", append([]interface{}{b}, conds...))
+}
+
+// Not negates b
+func (b *Builder) Not() *Builder {
+	return Not(b)
+}
+
+// In is "in ?" when values is a single Param, otherwise "in (v1, v2, ...)"
+func (b *Builder) In(values ...interface{}) *Builder {
+	return b.in("in", values)
+}
+
+func (b *Builder) NotIn(values ...interface{}) *Builder {
+	return b.in("not in", values)
+}
+
+func (b *Builder) Between(low interface{}, high interface{}) *Builder {
+	return b.between("between", low, high)
+}
+
+func (b *Builder) NotBetween(low interface{}, high interface{}) *Builder {
+	return b.between("not between", low, high)
+}
+
+func (b *Builder) IsNull() *Builder {
+	return b.postfix("is null")
+}
+
+func (b *Builder) IsNotNull() *Builder {
+	return b.postfix("is not null")
+}
+
+// BindArgs returns the values of the "?" parameters of the tree in order: the values bound
+// by the builder (time.Time) with args in place of the other parameters. args are returned
+// unchanged when the builder binds no value.
+func (b *Builder) BindArgs(args ...interface{}) ([]interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return CondArgs([]interface{}{b}, args)
+}
+
+// Build returns the tree, or the first error met while building it.
+// The values bound by the builder are not in the tree, see BindArgs
+func (b *Builder) Build() (*compiler.SimpleExprTree, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.tree.Clone(), nil
+}
+
+// Tree returns the tree, nil if the builder has an error
+func (b *Builder) Tree() *compiler.SimpleExprTree {
+	tree, _ := b.Build()
+	return tree
+}
+
+// String returns the expression text of the tree
+func (b *Builder) String() string {
+	if b.err != nil {
+		return ""
+	}
+	return b.tree.String()
+}
+
+func (b *Builder) binary(op string, v interface{}) *Builder {
+	prec := compiler.OpPrecedence(op)
+	ret := &Builder{err: b.err}
+	left := ret.operand(b, prec)
+	// operators group from left to right, so a right operand of the same level needs parentheses
+	right := ret.operand(v, prec+1)
+	ret.tree = &compiler.SimpleExprTree{Op: op, Ns: []*compiler.SimpleExprTree{left, right}}
+	return ret.checked()
+}
+
+func (b *Builder) postfix(op string) *Builder {
+	ret := &Builder{err: b.err}
+	ret.tree = &compiler.SimpleExprTree{Op: op, Nt: "postfix"}
+	ret.tree.Ns = []*compiler.SimpleExprTree{ret.operand(b, comparePrec)}
+	return ret.checked()
+}
+
+func (b *Builder) in(op string, values []interface{}) *Builder {
+	ret := &Builder{err: b.err}
+	left := ret.operand(b, comparePrec)
+	var right *compiler.SimpleExprTree
+	if len(values) == 1 {
+		if p, ok := values[0].(*Builder); ok && p.tree != nil && p.tree.Nt == "param" &&
+			(len(p.slots) == 0 || p.slots[0] == (unbound{})) {
+			right = ret.operand(p, itemPrec)
+		}
+	}
+	if right == nil {
+		if len(values) == 0 {
+			return &Builder{err: fmt.Errorf("%s requires at least one value", op)}
+		}
+		right = &compiler.SimpleExprTree{Nt: "list"}
+		for _, v := range values {
+			right.Ns = append(right.Ns, ret.operand(v, itemPrec))
+		}
+	}
+	ret.tree = &compiler.SimpleExprTree{Op: op, Ns: []*compiler.SimpleExprTree{left, right}}
+	return ret.checked()
+}
+
+func (b *Builder) between(op string, low interface{}, high interface{}) *Builder {
+	ret := &Builder{err: b.err}
+	ret.tree = &compiler.SimpleExprTree{Op: op, Nt: "between"}
+	ret.tree.Ns = []*compiler.SimpleExprTree{ret.operand(b, comparePrec), ret.operand(low, itemPrec), ret.operand(high, itemPrec)}
+	return ret.checked()
+}
+
+// join joins the conditions with and/or, nil items are skipped
+func join(op string, conds []interface{}) *Builder {
+	ret := &Builder{}
+	prec := compiler.OpPrecedence(op)
+	for _, c := range conds {
+		if c == nil || c == (*Builder)(nil) {
+			continue
+		}
+		if ret.tree == nil {
+			ret.tree = ret.operand(c, prec)
+			continue
+		}
+		ret.tree = &compiler.SimpleExprTree{Op: op, Ns: []*compiler.SimpleExprTree{ret.tree, ret.operand(c, prec+1)}}
+	}
+	if ret.tree == nil && ret.err == nil {
+		ret.err = fmt.Errorf("%s requires at least one condition", op)
+	}
+	return ret.checked()
+}
+
+// operand turns v into a child node, in parentheses when its precedence is below minPrec.
+// Errors are kept in b
+func (b *Builder) operand(v interface{}, minPrec int) *compiler.SimpleExprTree {
+	var tree *compiler.SimpleExprTree
+	switch x := v.(type) {
+	case *Builder:
+		if x.err != nil {
+			b.setErr(x.err)
+			return nil
+		}
+		tree = x.tree.Clone()
+		b.slots = append(b.slots, x.slots...)
+	case *compiler.SimpleExprTree:
+		tree = x.Clone()
+		for i := countParams(tree); i > 0; i-- {
+			b.slots = append(b.slots, unbound{})
+		}
+	default:
+		if tree = b.value(v); tree == nil {
+			return nil
+		}
+	}
+	if tree != nil && compiler.NodePrecedence(tree) < minPrec {
+		tree = &compiler.SimpleExprTree{Op: "()", Ns: []*compiler.SimpleExprTree{tree}}
+	}
+	return tree
+}
+
+func (b *Builder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// checked drops the tree of a builder with an error
+func (b *Builder) checked() *Builder {
+	if b.err != nil {
+		b.tree = nil
+	}
+	return b
+}
+
+// value turns a Go value into a literal node, or into a "?" bound to it for a time.Time:
+// a timestamp literal has no zone, the database would read it in the zone of the session
+// (or of a DATETIME column) instead of the zone of the value. Errors are kept in b
+func (b *Builder) value(v interface{}) *compiler.SimpleExprTree {
+	switch t := v.(type) {
+	case time.Time:
+		b.slots = append(b.slots, t)
+		return &compiler.SimpleExprTree{V: "?", Nt: "param"}
+	case *time.Time:
+		if t != nil {
+			b.slots = append(b.slots, *t)
+			return &compiler.SimpleExprTree{V: "?", Nt: "param"}
+		}
+	}
+	tree, err := literal(v)
+	if err != nil {
+		b.setErr(err)
+		return nil
+	}
+	return tree
+}
+
+// countParams counts the positional "?" of tree
+func countParams(tree *compiler.SimpleExprTree) int {
+	if tree == nil {
+		return 0
+	}
+	n := 0
+	if tree.Nt == "param" && tree.V == "?" {
+		n++
+	}
+	for _, c := range tree.Ns {
+		n += countParams(c)
+	}
+	return n
+}
+
+// literal turns a Go value into a literal node
+func literal(v interface{}) (*compiler.SimpleExprTree, error) {
+	if v == nil {
+		return &compiler.SimpleExprTree{V: "null", Nt: "const", Lk: "null"}, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return literal(nil)
+		}
+		return literal(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &compiler.SimpleExprTree{V: strconv.FormatInt(rv.Int(), 10), Nt: "const", Lk: "int"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &compiler.SimpleExprTree{V: strconv.FormatUint(rv.Uint(), 10), Nt: "const", Lk: "int"}, nil
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(rv.Float()) || math.IsInf(rv.Float(), 0) {
+			return nil, fmt.Errorf("unsupported value %v in expression, it has no literal", v)
+		}
+		text := strconv.FormatFloat(rv.Float(), 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			// keep the float kind: 2.0 is not the integer 2
+			text += ".0"
+		}
+		return &compiler.SimpleExprTree{V: text, Nt: "const", Lk: "float"}, nil
+	case reflect.Bool:
+		return &compiler.SimpleExprTree{V: strconv.FormatBool(rv.Bool()), Nt: "const", Lk: "bool"}, nil
+	case reflect.String:
+		return &compiler.SimpleExprTree{V: compiler.Quote(rv.String()), Nt: "const", Lk: "string"}, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v of type %T in expression, use a parameter instead", v, v)
+}
+
+// CondText returns the expression text of a condition given to IStorage:
+// a string, a *compiler.SimpleExprTree or a *Builder. ok is false for other values
+// (such as a struct condition of gorm), which are passed to gorm as they are.
+func CondText(cond interface{}) (text string, ok bool, err error) {
+	switch c := cond.(type) {
+	case string:
+		return c, true, nil
+	case *compiler.SimpleExprTree:
+		if c == nil {
+			return "", true, fmt.Errorf("condition is a nil expression tree")
+		}
+		return c.String(), true, nil
+	case *Builder:
+		if c == nil {
+			return "", true, fmt.Errorf("condition is a nil builder")
+		}
+		tree, err := c.Build()
+		if err != nil {
+			return "", true, err
+		}
+		return tree.String(), true, nil
+	}
+	return "", false, nil
+}
+
+// CondArgs returns the values of the "?" parameters of conds, the expressions given to IStorage
+// (see CondText) in the order their parameters are bound: the values bound by a *Builder
+// (time.Time) with args in place of the other parameters. args are returned unchanged
+// when no builder binds a value.
+func CondArgs(conds []interface{}, args []interface{}) ([]interface{}, error) {
+	var slots []interface{}
+	bound := false
+	for _, cond := range conds {
+		if b, ok := cond.(*Builder); ok && b != nil {
+			for _, s := range b.slots {
+				if _, ok := s.(unbound); !ok {
+					bound = true
+				}
+			}
+			slots = append(slots, b.slots...)
+			continue
+		}
+		text, ok, err := CondText(cond)
+		if err != nil || !ok || text == "" {
+			continue
+		}
+		tree, err := compiler.ParseExpr(text)
+		if err != nil {
+			// reported when the expression is compiled
+			continue
+		}
+		for i := countParams(tree); i > 0; i-- {
+			slots = append(slots, unbound{})
+		}
+	}
+	if !bound {
+		return args, nil
+	}
+	free := 0
+	for _, s := range slots {
+		if _, ok := s.(unbound); ok {
+			free++
+		}
+	}
+	if len(args) != free {
+		return nil, fmt.Errorf("expression has %d parameter(s) besides the bound values, got %d value(s)", free, len(args))
+	}
+	ret := make([]interface{}, len(slots))
+	next := 0
+	for i, s := range slots {
+		if _, ok := s.(unbound); ok {
+			s = args[next]
+			next++
+		}
+		ret[i] = s
+	}
+	return ret, nil
+}
@@ -0,0 +1,134 @@
+package expr_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+	"github.com/nttlong/regorm/expr/exprpostgres"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	day := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		b    *expr.Builder
+		want string
+	}{
+		{expr.Field("Code").Eq(expr.Param()).And(expr.Func("year", expr.Field("CreatedOn")).Gte(2024)),
+			"Code == ? and year(CreatedOn) >= 2024"},
+		{expr.Or(expr.Field("A").Eq(1), expr.Field("B").Eq(2)).And(expr.Field("C").IsNull()),
+			"(A == 1 or B == 2) and C is null"},
+		{expr.Field("A").Eq(1).Or(expr.Field("B").Eq(2).And(expr.Field("C").Eq(3))),
+			"A == 1 or B == 2 and C == 3"},
+		{expr.Field("Price").Sub(expr.Field("Cost").Sub(1)).Mul(2).Gt(expr.NamedParam("min")),
+			"(Price - (Cost - 1)) * 2 > @min"},
+		{expr.Not(expr.Field("Name").Like("a%")), "not Name like 'a%'"},
+		{expr.Field("ID").In(expr.Param()), "ID in ?"},
+		{expr.Field("ID").NotIn(1, 2, 3), "ID not in (1, 2, 3)"},
+		{expr.Field("Price").Between(1.5, 2.0), "Price between 1.5 and 2.0"},
+		// a time is bound as a parameter, see TestBuilderBindArgs
+		{expr.Field("CreatedOn").Lt(day), "CreatedOn < ?"},
+		{expr.Field("Name").Eq("it's"), "Name == 'it''s'"},
+		{expr.Field("Active").Eq(true).And(expr.Field("Note").IsNotNull()), "Active == true and Note is not null"},
+		{expr.Field("Data.address.city").ILike("ha%"), "Data.address.city ilike 'ha%'"},
+		{expr.And(expr.Field("A").Eq(1), nil, expr.Field("B").Ne(expr.Value(nil))), "A == 1 and B != null"},
+	}
+	for _, tt := range tests {
+		tree, err := tt.b.Build()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, tree.String())
+
+		// String() parses back to the same expression
+		parsed, err := compiler.ParseExpr(tt.b.String())
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, parsed.String())
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		b   *expr.Builder
+		err string
+	}{
+		{expr.Field("A B"), "field"},
+		{expr.Field("len(Name)"), "field"},
+		{expr.Field("A").Eq(struct{}{}), "unsupported value"},
+		{expr.Field("A").In(), "in"},
+		{expr.NamedParam(""), "parameter"},
+		{expr.Field("Price").Gt(math.NaN()), "unsupported value"},
+		{expr.Field("Price").Lt(math.Inf(1)), "unsupported value"},
+	}
+	for _, tt := range tests {
+		_, err := tt.b.Build()
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	}
+}
+
+func TestCondText(t *testing.T) {
+	text, ok, err := expr.CondText(expr.Field("Code").Eq(expr.Param()))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Code == ?", text)
+
+	tree, _ := compiler.ParseExpr("year(CreatedOn) == 2024")
+	text, ok, _ = expr.CondText(tree)
+	assert.True(t, ok)
+	assert.Equal(t, "year(CreatedOn) == 2024", text)
+
+	_, ok, _ = expr.CondText(map[string]interface{}{"code": 1})
+	assert.False(t, ok)
+
+	_, ok, err = expr.CondText(expr.Field("A").Eq(struct{}{}))
+	assert.True(t, ok)
+	assert.Error(t, err)
+
+	_, ok, err = expr.CondText((*expr.Builder)(nil))
+	assert.True(t, ok)
+	assert.Error(t, err)
+}
+
+func TestBuilderBindArgs(t *testing.T) {
+	ict := time.FixedZone("ICT", 7*3600)
+	day := time.Date(2024, 1, 2, 0, 30, 0, 0, ict)
+	b := expr.Field("Code").Eq(expr.Param()).And(expr.Field("CreatedOn").Between(day, &day), expr.Field("Price").Gt(expr.Param()))
+	assert.Equal(t, "Code == ? and CreatedOn between ? and ? and Price > ?", b.String())
+	// the time keeps its zone, the database driver sends the instant
+	args, err := b.BindArgs("A", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"A", day, day, 10}, args)
+	// the parameters of several expressions are bound in order
+	args, err = expr.CondArgs([]interface{}{"Name == ?", b, nil, "Total > ?"}, []interface{}{"x", "A", 10, 5})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"x", "A", day, day, 10, 5}, args)
+	_, err = b.BindArgs("A")
+	assert.Error(t, err)
+
+	// a tree operand brings its own parameters
+	tree, _ := compiler.ParseExpr("Name == ?")
+	args, err = expr.And(tree, expr.Field("CreatedOn").Lt(expr.Value(day))).BindArgs("x")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"x", day}, args)
+
+	// without bound values the arguments are unchanged, named ones included
+	named := map[string]interface{}{"min": 1}
+	args, err = expr.Field("Price").Gt(expr.NamedParam("min")).BindArgs(named)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{named}, args)
+	args, err = expr.CondArgs([]interface{}{"Price > ?"}, []interface{}{1})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1}, args)
+}
+
+func TestBuilderCompile(t *testing.T) {
+	p := exprpostgres.New()
+	text, _, _ := expr.CondText(expr.Field("Code").Eq(expr.Param()).And(expr.Func("year", expr.Field("CreatedOn")).Gte(2024)))
+	sql, err := p.CompileExpr(text)
+	assert.NoError(t, err)
+	assert.Equal(t, "code = ? and created_on >= TIMESTAMP '2024-01-01 00:00:00'", sql)
+}
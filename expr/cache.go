@@ -0,0 +1,162 @@
+package expr
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// DefaultCacheSize is the number of compiled expressions kept by the shared cache
+const DefaultCacheSize = 1024
+
+// CacheStats is a snapshot of the counters of an ExprCache
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+	Capacity  int
+}
+
+// ExprCache is a bounded LRU cache of compiled expressions, safe for concurrent use.
+// A capacity of 0 turns the cache off.
+type ExprCache struct {
+	lock      sync.Mutex
+	capacity  int
+	ll        *list.List
+	items     map[string]*list.Element
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type cacheEntry struct {
+	key   string
+	value *CompiledExpr
+}
+
+func NewExprCache(capacity int) *ExprCache {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &ExprCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *ExprCache) Get(key string) (*CompiledExpr, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.capacity == 0 {
+		return nil, false
+	}
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.hits++
+		return el.Value.(*cacheEntry).value, true
+	}
+	c.misses++
+	return nil, false
+}
+
+func (c *ExprCache) Put(key string, value *CompiledExpr) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.capacity == 0 {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).value = value
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, value: value})
+	c.evict()
+}
+
+// SetCapacity resizes the cache, evicting the least recently used entries if needed.
+// 0 turns the cache off and drops every entry.
+func (c *ExprCache) SetCapacity(capacity int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if capacity < 0 {
+		capacity = 0
+	}
+	c.capacity = capacity
+	c.evict()
+}
+
+// Clear drops every entry and resets the counters
+func (c *ExprCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.hits, c.misses, c.evictions = 0, 0, 0
+}
+
+func (c *ExprCache) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.ll.Len(),
+		Capacity:  c.capacity,
+	}
+}
+
+// evict removes the oldest entries until the cache fits its capacity, lock must be held
+func (c *ExprCache) evict() {
+	for c.ll.Len() > c.capacity {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+}
+
+// the cache shared by every dialect, entries are keyed by dialect and expression text
+var compiledCache = NewExprCache(DefaultCacheSize)
+
+// GetCache returns the shared cache of compiled expressions
+func GetCache() *ExprCache {
+	return compiledCache
+}
+
+// SetCacheSize resizes the shared cache, 0 turns it off
+func SetCacheSize(size int) {
+	compiledCache.SetCapacity(size)
+}
+
+// GetCacheStats returns the counters of the shared cache
+func GetCacheStats() CacheStats {
+	return compiledCache.Stats()
+}
+
+// CompileCached returns the compiled expr for dialect from the shared cache,
+// calling compile on a miss. Errors are not cached.
+// The ID of the schema is part of the key (nil means the expression is compiled without
+// schema). It is never reused, unlike the address of a collected schema, so an ad hoc schema
+// cannot get the sql of another entity; schemas should still be long-lived to be served
+// from the cache, such as the ones from IDbConfigBase.GetExprSchema.
+func CompileCached(dialect string, expr string, schema *compiler.Schema, compile func() (*CompiledExpr, error)) (*CompiledExpr, error) {
+	key := dialect + "\x00" + expr
+	if schema != nil {
+		key = fmt.Sprintf("%s\x00%d\x00%s", dialect, schema.ID(), expr)
+	}
+	if ret, ok := compiledCache.Get(key); ok {
+		return ret, nil
+	}
+	ret, err := compile()
+	if err != nil {
+		return nil, err
+	}
+	compiledCache.Put(key, ret)
+	return ret, nil
+}
@@ -0,0 +1,111 @@
+package expr_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprCacheLRU(t *testing.T) {
+	c := expr.NewExprCache(2)
+	c.Put("a", &expr.CompiledExpr{SQL: "1"})
+	c.Put("b", &expr.CompiledExpr{SQL: "2"})
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	c.Put("c", &expr.CompiledExpr{SQL: "3"}) // "b" is the least recently used
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "3", v.SQL)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, 2, stats.Capacity)
+
+	c.SetCapacity(1)
+	assert.Equal(t, 1, c.Stats().Size)
+	assert.Equal(t, uint64(2), c.Stats().Evictions)
+
+	c.SetCapacity(0)
+	c.Put("d", &expr.CompiledExpr{SQL: "4"})
+	_, ok = c.Get("d")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Stats().Size)
+}
+
+func TestExprCacheConcurrent(t *testing.T) {
+	c := expr.NewExprCache(16)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("k%d", (i+j)%32)
+				if _, ok := c.Get(key); !ok {
+					c.Put(key, &expr.CompiledExpr{SQL: key})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := c.Stats()
+	assert.Equal(t, uint64(8000), stats.Hits+stats.Misses)
+	assert.LessOrEqual(t, stats.Size, 16)
+}
+
+func TestCompileCached(t *testing.T) {
+	expr.GetCache().Clear()
+	calls := 0
+	compile := func() (*expr.CompiledExpr, error) {
+		calls++
+		return &expr.CompiledExpr{SQL: "code = ?", Params: []string{""}}, nil
+	}
+	schema := compiler.NewSchema("Emp", "emps", nil)
+	for i := 0; i < 3; i++ {
+		r, err := expr.CompileCached("test", "Code == ?", nil, compile)
+		assert.NoError(t, err)
+		assert.Equal(t, "code = ?", r.SQL)
+		_, err = expr.CompileCached("test", "Code == ?", schema, compile)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+	_, err := expr.CompileCached("test", "bad", nil, func() (*expr.CompiledExpr, error) {
+		return nil, fmt.Errorf("bad")
+	})
+	assert.Error(t, err)
+	stats := expr.GetCacheStats()
+	assert.Equal(t, uint64(4), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestCompileCachedSchemaKey(t *testing.T) {
+	expr.GetCache().Clear()
+	compile := func(sql string) func() (*expr.CompiledExpr, error) {
+		return func() (*expr.CompiledExpr, error) { return &expr.CompiledExpr{SQL: sql}, nil }
+	}
+	// schemas built one after the other for a single call, each gets its own entries
+	// even if the second one is allocated where the first one was
+	for _, col := range []string{"code", "emp_code"} {
+		schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{{Field: "Code", Name: col}})
+		r, err := expr.CompileCached("test", "Code == ?", schema, compile(col+" = ?"))
+		assert.NoError(t, err)
+		assert.Equal(t, col+" = ?", r.SQL)
+	}
+	a, b := compiler.NewSchema("A", "a", nil), &compiler.Schema{Name: "B"}
+	assert.NotZero(t, a.ID())
+	assert.NotZero(t, b.ID())
+	assert.NotEqual(t, a.ID(), b.ID())
+	assert.Equal(t, a.ID(), a.ID())
+	assert.NotEqual(t, a.ID(), a.Qualified().ID())
+}
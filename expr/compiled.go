@@ -0,0 +1,251 @@
+package expr
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// CompiledExpr is the sql of an expression together with its placeholders.
+// Every placeholder is rendered as "?", Params holds one entry per "?" in the order
+// they appear in SQL: the name of a named parameter ("@code" or ":code" gives "code")
+// or "" for a positional one.
+// Joins are the "LEFT JOIN ..." clauses needed by fields of related entities such as
+// User.Username, the columns of the entity itself are then qualified by its table.
+// ArgIdx is set when a positional parameter appears several times in SQL (the optimiser
+// turns year(CreatedOn) == ? into a range using it twice): the index of the argument of
+// each "?". It is nil when every "?" has its own argument.
+// A CompiledExpr may be shared through the cache, it must not be modified.
+type CompiledExpr struct {
+	SQL    string
+	Params []string
+	Joins  []string
+	ArgIdx []int
+
+	// args maps the positional parameter nodes to their argument while compiling,
+	// names keeps the name of the named ones (the node is rendered as "?" after the first use)
+	args  map[*compiler.SimpleExprTree]int
+	names map[*compiler.SimpleExprTree]string
+}
+
+// NumArgs is the number of positional arguments the expression expects
+func (c *CompiledExpr) NumArgs() int {
+	if c.ArgIdx == nil {
+		return len(c.Params)
+	}
+	n := 0
+	for _, i := range c.ArgIdx {
+		if i+1 > n {
+			n = i + 1
+		}
+	}
+	return n
+}
+
+// Append adds the parameters of next, whose sql follows the sql of c in the query
+// (WHERE then HAVING), so a single Bind gives the values of both
+func (c *CompiledExpr) Append(next *CompiledExpr) {
+	if c.ArgIdx != nil || next.ArgIdx != nil {
+		idx := c.argIdx()
+		offset := c.NumArgs()
+		for _, i := range next.argIdx() {
+			idx = append(idx, i+offset)
+		}
+		c.ArgIdx = idx
+	}
+	c.Params = append(c.Params, next.Params...)
+}
+
+func (c *CompiledExpr) argIdx() []int {
+	if c.ArgIdx != nil {
+		return append([]int(nil), c.ArgIdx...)
+	}
+	idx := make([]int, len(c.Params))
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// addParam records a parameter node rendered as the next "?" of SQL
+func (c *CompiledExpr) addParam(n *compiler.SimpleExprTree) {
+	if c.args == nil {
+		c.args = map[*compiler.SimpleExprTree]int{}
+		c.names = map[*compiler.SimpleExprTree]string{}
+	}
+	name, ok := c.names[n]
+	if !ok {
+		name = n.ParamName()
+	}
+	c.Params = append(c.Params, name)
+	if name != "" {
+		c.names[n] = name
+		c.ArgIdx = append(c.ArgIdx, -1)
+		return
+	}
+	i, ok := c.args[n]
+	if !ok {
+		i = len(c.args)
+		c.args[n] = i
+	}
+	c.ArgIdx = append(c.ArgIdx, i)
+}
+
+// doneParams drops ArgIdx when it is not needed
+func (c *CompiledExpr) doneParams() {
+	shared := len(c.args) < len(c.Params) && !c.HasNamedParams()
+	c.args, c.names = nil, nil
+	if !shared {
+		c.ArgIdx = nil
+	}
+}
+
+// HasNamedParams reports whether the expression uses "@name" or ":name" placeholders
+func (c *CompiledExpr) HasNamedParams() bool {
+	for _, p := range c.Params {
+		if p != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParamError reports the named parameters which could not be bound
+type ParamError struct {
+	Missing []string // parameters used in the expression without a value
+	Unused  []string // values given for parameters the expression does not use
+}
+
+func (e *ParamError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing parameter(s) "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unused) > 0 {
+		parts = append(parts, "unused parameter(s) "+strings.Join(e.Unused, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Bind returns the values of the "?" placeholders of SQL, in order.
+// When the expression has only positional parameters args are returned unchanged
+// (repeated following ArgIdx when it is set).
+// Otherwise args must be either a single map with string keys, a single struct
+// (or pointer to struct) whose fields are matched by name (case-insensitive),
+// or a list of sql.NamedArg. A name used several times gets the same value each time.
+// Names without value are reported as missing; for maps and sql.NamedArg the values
+// not used by the expression are reported as unused.
+func (c *CompiledExpr) Bind(args ...interface{}) ([]interface{}, error) {
+	if !c.HasNamedParams() {
+		if c.ArgIdx == nil {
+			return args, nil
+		}
+		if len(args) != c.NumArgs() {
+			return nil, fmt.Errorf("expression has %d parameter(s), got %d value(s)", c.NumArgs(), len(args))
+		}
+		ret := make([]interface{}, len(c.ArgIdx))
+		for i, a := range c.ArgIdx {
+			ret[i] = args[a]
+		}
+		return ret, nil
+	}
+	for _, p := range c.Params {
+		if p == "" {
+			return nil, fmt.Errorf("cannot mix positional \"?\" and named parameters in one expression")
+		}
+	}
+	lookup, keys, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, len(c.Params))
+	used := map[string]bool{}
+	perr := &ParamError{}
+	for i, p := range c.Params {
+		v, ok := lookup(p)
+		if !ok {
+			if !used[p] {
+				perr.Missing = append(perr.Missing, p)
+			}
+			used[p] = true
+			continue
+		}
+		used[p] = true
+		ret[i] = v
+	}
+	for _, k := range keys {
+		if !used[k] {
+			perr.Unused = append(perr.Unused, k)
+		}
+	}
+	if len(perr.Missing) > 0 || len(perr.Unused) > 0 {
+		return nil, perr
+	}
+	return ret, nil
+}
+
+// namedValues builds the lookup of parameter values from the arguments of Bind.
+// keys are the names which must all be used, nil when unused values are allowed (structs).
+func namedValues(args []interface{}) (func(name string) (interface{}, bool), []string, error) {
+	if len(args) == 0 {
+		return func(string) (interface{}, bool) { return nil, false }, nil, nil
+	}
+	if _, ok := args[0].(sql.NamedArg); ok {
+		values := map[string]interface{}{}
+		var keys []string
+		for _, a := range args {
+			na, ok := a.(sql.NamedArg)
+			if !ok {
+				return nil, nil, fmt.Errorf("named parameters: expected sql.NamedArg, got %T", a)
+			}
+			if _, dup := values[na.Name]; !dup {
+				keys = append(keys, na.Name)
+			}
+			values[na.Name] = na.Value
+		}
+		return func(name string) (interface{}, bool) {
+			v, ok := values[name]
+			return v, ok
+		}, keys, nil
+	}
+	if len(args) > 1 {
+		return nil, nil, fmt.Errorf("named parameters: expected a single map or struct, got %d values", len(args))
+	}
+	val := reflect.ValueOf(args[0])
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	switch {
+	case val.Kind() == reflect.Map && val.Type().Key().Kind() == reflect.String:
+		values := map[string]interface{}{}
+		keys := make([]string, 0, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			values[k] = iter.Value().Interface()
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return func(name string) (interface{}, bool) {
+			v, ok := values[name]
+			return v, ok
+		}, keys, nil
+	case val.Kind() == reflect.Struct:
+		return func(name string) (interface{}, bool) {
+			f := val.FieldByName(name)
+			if !f.IsValid() {
+				f = val.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, name) })
+			}
+			if !f.IsValid() || !f.CanInterface() {
+				return nil, false
+			}
+			return f.Interface(), true
+		}, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("named parameters: expected a map with string keys or a struct, got %T", args[0])
+	}
+}
@@ -13,7 +13,9 @@ type SimpleExprTree struct {
 	V  string            // Giá trị biểu thức (tối giản hoặc tên hàm nếu Nt là "func")
 	Op string            // Toán tử
 	Ns []*SimpleExprTree // Các nút con
-	Nt string            // Node type: "func", "param", "const", "field"
+	Nt string            // Node type: "func", "param", "const", "field", "column", "unary", "postfix", "list", "between", "cast", "json", "star", "raw" (sql đã render)
+	Lk string            // Literal kind khi Nt là "const": "int", "float", "bool", "null", "date", "timestamp", "string"
+	Tb string            // Bảng hoặc alias của cột khi Nt là "column" và câu truy vấn có join (rỗng nếu không cần)
 }
 
 func ParseExpr(expr string) (*SimpleExprTree, error) {
@@ -26,6 +28,31 @@ func ReconstructedSimpleExprTree(t *SimpleExprTree) string {
 func (t *SimpleExprTree) String() string {
 	return reconstructExpression(t)
 }
+
+// Clone tạo bản sao sâu của cây, dùng khi cần resolve một cây mà vẫn giữ cây gốc
+// (resolver thay đổi trực tiếp các nút)
+func (t *SimpleExprTree) Clone() *SimpleExprTree {
+	if t == nil {
+		return nil
+	}
+	ret := *t
+	if t.Ns != nil {
+		ret.Ns = make([]*SimpleExprTree, len(t.Ns))
+		for i, c := range t.Ns {
+			ret.Ns[i] = c.Clone()
+		}
+	}
+	return &ret
+}
+
+// ParamName trả về tên của tham số "@name" hoặc ":name" (không có tiền tố),
+// trả về "" nếu nút là tham số vị trí "?" hoặc không phải tham số
+func (t *SimpleExprTree) ParamName() string {
+	if t.Nt != "param" || len(t.V) < 2 || (t.V[0] != '@' && t.V[0] != ':') {
+		return ""
+	}
+	return t.V[1:]
+}
 func IsValidColumnName(name string) bool {
 	re := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 	return re.MatchString(name)
@@ -114,7 +141,7 @@ func resolve(node *SimpleExprTree, resolver func(node *SimpleExprTree) error) (s
 	}
 	//)
 	// Nếu là nút lá (không có Ns)
-	if len(node.Ns) == 0 {
+	if len(node.Ns) == 0 && node.Nt != "func" {
 		return node.V, nil
 	}
 
@@ -126,6 +153,42 @@ func resolve(node *SimpleExprTree, resolver func(node *SimpleExprTree) error) (s
 			return "", errOp
 		}
 		return "(" + subExpr + ")", nil
+	} else if node.Nt == "unary" || node.Nt == "postfix" {
+		// Toán tử một ngôi: "!x", "not x", "-x" hoặc "x is null"
+		operand, errOp := resolve(node.Ns[0], resolver)
+		if errOp != nil {
+			return "", errOp
+		}
+		return joinUnary(node, operand), nil
+	} else if node.Nt == "cast" {
+		// Ép kiểu: V là tên kiểu dữ liệu đích
+		operand, errOp := resolve(node.Ns[0], resolver)
+		if errOp != nil {
+			return "", errOp
+		}
+		return "CAST(" + operand + " AS " + node.V + ")", nil
+	} else if node.Nt == "json" {
+		// Truy cập json: data->'address'->>'city'
+		var parts []string
+		for _, child := range node.Ns {
+			part, errPart := resolve(child, resolver)
+			if errPart != nil {
+				return "", errPart
+			}
+			parts = append(parts, part)
+		}
+		return joinJSONPath(node, parts), nil
+	} else if node.Nt == "list" || node.Nt == "between" {
+		// Danh sách "(a, b)" của in hoặc "x between a and b"
+		var parts []string
+		for _, child := range node.Ns {
+			part, errPart := resolve(child, resolver)
+			if errPart != nil {
+				return "", errPart
+			}
+			parts = append(parts, part)
+		}
+		return joinSetOp(node, parts), nil
 	} else if node.Nt == "func" {
 		// Xử lý hàm: ghép tên hàm với các đối số
 		var args []string
@@ -152,325 +215,68 @@ func resolve(node *SimpleExprTree, resolver func(node *SimpleExprTree) error) (s
 	}
 }
 
-// parseToSimpleExprTree chuyển đổi biểu thức phức tạp thành cây SimpleExprTree
-func parseToSimpleExprTree(expr string) (*SimpleExprTree, error) {
-	if expr == "" {
-		return nil, fmt.Errorf("expression cannot be empty")
-	}
-
-	// Loại bỏ khoảng trắng thừa
-	expr = strings.TrimSpace(expr)
-
-	// Tạo nút gốc
-	root := &SimpleExprTree{V: expr}
-
-	// Kiểm tra nếu biểu thức đã tối giản
-	if isSimpleExpr(expr) {
-		setNodeType(root)
-		return root, nil
-	}
-
-	// Xử lý dấu ngoặc bao ngoài (hỗ trợ nhiều lớp ngoặc)
-	if strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
-		openCount := 0
-		matched := true
-		for i, char := range expr {
-			if char == '(' {
-				openCount++
-			} else if char == ')' {
-				openCount--
-			}
-			if openCount == 0 && i != len(expr)-1 {
-				matched = false
-				break
-			}
-		}
-		if matched && openCount == 0 {
-			// Phân tích nội dung bên trong
-			innerExpr := expr[1 : len(expr)-1]
-			innerNode, err := parseToSimpleExprTree(innerExpr)
-			if err != nil {
-				return nil, err
-			}
-			root.Op = "()"
-			root.Ns = append(root.Ns, innerNode)
-			return root, nil
-		}
+// joinUnary ghép toán tử một ngôi với toán hạng đã được tái tạo
+func joinUnary(node *SimpleExprTree, operand string) string {
+	if node.Nt == "postfix" {
+		return operand + " " + node.Op
 	}
-
-	// Tìm toán tử chính (ưu tiên thấp nhất: or, and, ==, like, v.v.)
-	op, opPos := findMainOperator(expr)
-	if op != "" {
-		root.Op = op
-		leftExpr := strings.TrimSpace(expr[:opPos])
-		rightExpr := strings.TrimSpace(expr[opPos+len(op):])
-
-		// Phân tích đệ quy cho các biểu thức con
-		if leftExpr != "" {
-			leftNode, err := parseToSimpleExprTree(leftExpr)
-			if err != nil {
-				return nil, err
-			}
-			root.Ns = append(root.Ns, leftNode)
-		}
-		if rightExpr != "" {
-			rightNode, err := parseToSimpleExprTree(rightExpr)
-			if err != nil {
-				return nil, err
-			}
-			root.Ns = append(root.Ns, rightNode)
-		}
-		return root, nil
+	last := node.Op[len(node.Op)-1]
+	if (last >= 'a' && last <= 'z') || (last >= 'A' && last <= 'Z') {
+		return node.Op + " " + operand
 	}
-
-	// Nếu là hàm, phân tích tham số
-	if isFunction(expr) {
-		funcNameEnd := strings.Index(expr, "(")
-		if funcNameEnd == -1 {
-			return nil, fmt.Errorf("invalid function format")
-		}
-		funcName := strings.TrimSpace(expr[:funcNameEnd])
-		funcNode := &SimpleExprTree{V: funcName, Nt: "func"}
-		args, err := parseFunctionArgs(expr)
-		if err != nil {
-			return nil, err
-		}
-		for _, arg := range args {
-			argNode, err := parseToSimpleExprTree(arg)
-			if err != nil {
-				return nil, err
-			}
-			funcNode.Ns = append(funcNode.Ns, argNode)
-		}
-		*root = *funcNode
-		return root, nil
+	if node.Op == "-" && strings.HasPrefix(operand, "-") {
+		// "--" là chú thích trong sql
+		return node.Op + " " + operand
 	}
-
-	return root, nil
+	return node.Op + operand
 }
 
-// parseFunctionArgs tách các tham số của hàm
-func parseFunctionArgs(expr string) ([]string, error) {
-	var args []string
-	if !strings.Contains(expr, "(") || !strings.Contains(expr, ")") {
-		return nil, fmt.Errorf("invalid function format")
-	}
-
-	start := strings.Index(expr, "(") + 1
-	end := strings.LastIndex(expr, ")")
-	if start >= end {
-		return nil, fmt.Errorf("invalid parentheses")
-	}
-
-	argStr := expr[start:end]
-	parenDepth := 0
-	currentArg := ""
-	inQuotes := false
-
-	for i := 0; i < len(argStr); i++ {
-		char := argStr[i]
-		if char == '\'' {
-			inQuotes = !inQuotes
-		} else if char == '(' && !inQuotes {
-			parenDepth++
-		} else if char == ')' && !inQuotes {
-			parenDepth--
-		} else if char == ',' && parenDepth == 0 && !inQuotes {
-			args = append(args, strings.TrimSpace(currentArg))
-			currentArg = ""
-			continue
+// joinJSONPath ghép giá trị json parts[0] với các key, key cuối dùng "->>" nếu Op là "->>"
+func joinJSONPath(node *SimpleExprTree, parts []string) string {
+	var sb strings.Builder
+	sb.WriteString(parts[0])
+	for i, key := range parts[1:] {
+		if i == len(parts)-2 && node.Op == "->>" {
+			sb.WriteString("->>")
+		} else {
+			sb.WriteString("->")
 		}
-		currentArg += string(char)
-	}
-
-	if currentArg != "" {
-		args = append(args, strings.TrimSpace(currentArg))
-	}
-
-	return args, nil
-}
-
-// isSimpleExpr kiểm tra xem biểu thức có phải là tối giản không
-func isSimpleExpr(expr string) bool {
-	// 1. Tham số
-	if expr == "?" {
-		return true
-	}
-	// 2. Hằng số
-	if isConstant(expr) {
-		return true
-	}
-	// 3. Đối số (Field)
-	if isOperand(expr) {
-		return true
-	}
-	return false
-}
-
-// setNodeType đặt loại nút dựa trên giá trị
-func setNodeType(node *SimpleExprTree) {
-	if node.V == "?" {
-		node.Nt = "param"
-	} else if isConstant(node.V) {
-		node.Nt = "const"
-	} else if isOperand(node.V) {
-		node.Nt = "field" // Đối số đơn giản xem như field
+		sb.WriteString(key)
 	}
+	return sb.String()
 }
 
-// findMainOperator tìm toán tử chính (ưu tiên thấp nhất) trong biểu thức
-func findMainOperator(expr string) (string, int) {
-	parenDepth := 0
-	inQuotes := false
-	lowestPrecedence := 999
-	opPos := -1
-	op := ""
-
-	i := 0
-	for i < len(expr) {
-		char := expr[i]
-
-		if char == '\'' {
-			inQuotes = !inQuotes
-		} else if char == '(' {
-			parenDepth++
-		} else if char == ')' {
-			parenDepth--
-		} else if !inQuotes && parenDepth == 0 {
-			// Kiểm tra các toán tử
-			if strings.HasPrefix(expr[i:], "||") || strings.HasPrefix(expr[i:], "or") {
-				precedence := 1
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					if strings.HasPrefix(expr[i:], "||") {
-						op = "||"
-					} else {
-						op = "or"
-					}
-					opPos = i
-				}
-				i += len(op) - 1
-			} else if strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "and") {
-				precedence := 2
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					if strings.HasPrefix(expr[i:], "&&") {
-						op = "&&"
-					} else {
-						op = "and"
-					}
-					opPos = i
-				}
-				i += len(op) - 1
-			} else if strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "=") {
-				precedence := 3
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					if strings.HasPrefix(expr[i:], "==") {
-						op = "=="
-					} else {
-						op = "="
-					}
-					opPos = i
-				}
-				i += len(op) - 1
-			} else if strings.HasPrefix(expr[i:], "<=") || strings.HasPrefix(expr[i:], ">=") {
-				precedence := 3
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					op = expr[i : i+2]
-					opPos = i
-				}
-				i += 1
-			} else if strings.HasPrefix(expr[i:], "like") {
-				precedence := 3
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					op = "like"
-					opPos = i
-				}
-				i += 3
-			} else if char == '<' || char == '>' {
-				precedence := 3
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					op = string(char)
-					opPos = i
-				}
-			} else if char == '+' || char == '-' {
-				precedence := 4
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					op = string(char)
-					opPos = i
-				}
-			} else if char == '*' || char == '/' || char == '%' || char == '^' {
-				precedence := 5
-				if precedence < lowestPrecedence {
-					lowestPrecedence = precedence
-					op = string(char)
-					opPos = i
-				}
+// formatJSONPath viết lại nút "json" theo cú pháp của biểu thức:
+// Data.address.city nếu được, ngược lại json(Data, 'tags')
+func formatJSONPath(node *SimpleExprTree, parts []string) string {
+	if node.Op == "->>" {
+		keys := []string{parts[0]}
+		for _, key := range node.Ns[1:] {
+			text, err := key.LiteralText()
+			if key.Lk != "string" || err != nil || !IsValidColumnName(text) {
+				keys = nil
+				break
 			}
+			keys = append(keys, text)
 		}
-		i++
-	}
-
-	return op, opPos
-}
-
-// hasOuterParentheses kiểm tra xem biểu thức có dấu ngoặc bao ngoài không
-func hasOuterParentheses(expr string) bool {
-	if !strings.HasPrefix(expr, "(") || !strings.HasSuffix(expr, ")") {
-		return false
-	}
-	openCount := 0
-	for i, char := range expr {
-		if char == '(' {
-			openCount++
-		} else if char == ')' {
-			openCount--
-		}
-		if openCount == 0 && i != len(expr)-1 {
-			return false
+		if keys != nil {
+			return strings.Join(keys, ".")
 		}
 	}
-	return true
-}
-
-// isConstant kiểm tra xem biểu thức có phải là hằng số không
-func isConstant(expr string) bool {
-	// Hằng số số
-	if _, err := fmt.Sscanf(expr, "%d", new(int)); err == nil {
-		return true
-	}
-	// Hằng số chuỗi (bao trong dấu nháy đơn, hỗ trợ thoát '' cho ')
-	if strings.HasPrefix(expr, "'") && strings.HasSuffix(expr, "'") {
-		expr = expr[1 : len(expr)-1] // Loại bỏ dấu nháy ngoài
-		return strings.Count(expr, "''") > 0 || !strings.ContainsAny(expr, "()+-*/=<>!&|,")
-	}
-	return false
+	return "json(" + strings.Join(parts, ", ") + ")"
 }
 
-// isFunction kiểm tra xem biểu thức có phải là hàm không
-func isFunction(expr string) bool {
-	// Hàm phải có dạng tên hàm + dấu ngoặc, ví dụ: concat(...)
-	if !strings.Contains(expr, "(") || !strings.Contains(expr, ")") {
-		return false
+// joinSetOp ghép các phần đã tái tạo của nút "list" hoặc "between"
+func joinSetOp(node *SimpleExprTree, parts []string) string {
+	if node.Nt == "list" {
+		return "(" + strings.Join(parts, ", ") + ")"
 	}
-	parenDepth := 0
-	for i, char := range expr {
-		if char == '(' {
-			parenDepth++
-			if parenDepth == 1 {
-				funcName := expr[:i]
-				return isOperand(funcName)
-			}
-		} else if char == ')' {
-			parenDepth--
-		}
+	// Giữ kiểu chữ của "and" theo toán tử (between hoặc BETWEEN)
+	and := " and "
+	if node.Op != strings.ToLower(node.Op) {
+		and = " AND "
 	}
-	return false
+	return parts[0] + " " + node.Op + " " + parts[1] + and + parts[2]
 }
 
 // isOperand kiểm tra xem chuỗi có phải là toán hạng không
@@ -501,7 +307,7 @@ func reconstructExpression(node *SimpleExprTree) string {
 	}
 
 	// Nếu là nút lá (không có Ns)
-	if len(node.Ns) == 0 {
+	if len(node.Ns) == 0 && node.Nt != "func" {
 		return node.V
 	}
 
@@ -510,6 +316,22 @@ func reconstructExpression(node *SimpleExprTree) string {
 		// Nếu là biểu thức trong ngoặc, thêm ngoặc bao quanh
 		subExpr := reconstructExpression(node.Ns[0])
 		return "(" + subExpr + ")"
+	} else if node.Nt == "unary" || node.Nt == "postfix" {
+		return joinUnary(node, reconstructExpression(node.Ns[0]))
+	} else if node.Nt == "cast" {
+		return "CAST(" + reconstructExpression(node.Ns[0]) + " AS " + node.V + ")"
+	} else if node.Nt == "json" {
+		var parts []string
+		for _, child := range node.Ns {
+			parts = append(parts, reconstructExpression(child))
+		}
+		return formatJSONPath(node, parts)
+	} else if node.Nt == "list" || node.Nt == "between" {
+		var parts []string
+		for _, child := range node.Ns {
+			parts = append(parts, reconstructExpression(child))
+		}
+		return joinSetOp(node, parts)
 	} else if node.Nt == "func" {
 		// Xử lý hàm: ghép tên hàm với các đối số
 		var args []string
@@ -534,12 +356,28 @@ func reconstructExpressionSimple(node *SimpleExprTree) string {
 	}
 
 	// Nếu là nút lá (không có Ns)
-	if len(node.Ns) == 0 {
+	if len(node.Ns) == 0 && node.Nt != "func" {
 		return node.V
 	}
 
 	// Xử lý dựa trên toán tử
-	if node.Nt == "func" {
+	if node.Nt == "unary" || node.Nt == "postfix" {
+		return joinUnary(node, reconstructExpressionSimple(node.Ns[0]))
+	} else if node.Nt == "cast" {
+		return "CAST(" + reconstructExpressionSimple(node.Ns[0]) + " AS " + node.V + ")"
+	} else if node.Nt == "json" {
+		var parts []string
+		for _, child := range node.Ns {
+			parts = append(parts, reconstructExpressionSimple(child))
+		}
+		return formatJSONPath(node, parts)
+	} else if node.Nt == "list" || node.Nt == "between" {
+		var parts []string
+		for _, child := range node.Ns {
+			parts = append(parts, reconstructExpressionSimple(child))
+		}
+		return joinSetOp(node, parts)
+	} else if node.Nt == "func" {
 		// Xử lý hàm: ghép tên hàm với các đối số
 		var args []string
 		for _, child := range node.Ns {
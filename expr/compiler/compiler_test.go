@@ -1,8 +1,11 @@
 package compiler_test
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/nttlong/regorm/expr/compiler"
 
@@ -17,6 +20,22 @@ var testList []string = []string{
 	"(Code123==? and Price<=?) or len(name)==?->(Code123 == ? and Price <= ?) or len(name) == ?",
 	"max(salary, bonus)^2<=BasicSalary->max(salary, bonus) ^ 2 <= BasicSalary",
 	"(concat(firstName,' ', lastName)) like '%?%'->(concat(firstName, ' ', lastName)) like '%?%'",
+	"Order==? or Brand like ?->Order == ? or Brand like ?",
+	"Unlikely==? AND Android==?->Unlikely == ? and Android == ?",
+	"Name=='a or b, (c)'->Name == 'a or b, (c)'",
+	"Name=='it''s'->Name == 'it''s'",
+	"now()->now()",
+	"!Deleted && Code!=?->!Deleted && Code != ?",
+	"not (a==b) or c<>d->not (a == b) or c <> d",
+	"Manager is null and Code IS NOT NULL->Manager is null and Code is not null",
+	"-Price+(-2)*Qty->-Price + (-2) * Qty",
+	"Status in ? and Code not in (?,?)->Status in ? and Code not in (?, ?)",
+	"Price between ?+1 and ? and Qty not between 1 and 10->Price between ? + 1 and ? and Qty not between 1 and 10",
+	"Name not like ?->Name not like ?",
+	"Price>=1.5e-3 and Qty>-2 and Rate<-0.5->Price >= 1.5e-3 and Qty > -2 and Rate < -0.5",
+	"Active==TRUE and Deleted==false or Note==NULL->Active == true and Deleted == false or Note == null",
+	"CreatedOn>=date '2024-01-31' and CreatedOn<TIMESTAMP '2024-02-01T10:30:00'->CreatedOn >= date '2024-01-31' and CreatedOn < timestamp '2024-02-01T10:30:00'",
+	"Note=='(a+b)=c, ''x''!'->Note == '(a+b)=c, ''x''!'",
 }
 
 func TestTree(t *testing.T) {
@@ -43,3 +62,482 @@ func TestTree(t *testing.T) {
 		assert.Equal(t, Output, r)
 	}
 }
+
+func TestTokenize(t *testing.T) {
+	tokens, err := compiler.Tokenize("Order == 'x' and len(Brand)>=?")
+	assert.NoError(t, err)
+	kinds := []compiler.TokenKind{
+		compiler.TokIdent, compiler.TokOp, compiler.TokString, compiler.TokKeyword,
+		compiler.TokIdent, compiler.TokLParen, compiler.TokIdent, compiler.TokRParen,
+		compiler.TokOp, compiler.TokParam, compiler.TokEOF,
+	}
+	assert.Equal(t, len(kinds), len(tokens))
+	for i, k := range kinds {
+		assert.Equal(t, k, tokens[i].Kind, tokens[i].Text)
+	}
+	assert.Equal(t, 9, tokens[2].Pos)
+	assert.Equal(t, "'x'", tokens[2].Text)
+
+	_, err = compiler.Tokenize("Name == 'abc")
+	assert.Error(t, err)
+}
+
+func TestNamedParam(t *testing.T) {
+	fx, err := compiler.ParseExpr("Code == @code or Name like :name_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "param", fx.Ns[0].Ns[1].Nt)
+	assert.Equal(t, "code", fx.Ns[0].Ns[1].ParamName())
+	assert.Equal(t, "name_1", fx.Ns[1].Ns[1].ParamName())
+	assert.Equal(t, "Code == @code or Name like :name_1", fx.String())
+
+	fx, err = compiler.ParseExpr("Code == ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "", fx.Ns[1].ParamName())
+
+	for _, input := range []string{"Code == @", "Code == : and x", "Code == @1"} {
+		_, err = compiler.ParseExpr(input)
+		var perr *compiler.ParseError
+		assert.ErrorAs(t, err, &perr, input)
+	}
+}
+
+func TestLeftAssociative(t *testing.T) {
+	fx, err := compiler.ParseExpr("a - b - c")
+	assert.NoError(t, err)
+	assert.Equal(t, "-", fx.Op)
+	assert.Equal(t, "a - b", fx.Ns[0].V)
+	assert.Equal(t, "c", fx.Ns[1].V)
+
+	fx, err = compiler.ParseExpr("a or b and c")
+	assert.NoError(t, err)
+	assert.Equal(t, "or", fx.Op)
+	assert.Equal(t, "and", fx.Ns[1].Op)
+}
+
+func TestUnaryPrecedence(t *testing.T) {
+	fx, err := compiler.ParseExpr("not a == b and c is not null")
+	assert.NoError(t, err)
+	assert.Equal(t, "and", fx.Op)
+	assert.Equal(t, "unary", fx.Ns[0].Nt)
+	assert.Equal(t, "==", fx.Ns[0].Ns[0].Op)
+	assert.Equal(t, "postfix", fx.Ns[1].Nt)
+	assert.Equal(t, "is not null", fx.Ns[1].Op)
+}
+
+func TestNegativeNumber(t *testing.T) {
+	// "--" là chú thích trong sql, phần sau của điều kiện sẽ bị bỏ qua
+	fx, err := compiler.ParseExpr("A == - -1 and B == 2")
+	assert.NoError(t, err)
+	assert.Equal(t, "const", fx.Ns[0].Ns[1].Nt)
+	assert.Equal(t, "1", fx.Ns[0].Ns[1].V)
+	assert.Equal(t, "A == 1 and B == 2", compiler.ReconstructedSimpleExprTree(fx))
+
+	fx, err = compiler.ParseExpr("A == -(-1) and B == 2")
+	assert.NoError(t, err)
+	assert.NotContains(t, compiler.ReconstructedSimpleExprTree(fx), "--")
+	assert.NotContains(t, fx.String(), "--")
+}
+
+func TestMalformedNumber(t *testing.T) {
+	for _, s := range []string{"Price == 1.5.3", "Price == 1e5e3", "Price == 1.5e", "Price == 1e5.3", "Price == 1.e+5.2"} {
+		_, err := compiler.ParseExpr(s)
+		var pe *compiler.ParseError
+		if assert.ErrorAs(t, err, &pe, s) {
+			assert.Equal(t, 9, pe.Pos, s)
+		}
+	}
+	for _, s := range []string{"Price == 1.5", "Price == 1e5", "Price == 2.5E+3", "Price == 1m2"} {
+		_, err := compiler.ParseExpr(s)
+		assert.NoError(t, err, s)
+	}
+}
+
+func TestSetOperators(t *testing.T) {
+	fx, err := compiler.ParseExpr("Price between ? and ? and Code in (?, ?)")
+	assert.NoError(t, err)
+	assert.Equal(t, "and", fx.Op)
+	assert.Equal(t, "between", fx.Ns[0].Nt)
+	assert.Equal(t, 3, len(fx.Ns[0].Ns))
+	assert.Equal(t, "in", fx.Ns[1].Op)
+	assert.Equal(t, "list", fx.Ns[1].Ns[1].Nt)
+	assert.Equal(t, 2, len(fx.Ns[1].Ns[1].Ns))
+}
+
+func TestLiteralKind(t *testing.T) {
+	data := map[string]interface{}{
+		"12":                              int64(12),
+		"-12":                             int64(-12),
+		"1.25":                            1.25,
+		"-2e3":                            -2000.0,
+		"true":                            true,
+		"False":                           false,
+		"null":                            nil,
+		"'it''s'":                         "it's",
+		"date '2024-01-31'":               time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		"timestamp '2024-01-31 10:20:30'": time.Date(2024, 1, 31, 10, 20, 30, 0, time.UTC),
+	}
+	for input, expected := range data {
+		fx, err := compiler.ParseExpr(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, "const", fx.Nt, input)
+		v, err := fx.LiteralValue()
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, v, input)
+	}
+	fx, err := compiler.ParseExpr("1m2")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "const", fx.Nt)
+	fx, err = compiler.ParseExpr("Date")
+	assert.NoError(t, err)
+	assert.Equal(t, "field", fx.Nt)
+}
+
+func TestParseError(t *testing.T) {
+	for _, s := range []string{"", "a ==", "(a == b", "len(a,", "a b", "a == ,", "a is", "a is not b", "!",
+		"a in ()", "a between 1", "a between 1 or 2", "a not b", "a == date '2024-13-01'", "timestamp 'x'"} {
+		_, err := compiler.ParseExpr(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseErrorDetail(t *testing.T) {
+	_, err := compiler.ParseExpr("Code == and Name")
+	var pe *compiler.ParseError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, 8, pe.Pos)
+	assert.Equal(t, "and", pe.Token)
+	assert.Equal(t, "operand", pe.Expected)
+	assert.Equal(t, "unexpected keyword 'and' at position 8, expected operand", pe.Error())
+	assert.Equal(t, "Code == and Name\n        ^", pe.Caret())
+
+	_, err = compiler.ParseExpr("len(Name == 'x'")
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, 15, pe.Pos)
+	assert.Equal(t, "", pe.Token)
+	assert.Equal(t, "',' or ')' in call to len", pe.Expected)
+
+	_, err = compiler.ParseExpr("Name == 'Tên' and")
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, 18, pe.Pos)
+	assert.Equal(t, "Name == 'Tên' and\n                 ^", pe.Caret())
+
+	_, err = compiler.ParseExpr("Tên == ?")
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "ê", pe.Token)
+}
+
+type evalEmp struct {
+	Code      string
+	Name      *string
+	Age       int
+	Salary    float64
+	CreatedOn time.Time
+	Active    bool
+}
+
+func TestEval(t *testing.T) {
+	emp := evalEmp{
+		Code:      "E01",
+		Age:       30,
+		Salary:    1500.5,
+		CreatedOn: time.Date(2024, 3, 15, 10, 20, 30, 0, time.UTC),
+		Active:    true,
+	}
+	data := []string{
+		"Code == 'E01'->true",
+		"code == 'E01'->true",
+		"Age > 18 and Age <= 30->true",
+		"Age + 2 * 5->40",
+		"Age / 4->7",
+		"Age / 4.0->7.5",
+		"Age % 7->2",
+		"-Age->-30",
+		"2 ^ 3->8",
+		"Salary >= 1500->true",
+		"Name is null->true",
+		"Name == null->true",
+		"Name == 'x'-><nil>",
+		"Name == 'x' or Active->true",
+		"Name == 'x' and Active-><nil>",
+		"not (Age < 18)->true",
+		"!Active->false",
+		"Code like 'E%'->true",
+		"Code like 'e%'->false",
+		"Code not like 'E_1'->false",
+		"Age in (1, 30, 5)->true",
+		"Age not in (1, 2)->true",
+		"Age between 18 and 30->true",
+		"Age not between 18 and 30->false",
+		"year(CreatedOn) == 2024 and month(CreatedOn) == 3->true",
+		"day(CreatedOn) + hour(CreatedOn) + minute(CreatedOn) + second(CreatedOn)->75",
+		"CreatedOn >= date '2024-03-15'->true",
+		"CreatedOn < timestamp '2024-03-15 10:00:00'->false",
+		"len(lower(Code))->3",
+		"concat(Code, '-', Age, Name)->E01-30",
+		"coalesce(Name, Code)->E01",
+		"substring(Code, 2)->01",
+		"substring(upper(trim(' abc ')), 2, 1)->B",
+		"round(Salary)->1501",
+		"round(2.345, 2)->2.35",
+		"abs(-Age)->30",
+		"Code ilike 'e%'->true",
+		"Code not ilike 'e%'->false",
+		"search('The quick brown fox', 'QUICK fox')->true",
+		"search('The quick brown fox', 'quick cat')->false",
+		"similar('Nguyen Van A', 'nguyen van')->true",
+		"similar('Nguyen Van A', 'Tran')->false",
+	}
+	for _, test := range data {
+		input := strings.Split(test, "->")[0]
+		output := strings.Split(test, "->")[1]
+		fx, err := compiler.ParseExpr(input)
+		assert.NoError(t, err, input)
+		r, err := compiler.Eval(fx, &emp)
+		assert.NoError(t, err, input)
+		assert.Equal(t, output, fmt.Sprint(r), input)
+	}
+
+	row := map[string]interface{}{"Code": "E02", "age": int32(40)}
+	fx, _ := compiler.ParseExpr("Code == ? && Age in ?")
+	ok, err := compiler.EvalBool(fx, row, "E02", []int{40, 50})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	fx, _ = compiler.ParseExpr("Code == @code or Age > @code_len")
+	ok, err = compiler.EvalBool(fx, row, map[string]interface{}{"code": "x", "code_len": 39})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	fx, _ = compiler.ParseExpr("Name == 'x'")
+	ok, err = compiler.EvalBool(fx, &emp)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, input := range []string{"Missing == 1", "Code == ?", "Code > 1", "foo(Code)", "Age / 0", "Age"} {
+		fx, err := compiler.ParseExpr(input)
+		assert.NoError(t, err, input)
+		_, err = compiler.EvalBool(fx, &emp)
+		assert.Error(t, err, input)
+	}
+}
+
+type evalDept struct {
+	Name string
+	Emps []*evalEmp
+	Head *evalEmp
+}
+
+func TestEvalQuantifier(t *testing.T) {
+	dept := evalDept{
+		Name: "IT",
+		Emps: []*evalEmp{{Code: "E01", Age: 30}, {Code: "E02", Age: 45}},
+		Head: &evalEmp{Code: "E01", Age: 30},
+	}
+	data := []string{
+		"any(Emps)->true",
+		"any(Emps, Age > 40)->true",
+		"all(Emps, Age > 40)->false",
+		"all(Emps, Age >= 30)->true",
+		"none(Emps, Code == 'E03')->true",
+		"all(Emps, Name == 'x')->false",
+		"any(Head, Code == 'E01')->true",
+		"Name == 'IT' and any(Emps, Code like ? and Age > ?)->true",
+	}
+	for _, test := range data {
+		input := strings.Split(test, "->")[0]
+		output := strings.Split(test, "->")[1]
+		fx, err := compiler.ParseExpr(input)
+		assert.NoError(t, err, input)
+		var params []interface{}
+		if strings.Contains(input, "?") {
+			params = []interface{}{"E%", 40}
+		}
+		r, err := compiler.Eval(fx, &dept, params...)
+		assert.NoError(t, err, input)
+		assert.Equal(t, output, fmt.Sprint(r), input)
+	}
+
+	empty := evalDept{}
+	for _, test := range []string{"any(Emps)->false", "all(Emps, Age > 1)->true", "none(Emps)->true", "any(Head)->false"} {
+		fx, _ := compiler.ParseExpr(strings.Split(test, "->")[0])
+		r, err := compiler.Eval(fx, &empty)
+		assert.NoError(t, err, test)
+		assert.Equal(t, strings.Split(test, "->")[1], fmt.Sprint(r), test)
+	}
+	for _, input := range []string{"all(Emps)", "any(Missing)", "any(Emps, Age)"} {
+		fx, _ := compiler.ParseExpr(input)
+		_, err := compiler.Eval(fx, &dept)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	for _, input := range []string{"Data.address.city == ?", "json(Data, 'tags') ? 'vip'", "json(Data, 'a b', 1) ? 'x' and Code == ?"} {
+		fx, err := compiler.ParseExpr(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, input, fx.String())
+	}
+	fx, err := compiler.ParseExpr("Data.address.city == ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "json", fx.Ns[0].Nt)
+	r, err := compiler.Resolve(fx, func(n *compiler.SimpleExprTree) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "Data->'address'->>'city' == ?", r)
+
+	row := map[string]interface{}{
+		"Code": "E01",
+		"Data": `{"address": {"city": "HCM"}, "age": 31, "tags": ["vip", "new"]}`,
+		"Meta": map[string]interface{}{"level": "2"},
+	}
+	data := []string{
+		"Data.address.city == 'HCM'->true",
+		"Data.age > 30->true",
+		"Data.missing.key is null->true",
+		"json(Data, 'tags') ? 'vip'->true",
+		"json(Data, 'address') ? 'zip'->false",
+		"json(Data, 'tags', 1) == 'new'->true",
+		"cast(Meta.level, 'integer') + 1->3",
+	}
+	for _, test := range data {
+		input := strings.Split(test, "->")[0]
+		output := strings.Split(test, "->")[1]
+		fx, err := compiler.ParseExpr(input)
+		assert.NoError(t, err, input)
+		r, err := compiler.Eval(fx, row)
+		assert.NoError(t, err, input)
+		assert.Equal(t, output, fmt.Sprint(r), input)
+	}
+}
+
+func TestParseOrderBy(t *testing.T) {
+	items, err := compiler.ParseOrderBy("CreatedOn desc, len(Name) ASC, Code")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, "CreatedOn", items[0].Expr.String())
+	assert.True(t, items[0].Desc)
+	assert.Equal(t, "len(Name)", items[1].Expr.String())
+	assert.False(t, items[1].Desc)
+	assert.False(t, items[2].Desc)
+
+	for _, input := range []string{"", "Code desc desc", "Code, ", "Code == ?", "@sort", "Code; drop table x"} {
+		_, err := compiler.ParseOrderBy(input)
+		var perr *compiler.ParseError
+		assert.ErrorAs(t, err, &perr, input)
+	}
+}
+
+func TestParseSelectList(t *testing.T) {
+	items, err := compiler.ParseSelectList("ID, Name full_name, year(CreatedOn) as Year")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, "", items[0].Alias)
+	assert.Equal(t, "full_name", items[1].Alias)
+	assert.Equal(t, "year(CreatedOn)", items[2].Expr.String())
+	assert.Equal(t, "Year", items[2].Alias)
+
+	for _, input := range []string{"ID as", "ID as 'x'", "Name, ?", "ID as Data.x"} {
+		_, err := compiler.ParseSelectList(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCountStar(t *testing.T) {
+	fx, err := compiler.ParseExpr("count(*) > 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "star", fx.Ns[0].Ns[0].Nt)
+	assert.Equal(t, "count(*) > 1", fx.String())
+	_, err = compiler.ParseExpr("sum(*)")
+	assert.Error(t, err)
+
+	items := []compiler.SelectItem{{Expr: fx.Ns[0], Alias: "N"}}
+	having, err := compiler.ParseExpr("n > 2 and Code == ?")
+	assert.NoError(t, err)
+	having = compiler.ReplaceAliases(having, items)
+	assert.Equal(t, "count(*) > 2 and Code == ?", having.String())
+	assert.NotSame(t, fx.Ns[0], having.Ns[0].Ns[0])
+}
+
+func TestOptimize(t *testing.T) {
+	data := []string{
+		"year(CreatedOn) == 2024->CreatedOn >= timestamp '2024-01-01 00:00:00' && CreatedOn < timestamp '2025-01-01 00:00:00'",
+		"year(CreatedOn) != 2024->CreatedOn < timestamp '2024-01-01 00:00:00' || CreatedOn >= timestamp '2025-01-01 00:00:00'",
+		"year(CreatedOn) != 2024 and Age > 1->(CreatedOn < timestamp '2024-01-01 00:00:00' || CreatedOn >= timestamp '2025-01-01 00:00:00') and Age > 1",
+		"2024 < year(CreatedOn)->CreatedOn >= timestamp '2025-01-01 00:00:00'",
+		"year(CreatedOn) <= 2024->CreatedOn < timestamp '2025-01-01 00:00:00'",
+		"year(CreatedOn) between 2020 and 2024->CreatedOn >= timestamp '2020-01-01 00:00:00' && CreatedOn < timestamp '2025-01-01 00:00:00'",
+		"year(CreatedOn) == ?->CreatedOn >= make_date(?, 1, 1) && CreatedOn < make_date(? + 1, 1, 1)",
+		"(year(CreatedOn) == 2024) && (month(CreatedOn) == 2) && Code == ?->CreatedOn >= timestamp '2024-02-01 00:00:00' && CreatedOn < timestamp '2024-03-01 00:00:00' && Code == ?",
+		"year(CreatedOn) == 2024 and month(CreatedOn) == 2 and day(CreatedOn) == 29->CreatedOn >= timestamp '2024-02-29 00:00:00' && CreatedOn < timestamp '2024-03-01 00:00:00'",
+		// 30/02 does not exist, only the year becomes a range
+		"year(CreatedOn) == 2024 and month(CreatedOn) == 2 and day(CreatedOn) == 30->CreatedOn >= timestamp '2024-01-01 00:00:00' && CreatedOn < timestamp '2025-01-01 00:00:00' and month(CreatedOn) == 2 and day(CreatedOn) == 30",
+		"month(CreatedOn) == ?->month(CreatedOn) == ?",
+		"year(len(Code)) == 2024->year(len(Code)) == 2024",
+		"Age > 2 * 3 + 1 and true->Age > 7",
+		"Age > 1 or 1 == 2->Age > 1",
+		// decimals are not folded as float64, 0.1 + 0.2 is exact in numeric
+		"Age / 2 > 1.5 * 2->Age / 2 > 1.5 * 2",
+		"Price == 0.1 + 0.2->Price == 0.1 + 0.2",
+		"Age > 9223372036854775807 + 1->Age > 9223372036854775807 + 1",
+		"Age > -9223372036854775807 - 2->Age > -9223372036854775807 - 2",
+		"Age > (-2) * 3->Age > -6",
+		// a branch with a parameter is never dropped, the caller still passes its value
+		"1 == 1 or Secret == ?->true or Secret == ?",
+		"Secret == @s and 1 == 2->Secret == @s and false",
+		"1 == 1 or Age > 1->true",
+		"Age == -(-1) and Code == 2->Age == -(-1) and Code == 2",
+		"Age == -(-Age) and Code == 2->Age == -(-Age) and Code == 2",
+		"Age - (-1) > 0->Age - -1 > 0",
+		"((Age + 1)) * 2 > (Age)->(Age + 1) * 2 > Age",
+		"(Age * 2) + 1 > 0 and (Code == ? or Name == ?)->Age * 2 + 1 > 0 and (Code == ? or Name == ?)",
+		"Code == ? or (Name == ? and Age > 1)->Code == ? or (Name == ? and Age > 1)",
+		"(Age * 2) ^ 2 > 1 and (Age == 1) is null->(Age * 2) ^ 2 > 1 and (Age == 1) is null",
+		"Age - (Age - 1) > 0->Age - (Age - 1) > 0",
+	}
+	for _, item := range data {
+		parts := strings.Split(item, "->")
+		tree, err := compiler.ParseExpr(parts[0])
+		assert.NoError(t, err, parts[0])
+		before := tree.String()
+		assert.Equal(t, parts[1], compiler.Optimize(tree).String(), parts[0])
+		// the input tree is not modified
+		assert.Equal(t, before, tree.String())
+	}
+}
+
+func TestOptimizeEval(t *testing.T) {
+	conds := []string{
+		"year(CreatedOn) == 2024",
+		"year(CreatedOn) != 2024",
+		"year(CreatedOn) > 2023",
+		"year(CreatedOn) < 2025",
+		"year(CreatedOn) not between 2020 and 2023",
+		"year(CreatedOn) == 2024 and month(CreatedOn) == 3 and day(CreatedOn) == 15",
+		"year(CreatedOn) == ?",
+		"year(CreatedOn) >= ?",
+	}
+	times := []time.Time{
+		time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 15, 10, 20, 30, 0, time.UTC),
+		time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, cond := range conds {
+		tree, err := compiler.ParseExpr(cond)
+		assert.NoError(t, err)
+		optimized := compiler.Optimize(tree)
+		var params []interface{}
+		if strings.Contains(cond, "?") {
+			// the "?" used twice by the range takes one value
+			params = []interface{}{int64(2024)}
+		}
+		for _, tm := range times {
+			emp := evalEmp{CreatedOn: tm}
+			want, err := compiler.EvalBool(tree, emp, params...)
+			assert.NoError(t, err)
+			got, err := compiler.EvalBool(optimized, emp, params...)
+			assert.NoError(t, err, optimized.String())
+			assert.Equal(t, want, got, "%s at %s", cond, tm)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError là lỗi khi phân tích biểu thức, cho biết vị trí, token gây lỗi và điều được mong đợi
+type ParseError struct {
+	Expr     string `json:"expr"`     // Biểu thức gốc
+	Pos      int    `json:"pos"`      // Vị trí byte của lỗi trong Expr
+	Token    string `json:"token"`    // Token gây lỗi, rỗng nếu đã hết biểu thức
+	Expected string `json:"expected"` // Điều được mong đợi tại vị trí lỗi, ví dụ "')'"
+	Msg      string `json:"message"`  // Mô tả lỗi
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+	if e.Expected != "" {
+		msg += ", expected " + e.Expected
+	}
+	return msg
+}
+
+// Caret trả về biểu thức gốc và một dòng có dấu ^ chỉ vào vị trí lỗi, ví dụ:
+//
+//	Code == and Name
+//	        ^
+func (e *ParseError) Caret() string {
+	pos := e.Pos
+	if pos > len(e.Expr) {
+		pos = len(e.Expr)
+	}
+	var pad strings.Builder
+	for _, r := range e.Expr[:pos] {
+		// giữ tab để dấu ^ thẳng hàng
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	if utf8.ValidString(e.Expr[:pos]) {
+		return e.Expr + "\n" + pad.String() + "^"
+	}
+	return e.Expr + "\n" + strings.Repeat(" ", pos) + "^"
+}
+
+// newParseError tạo ParseError tại token tok
+func newParseError(expr string, tok Token, expected string, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Expr:     expr,
+		Pos:      tok.Pos,
+		Token:    tok.Text,
+		Expected: expected,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// unexpectedToken tạo lỗi "unexpected ..." cho token tok
+func unexpectedToken(expr string, tok Token, expected string) *ParseError {
+	if tok.Kind == TokEOF {
+		return newParseError(expr, tok, expected, "unexpected end of expression")
+	}
+	return newParseError(expr, tok, expected, "unexpected %s '%s'", tok.Kind, tok.Text)
+}
@@ -0,0 +1,1119 @@
+package compiler
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EvalFunc là hàm dùng khi tính biểu thức trong bộ nhớ, args đã được chuẩn hoá
+// (int64, float64, string, bool, time.Time hoặc nil)
+type EvalFunc func(args []interface{}) (interface{}, error)
+
+var (
+	evalFuncsLock sync.RWMutex
+	evalFuncs     = map[string]EvalFunc{
+		"year":      timePart(func(t time.Time) int { return t.Year() }),
+		"month":     timePart(func(t time.Time) int { return int(t.Month()) }),
+		"day":       timePart(func(t time.Time) int { return t.Day() }),
+		"hour":      timePart(func(t time.Time) int { return t.Hour() }),
+		"minute":    timePart(func(t time.Time) int { return t.Minute() }),
+		"second":    timePart(func(t time.Time) int { return t.Second() }),
+		"len":       evalLen,
+		"concat":    evalConcat,
+		"lower":     stringFunc(strings.ToLower),
+		"upper":     stringFunc(strings.ToUpper),
+		"trim":      stringFunc(strings.TrimSpace),
+		"coalesce":  evalCoalesce,
+		"substring": evalSubstring,
+		"abs":       evalAbs,
+		"round":     evalRound,
+		"now":       func(args []interface{}) (interface{}, error) { return time.Now(), nil },
+		"make_date": evalMakeDate,
+		"cast":      evalCast,
+		"search":    evalSearch,
+		"similar":   evalSimilar,
+	}
+)
+
+// RegisterEvalFunc thêm hoặc thay thế một hàm dùng trong Eval (tên không phân biệt hoa thường)
+func RegisterEvalFunc(name string, fn EvalFunc) {
+	evalFuncsLock.Lock()
+	defer evalFuncsLock.Unlock()
+	evalFuncs[strings.ToLower(name)] = fn
+}
+
+func lookupEvalFunc(name string) (EvalFunc, bool) {
+	evalFuncsLock.RLock()
+	defer evalFuncsLock.RUnlock()
+	fn, ok := evalFuncs[strings.ToLower(name)]
+	return fn, ok
+}
+
+// Eval tính giá trị của cây biểu thức trên data (struct, con trỏ tới struct hoặc map với key là string).
+// Tham số "?" lấy lần lượt từ params theo thứ tự xuất hiện, tham số có tên "@name", ":name"
+// lấy từ params[0] là map hoặc struct.
+// NULL được xử lý như trong SQL: so sánh với NULL cho kết quả nil.
+func Eval(tree *SimpleExprTree, data interface{}, params ...interface{}) (interface{}, error) {
+	ev := &evaluator{data: reflect.ValueOf(data)}
+	if err := ev.bindParams(tree, params); err != nil {
+		return nil, err
+	}
+	return ev.eval(tree)
+}
+
+// EvalBool giống Eval nhưng biểu thức phải là điều kiện, kết quả NULL được xem là false
+// (giống WHERE trong SQL)
+func EvalBool(tree *SimpleExprTree, data interface{}, params ...interface{}) (bool, error) {
+	v, err := Eval(tree, data, params...)
+	if err != nil {
+		return false, err
+	}
+	switch b := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	default:
+		return false, fmt.Errorf("expression %s is not a condition, got %T", tree.String(), v)
+	}
+}
+
+type evaluator struct {
+	data   reflect.Value
+	params map[*SimpleExprTree]interface{}
+}
+
+// bindParams gán giá trị cho các nút tham số trước khi tính,
+// vì and/or có thể bỏ qua một nhánh nên không thể đếm "?" trong lúc tính
+func (ev *evaluator) bindParams(tree *SimpleExprTree, params []interface{}) error {
+	ev.params = map[*SimpleExprTree]interface{}{}
+	var nodes []*SimpleExprTree
+	seen := map[*SimpleExprTree]bool{}
+	var walk func(n *SimpleExprTree)
+	walk = func(n *SimpleExprTree) {
+		if n == nil {
+			return
+		}
+		if n.Nt == "param" && !seen[n] {
+			// Optimize có thể dùng một nút tham số ở nhiều chỗ, nó chỉ nhận một giá trị
+			seen[n] = true
+			nodes = append(nodes, n)
+		}
+		for _, c := range n.Ns {
+			walk(c)
+		}
+	}
+	walk(tree)
+	positional := 0
+	for _, n := range nodes {
+		name := n.ParamName()
+		if name == "" {
+			if positional >= len(params) {
+				return fmt.Errorf("missing value of parameter %d", positional+1)
+			}
+			ev.params[n] = params[positional]
+			positional++
+			continue
+		}
+		if len(params) == 0 {
+			return fmt.Errorf("missing parameter %s", n.V)
+		}
+		v, ok := lookupValue(reflect.ValueOf(params[0]), name)
+		if !ok {
+			return fmt.Errorf("missing parameter %s", n.V)
+		}
+		ev.params[n] = v
+	}
+	if positional > 0 && positional != len(params) {
+		return fmt.Errorf("expression has %d parameter(s), got %d value(s)", positional, len(params))
+	}
+	return nil
+}
+
+func (ev *evaluator) eval(n *SimpleExprTree) (interface{}, error) {
+	if n.Op == "()" {
+		return ev.eval(n.Ns[0])
+	}
+	switch n.Nt {
+	case "const":
+		return n.LiteralValue()
+	case "param":
+		return normalizeValue(ev.params[n])
+	case "field", "column":
+		v, ok := lookupValue(ev.data, n.V)
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s'", n.V)
+		}
+		return normalizeValue(v)
+	case "func":
+		return ev.evalFunc(n)
+	case "unary":
+		return ev.evalUnary(n)
+	case "postfix":
+		x, err := ev.eval(n.Ns[0])
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(n.Op, "is null") {
+			return x == nil, nil
+		}
+		return x != nil, nil
+	case "between":
+		return ev.evalBetween(n)
+	case "cast":
+		x, err := ev.eval(n.Ns[0])
+		if err != nil {
+			return nil, err
+		}
+		return castValue(x, n.V)
+	case "json":
+		return ev.evalJSON(n)
+	}
+	if len(n.Ns) == 2 {
+		return ev.evalBinary(n)
+	}
+	return nil, fmt.Errorf("cannot evaluate %s", n.String())
+}
+
+func (ev *evaluator) evalUnary(n *SimpleExprTree) (interface{}, error) {
+	x, err := ev.eval(n.Ns[0])
+	if err != nil || x == nil {
+		return nil, err
+	}
+	switch strings.ToLower(n.Op) {
+	case "!", "not":
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s requires a condition, got %T", n.Op, x)
+		}
+		return !b, nil
+	case "-":
+		switch v := x.(type) {
+		case int64:
+			return -v, nil
+		case float64:
+			return -v, nil
+		}
+		return nil, fmt.Errorf("operator - requires a number, got %T", x)
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", n.Op)
+}
+
+func (ev *evaluator) evalBinary(n *SimpleExprTree) (interface{}, error) {
+	op := strings.ToLower(n.Op)
+	switch op {
+	case "and", "&&", "or", "||":
+		return ev.evalLogical(op, n)
+	case "in", "not in":
+		return ev.evalIn(op, n)
+	case "?":
+		return ev.evalJSONExists(n)
+	}
+	// "x == null" giống "x is null" như khi biên dịch sang sql
+	if op == "==" || op == "=" || op == "!=" || op == "<>" {
+		for i, c := range n.Ns {
+			if c.Nt == "const" && c.Lk == "null" {
+				x, err := ev.eval(n.Ns[1-i])
+				if err != nil {
+					return nil, err
+				}
+				return (x == nil) == (op == "==" || op == "="), nil
+			}
+		}
+	}
+	l, err := ev.eval(n.Ns[0])
+	if err != nil {
+		return nil, err
+	}
+	r, err := ev.eval(n.Ns[1])
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	switch op {
+	case "==", "=", "!=", "<>", "<", "<=", ">", ">=":
+		c, err := compareValues(l, r, op)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "like", "not like", "ilike", "not ilike":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if !lok || !rok {
+			return nil, fmt.Errorf("operator %s requires strings, got %T and %T", n.Op, l, r)
+		}
+		if strings.HasSuffix(op, "ilike") {
+			ls, rs = strings.ToLower(ls), strings.ToLower(rs)
+		}
+		ok, err := likeMatch(ls, rs)
+		if err != nil {
+			return nil, err
+		}
+		return ok == !strings.HasPrefix(op, "not "), nil
+	case "+", "-", "*", "/", "%", "^":
+		return arithmetic(op, l, r)
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", n.Op)
+}
+
+// evalLogical dùng logic ba giá trị của SQL: false and NULL là false, true or NULL là true
+func (ev *evaluator) evalLogical(op string, n *SimpleExprTree) (interface{}, error) {
+	isAnd := op == "and" || op == "&&"
+	sawNull := false
+	for _, c := range n.Ns {
+		x, err := ev.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		if x == nil {
+			sawNull = true
+			continue
+		}
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s requires conditions, got %T", n.Op, x)
+		}
+		if b != isAnd {
+			return b, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return isAnd, nil
+}
+
+func (ev *evaluator) evalIn(op string, n *SimpleExprTree) (interface{}, error) {
+	x, err := ev.eval(n.Ns[0])
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	if n.Ns[1].Nt == "list" {
+		for _, c := range n.Ns[1].Ns {
+			v, err := ev.eval(c)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+	} else {
+		v, err := ev.eval(n.Ns[1])
+		if err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			for i := 0; i < rv.Len(); i++ {
+				item, err := normalizeValue(rv.Index(i).Interface())
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+		} else {
+			items = append(items, v)
+		}
+	}
+	if x == nil {
+		return nil, nil
+	}
+	found, sawNull := false, false
+	for _, item := range items {
+		if item == nil {
+			sawNull = true
+			continue
+		}
+		eq, err := compareValues(x, item, "=")
+		if err != nil {
+			return nil, err
+		}
+		if eq {
+			found = true
+			break
+		}
+	}
+	if !found && sawNull {
+		return nil, nil
+	}
+	return found == (op == "in"), nil
+}
+
+func (ev *evaluator) evalBetween(n *SimpleExprTree) (interface{}, error) {
+	var vals [3]interface{}
+	for i, c := range n.Ns {
+		v, err := ev.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, nil
+		}
+		vals[i] = v
+	}
+	ge, err := compareValues(vals[0], vals[1], ">=")
+	if err != nil {
+		return nil, err
+	}
+	le, err := compareValues(vals[0], vals[2], "<=")
+	if err != nil {
+		return nil, err
+	}
+	return (ge && le) == strings.EqualFold(n.Op, "between"), nil
+}
+
+func (ev *evaluator) evalFunc(n *SimpleExprTree) (interface{}, error) {
+	if IsQuantifier(n.V) {
+		return ev.evalQuantifier(n)
+	}
+	fn, ok := lookupEvalFunc(n.V)
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s'", n.V)
+	}
+	args := make([]interface{}, len(n.Ns))
+	for i, c := range n.Ns {
+		v, err := ev.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return fn(args)
+}
+
+// evalQuantifier tính any/all/none trên slice (hoặc mảng) là field của data,
+// điều kiện được tính trên từng phần tử; điều kiện NULL được xem là false như trong SQL
+func (ev *evaluator) evalQuantifier(n *SimpleExprTree) (interface{}, error) {
+	fn := strings.ToLower(n.V)
+	if len(n.Ns) < 1 || len(n.Ns) > 2 || (fn == "all" && len(n.Ns) != 2) || n.Ns[0].Nt != "field" {
+		return nil, fmt.Errorf("invalid function call: %s", n.String())
+	}
+	v, ok := lookupValue(ev.data, n.Ns[0].V)
+	if !ok {
+		return nil, fmt.Errorf("unknown field '%s'", n.Ns[0].V)
+	}
+	items := reflect.ValueOf(v)
+	for items.Kind() == reflect.Ptr && !items.IsNil() {
+		items = items.Elem()
+	}
+	count := 0
+	if items.Kind() == reflect.Slice || items.Kind() == reflect.Array {
+		count = items.Len()
+	} else if v != nil && !(items.Kind() == reflect.Ptr && items.IsNil()) {
+		// quan hệ has-one / belongs-to: một bản ghi
+		items = reflect.ValueOf([]interface{}{v})
+		count = 1
+	}
+	matched := 0
+	for i := 0; i < count; i++ {
+		ok := true
+		if len(n.Ns) == 2 {
+			sub := &evaluator{data: items.Index(i), params: ev.params}
+			x, err := sub.eval(n.Ns[1])
+			if err != nil {
+				return nil, err
+			}
+			b, isBool := x.(bool)
+			if x != nil && !isBool {
+				return nil, fmt.Errorf("the condition of %s is not a condition, got %T", fn, x)
+			}
+			ok = b
+		}
+		if ok {
+			matched++
+		}
+	}
+	switch fn {
+	case "any":
+		return matched > 0, nil
+	case "none":
+		return matched == 0, nil
+	default:
+		return matched == count, nil
+	}
+}
+
+// lookupValue tìm giá trị name trong map (key là string) hoặc struct:
+// khớp chính xác, sau đó không phân biệt hoa thường, với struct còn khớp theo tên cột snake_case
+func lookupValue(v reflect.Value, name string) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		if item := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); item.IsValid() {
+			return item.Interface(), true
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if strings.EqualFold(iter.Key().String(), name) {
+				return iter.Value().Interface(), true
+			}
+		}
+	case reflect.Struct:
+		f := v.FieldByName(name)
+		if !f.IsValid() {
+			f = v.FieldByNameFunc(func(n string) bool {
+				return strings.EqualFold(n, name) || ToSnakeCase(n) == name
+			})
+		}
+		if f.IsValid() && f.CanInterface() {
+			return f.Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// normalizeValue đưa giá trị Go về int64, float64, string, bool, time.Time hoặc nil,
+// slice được giữ nguyên cho toán tử in
+func normalizeValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case driver.Valuer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, nil
+		}
+		dv, err := x.Value()
+		if err != nil {
+			return nil, err
+		}
+		return normalizeValue(dv)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return normalizeValue(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
+	}
+	return v, nil
+}
+
+// evalJSON lấy giá trị theo đường dẫn json, giá trị gốc có thể là chuỗi json,
+// map hoặc slice; key không tồn tại cho kết quả nil
+func (ev *evaluator) evalJSON(n *SimpleExprTree) (interface{}, error) {
+	v, err := ev.eval(n.Ns[0])
+	if err != nil {
+		return nil, err
+	}
+	v, err = jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, keyNode := range n.Ns[1:] {
+		key, err := ev.eval(keyNode)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil || key == nil {
+			return nil, nil
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Kind() == reflect.Map:
+			k, ok := key.(string)
+			if !ok {
+				return nil, nil
+			}
+			item, _ := lookupValue(rv, k)
+			v, err = jsonValue(item)
+		case rv.Kind() == reflect.Slice:
+			i, ok := key.(int64)
+			if !ok || i < 0 || int(i) >= rv.Len() {
+				return nil, nil
+			}
+			v, err = jsonValue(rv.Index(int(i)).Interface())
+		default:
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return normalizeValue(v)
+}
+
+// evalJSONExists: json ? 'k' đúng khi object có key k, mảng có phần tử chuỗi k hoặc chuỗi bằng k
+func (ev *evaluator) evalJSONExists(n *SimpleExprTree) (interface{}, error) {
+	l, err := ev.eval(n.Ns[0])
+	if err != nil {
+		return nil, err
+	}
+	r, err := ev.eval(n.Ns[1])
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	key, ok := r.(string)
+	if !ok {
+		return nil, fmt.Errorf("operator ? requires a string key, got %T", r)
+	}
+	l, err = jsonValue(l)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(l)
+	switch rv.Kind() {
+	case reflect.Map:
+		_, found := lookupValue(rv, key)
+		return found, nil
+	case reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			if s, ok := rv.Index(i).Interface().(string); ok && s == key {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.String:
+		return rv.String() == key, nil
+	}
+	return false, nil
+}
+
+// jsonValue giải mã chuỗi json (hoặc []byte) thành map, slice hoặc giá trị đơn
+func jsonValue(v interface{}) (interface{}, error) {
+	v, err := normalizeValue(v)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" || !strings.ContainsAny(trimmed[:1], "{[\"") {
+		return v, nil
+	}
+	var ret interface{}
+	if err := json.Unmarshal([]byte(trimmed), &ret); err != nil {
+		return nil, fmt.Errorf("invalid json value: %w", err)
+	}
+	return ret, nil
+}
+
+// castValue ép giá trị sang kiểu sql typ giống CAST của postgres
+func castValue(v interface{}, typ string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch strings.ToLower(typ) {
+	case "numeric", "double precision":
+		if f, ok := toFloat(v); ok {
+			return f, nil
+		}
+		if s, ok := v.(string); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot cast '%s' to %s", s, typ)
+			}
+			return f, nil
+		}
+	case "integer", "bigint":
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case float64:
+			return int64(math.Round(x)), nil
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot cast '%s' to %s", x, typ)
+			}
+			return i, nil
+		}
+	case "text":
+		if t, ok := v.(time.Time); ok {
+			return t.Format(TimestampLayout), nil
+		}
+		return fmt.Sprint(v), nil
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			if err != nil {
+				return nil, fmt.Errorf("cannot cast '%s' to %s", x, typ)
+			}
+			return b, nil
+		}
+	case "date", "timestamp":
+		switch x := v.(type) {
+		case time.Time:
+			if typ == "date" {
+				return time.Date(x.Year(), x.Month(), x.Day(), 0, 0, 0, 0, x.Location()), nil
+			}
+			return x, nil
+		case string:
+			return parseDateLiteral(typ, strings.TrimSpace(x))
+		}
+	case "jsonb":
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot cast %T to %s", v, typ)
+}
+
+// evalCast: cast(x, 'numeric')
+func evalCast(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("function cast requires 2 arguments")
+	}
+	typ, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("function cast requires a type name")
+	}
+	return castValue(args[0], typ)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+// compareValues so sánh hai giá trị khác nil cùng loại (số, chuỗi, thời gian, bool)
+func compareValues(l interface{}, r interface{}, op string) (bool, error) {
+	var c int
+	switch lv := l.(type) {
+	case int64:
+		if rv, ok := r.(int64); ok {
+			c = cmpOrdered(lv, rv)
+			break
+		}
+		rf, ok := toFloat(r)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		c = cmpOrdered(float64(lv), rf)
+	case float64:
+		rf, ok := toFloat(r)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		c = cmpOrdered(lv, rf)
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		c = strings.Compare(lv, rv)
+	case time.Time:
+		rv, ok := r.(time.Time)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		c = lv.Compare(rv)
+	case bool:
+		rv, ok := r.(bool)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %T and %T", l, r)
+		}
+		if lv != rv {
+			c = 1
+			if !lv {
+				c = -1
+			}
+		}
+	default:
+		return false, fmt.Errorf("cannot compare %T and %T", l, r)
+	}
+	switch op {
+	case "==", "=":
+		return c == 0, nil
+	case "!=", "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator '%s'", op)
+}
+
+func cmpOrdered[T int64 | float64](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// arithmetic tính + - * / % ^ như postgres: hai số nguyên cho số nguyên (chia lấy phần nguyên)
+func arithmetic(op string, l interface{}, r interface{}) (interface{}, error) {
+	li, lInt := l.(int64)
+	ri, rInt := r.(int64)
+	if lInt && rInt && op != "^" {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s requires numbers, got %T and %T", op, l, r)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/", "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == "/" {
+			return lf / rf, nil
+		}
+		return math.Mod(lf, rf), nil
+	case "^":
+		return math.Pow(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// likeMatch so khớp mẫu LIKE: % là chuỗi bất kỳ, _ là một ký tự, \ thoát ký tự kế tiếp
+func likeMatch(s string, pattern string) (bool, error) {
+	var re strings.Builder
+	re.WriteString("(?s)^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			re.WriteString(".*")
+		case c == '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	r, err := regexp.Compile(re.String())
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(s), nil
+}
+
+func timePart(part func(t time.Time) int) EvalFunc {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("function requires only one argument")
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("function requires a date, got %T", args[0])
+		}
+		return int64(part(t)), nil
+	}
+}
+
+// evalMakeDate: make_date(năm, tháng, ngày), lỗi khi ngày không hợp lệ như postgres
+func evalMakeDate(args []interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("function make_date requires 3 arguments")
+	}
+	var parts [3]int64
+	for i, a := range args {
+		if a == nil {
+			return nil, nil
+		}
+		v, ok := a.(int64)
+		if !ok {
+			return nil, fmt.Errorf("function make_date requires integers, got %T", a)
+		}
+		parts[i] = v
+	}
+	t := time.Date(int(parts[0]), time.Month(parts[1]), int(parts[2]), 0, 0, 0, 0, time.UTC)
+	if parts[1] < 1 || parts[1] > 12 || int64(t.Day()) != parts[2] {
+		return nil, fmt.Errorf("date field value out of range: %d-%d-%d", parts[0], parts[1], parts[2])
+	}
+	return t, nil
+}
+
+func stringFunc(fn func(string) string) EvalFunc {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("function requires only one argument")
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("function requires a string, got %T", args[0])
+		}
+		return fn(s), nil
+	}
+}
+
+func evalLen(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("function len requires only one argument")
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("function len requires a string, got %T", args[0])
+	}
+	return int64(utf8.RuneCountInString(s)), nil
+}
+
+// evalConcat bỏ qua NULL giống concat của postgres
+func evalConcat(args []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for _, a := range args {
+		if a != nil {
+			sb.WriteString(fmt.Sprint(a))
+		}
+	}
+	return sb.String(), nil
+}
+
+func evalCoalesce(args []interface{}) (interface{}, error) {
+	for _, a := range args {
+		if a != nil {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// evalSubstring: substring(s, from [, count]), vị trí tính từ 1 theo ký tự như postgres
+func evalSubstring(args []interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("function substring requires 2 to 3 arguments")
+	}
+	for _, a := range args {
+		if a == nil {
+			return nil, nil
+		}
+	}
+	s, ok := args[0].(string)
+	from, okFrom := args[1].(int64)
+	if !ok || !okFrom {
+		return nil, fmt.Errorf("function substring requires a string and integer positions")
+	}
+	runes := []rune(s)
+	end := int64(len(runes)) + 1
+	if len(args) == 3 {
+		count, ok := args[2].(int64)
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("function substring requires a non-negative length")
+		}
+		end = from + count
+	}
+	if from < 1 {
+		from = 1
+	}
+	if end > int64(len(runes))+1 {
+		end = int64(len(runes)) + 1
+	}
+	if end <= from {
+		return "", nil
+	}
+	return string(runes[from-1 : end-1]), nil
+}
+
+func evalAbs(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("function abs requires only one argument")
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case float64:
+		return math.Abs(v), nil
+	}
+	return nil, fmt.Errorf("function abs requires a number, got %T", args[0])
+}
+
+// evalRound làm tròn xa số 0 như round của postgres
+func evalRound(args []interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("function round requires 1 to 2 arguments")
+	}
+	for _, a := range args {
+		if a == nil {
+			return nil, nil
+		}
+	}
+	digits := int64(0)
+	if len(args) == 2 {
+		d, ok := args[1].(int64)
+		if !ok {
+			return nil, fmt.Errorf("function round requires an integer number of digits")
+		}
+		digits = d
+	}
+	switch v := args[0].(type) {
+	case int64:
+		if digits >= 0 {
+			return v, nil
+		}
+		return int64(roundTo(float64(v), digits)), nil
+	case float64:
+		return roundTo(v, digits), nil
+	}
+	return nil, fmt.Errorf("function round requires a number, got %T", args[0])
+}
+
+func roundTo(v float64, digits int64) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
+
+// evalSearch gần giống plainto_tsquery: đúng khi mọi từ của câu tìm kiếm có trong văn bản
+// (không phân biệt hoa thường, không xét từ gốc)
+func evalSearch(args []interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("function search requires 2 to 3 arguments")
+	}
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	text, ok := args[0].(string)
+	query, okQuery := args[1].(string)
+	if !ok || !okQuery {
+		return nil, fmt.Errorf("function search requires strings")
+	}
+	words := map[string]bool{}
+	for _, w := range searchWords(text) {
+		words[w] = true
+	}
+	terms := searchWords(query)
+	for _, w := range terms {
+		if !words[w] {
+			return false, nil
+		}
+	}
+	return len(terms) > 0, nil
+}
+
+// SimilarityThreshold là ngưỡng của similar(), giống pg_trgm.similarity_threshold mặc định
+const SimilarityThreshold = 0.3
+
+// evalSimilar: độ tương đồng trigram như pg_trgm phải đạt SimilarityThreshold
+func evalSimilar(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("function similar requires 2 arguments")
+	}
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	a, b := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return false, nil
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	sim := float64(common) / float64(len(ta)+len(tb)-common)
+	return sim >= SimilarityThreshold, nil
+}
+
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams tách chuỗi thành các trigram giống pg_trgm: mỗi từ được thêm hai khoảng trắng
+// ở đầu và một khoảng trắng ở cuối
+func trigrams(s string) map[string]bool {
+	ret := map[string]bool{}
+	for _, w := range searchWords(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			ret[string(r[i:i+3])] = true
+		}
+	}
+	return ret
+}
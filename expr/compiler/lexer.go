@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenKind là loại của một token trong biểu thức
+type TokenKind int
+
+const (
+	TokEOF     TokenKind = iota // Kết thúc biểu thức
+	TokIdent                    // Tên field, đường dẫn json (Data.address.city) hoặc tên hàm
+	TokNumber                   // Hằng số dạng số
+	TokString                   // Hằng số chuỗi trong dấu nháy đơn
+	TokParam                    // Tham số "?" hoặc tham số có tên "@name", ":name"
+	TokKeyword                  // Từ khoá: and, or, like, ilike, not, is, null, in, between, true, false
+	TokOp                       // Toán tử ký hiệu: ==, <=, +, &&, ...
+	TokLParen                   // "("
+	TokRParen                   // ")"
+	TokComma                    // ","
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokEOF:
+		return "end of expression"
+	case TokIdent:
+		return "identifier"
+	case TokNumber:
+		return "number"
+	case TokString:
+		return "string"
+	case TokParam:
+		return "parameter"
+	case TokKeyword:
+		return "keyword"
+	case TokOp:
+		return "operator"
+	case TokLParen:
+		return "'('"
+	case TokRParen:
+		return "')'"
+	case TokComma:
+		return "','"
+	default:
+		return "unknown"
+	}
+}
+
+// Token là một đơn vị từ vựng của biểu thức, Pos là vị trí byte trong chuỗi gốc
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int
+}
+
+// keywords là các từ khoá, chỉ được nhận dạng khi đứng thành một từ riêng
+// (không phân biệt hoa thường), vì vậy "Order" hay "Brand" vẫn là tên field
+var keywords = map[string]bool{
+	"and":     true,
+	"or":      true,
+	"like":    true,
+	"ilike":   true,
+	"not":     true,
+	"is":      true,
+	"null":    true,
+	"in":      true,
+	"between": true,
+	"true":    true,
+	"false":   true,
+}
+
+// symbolOps là các toán tử ký hiệu, toán tử dài hơn phải đứng trước
+var symbolOps = []string{
+	"||", "&&", "==", "!=", "<>", "<=", ">=",
+	"=", "<", ">", "!", "+", "-", "*", "/", "%", "^",
+}
+
+// Tokenize tách biểu thức thành danh sách token, token cuối luôn là TokEOF
+func Tokenize(expr string) ([]Token, error) {
+	var tokens []Token
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(expr) && isIdentChar(expr[i]) {
+				i++
+				// Đường dẫn json: Data.address.city là một token
+				if i+1 < len(expr) && expr[i] == '.' && isIdentStart(expr[i+1]) {
+					i++
+				}
+			}
+			text := expr[start:i]
+			kind := TokIdent
+			if keywords[strings.ToLower(text)] {
+				kind = TokKeyword
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: text, Pos: start})
+		case c >= '0' && c <= '9':
+			// Giữ nguyên cả cụm như "1m2" thành một token, parser sẽ kiểm tra tính hợp lệ
+			start := i
+			for i < len(expr) && (isIdentChar(expr[i]) || expr[i] == '.') {
+				i++
+				// Số mũ có dấu: 1e-5, 2.5E+3
+				if (expr[i-1] == 'e' || expr[i-1] == 'E') && i+1 < len(expr) &&
+					(expr[i] == '+' || expr[i] == '-') && expr[i+1] >= '0' && expr[i+1] <= '9' {
+					i++
+				}
+			}
+			text := expr[start:i]
+			if malformedNumber(text) {
+				// 1.5.3, 1e5e3, 1.5e: không phải số cũng không phải tên, không được đưa vào sql
+				return nil, newParseError(expr, Token{Kind: TokNumber, Text: text, Pos: start}, "", "invalid number %s", text)
+			}
+			tokens = append(tokens, Token{Kind: TokNumber, Text: text, Pos: start})
+		case c == '\'':
+			// Chuỗi trong dấu nháy đơn, '' là ký tự nháy đã được thoát
+			start := i
+			i++
+			closed := false
+			for i < len(expr) {
+				if expr[i] == '\'' {
+					if i+1 < len(expr) && expr[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				i++
+			}
+			if !closed {
+				return nil, newParseError(expr, Token{Kind: TokString, Text: expr[start:], Pos: start}, "closing quote", "unterminated string")
+			}
+			tokens = append(tokens, Token{Kind: TokString, Text: expr[start:i], Pos: start})
+		case c == '?':
+			tokens = append(tokens, Token{Kind: TokParam, Text: "?", Pos: i})
+			i++
+		case c == '@' || c == ':':
+			// Tham số có tên: @code hoặc :code
+			start := i
+			i++
+			if i >= len(expr) || !isIdentStart(expr[i]) {
+				return nil, newParseError(expr, Token{Kind: TokParam, Text: string(c), Pos: start}, "parameter name", "missing parameter name")
+			}
+			for i < len(expr) && isIdentChar(expr[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokParam, Text: expr[start:i], Pos: start})
+		case c == '(':
+			tokens = append(tokens, Token{Kind: TokLParen, Text: "(", Pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, Token{Kind: TokRParen, Text: ")", Pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, Token{Kind: TokComma, Text: ",", Pos: i})
+			i++
+		default:
+			op := ""
+			for _, o := range symbolOps {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				r, _ := utf8.DecodeRuneInString(expr[i:])
+				return nil, newParseError(expr, Token{Text: string(r), Pos: i}, "", "unexpected character '%c'", r)
+			}
+			tokens = append(tokens, Token{Kind: TokOp, Text: op, Pos: i})
+			i += len(op)
+		}
+	}
+	tokens = append(tokens, Token{Kind: TokEOF, Pos: len(expr)})
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,135 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	intLiteral   = regexp.MustCompile(`^[0-9]+$`)
+	floatLiteral = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// Định dạng được chấp nhận của hằng ngày tháng: date '2024-01-31', timestamp '2024-01-31 10:00:00'
+const (
+	DateLayout      = "2006-01-02"
+	TimestampLayout = "2006-01-02 15:04:05"
+)
+
+var timestampLayouts = []string{
+	TimestampLayout,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+}
+
+// numberKind trả về "int" hoặc "float" nếu text là một hằng số hợp lệ, ngược lại trả về ""
+// (ví dụ "1m2" không còn được xem là số như khi dùng Sscanf("%d"))
+func numberKind(text string) string {
+	if intLiteral.MatchString(text) {
+		if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return "int"
+		}
+		return "float"
+	}
+	if floatLiteral.MatchString(text) {
+		return "float"
+	}
+	return ""
+}
+
+// badNumber là cụm bắt đầu bằng số có dấu chấm, dấu của số mũ hoặc chữ e ngay sau phần số
+var badNumber = regexp.MustCompile(`[.+-]|^[0-9]+(\.[0-9]*)?[eE]`)
+
+// malformedNumber cho biết text (token bắt đầu bằng chữ số) trông như số nhưng không hợp lệ,
+// "1m2" vẫn được giữ lại cho parser như trước
+func malformedNumber(text string) bool {
+	return numberKind(text) == "" && badNumber.MatchString(text)
+}
+
+// negateNumber đổi dấu của hằng số dạng text: 1 -> -1, -1 -> 1
+func negateNumber(text string) string {
+	if strings.HasPrefix(text, "-") {
+		return text[1:]
+	}
+	return "-" + text
+}
+
+// Unquote bỏ dấu nháy đơn bao ngoài và giải mã hai dấu nháy liên tiếp thành một
+func Unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", fmt.Errorf("invalid string literal %s", s)
+	}
+	inner := s[1 : len(s)-1]
+	if strings.Count(inner, "'") != 2*strings.Count(inner, "''") {
+		return "", fmt.Errorf("invalid string literal %s", s)
+	}
+	return strings.ReplaceAll(inner, "''", "'"), nil
+}
+
+// Quote bao chuỗi trong dấu nháy đơn, mỗi dấu nháy bên trong được nhân đôi
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// parseDateLiteral kiểm tra giá trị của hằng date/timestamp
+func parseDateLiteral(kind string, value string) (time.Time, error) {
+	if kind == "date" {
+		return time.Parse(DateLayout, value)
+	}
+	var lastErr error
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// LiteralValue trả về giá trị Go của nút hằng số (Nt là "const"):
+// int64, float64, bool, nil, time.Time hoặc string tuỳ theo Lk
+func (t *SimpleExprTree) LiteralValue() (interface{}, error) {
+	if t == nil || t.Nt != "const" {
+		return nil, fmt.Errorf("node is not a literal")
+	}
+	switch t.Lk {
+	case "int":
+		return strconv.ParseInt(t.V, 10, 64)
+	case "float":
+		return strconv.ParseFloat(t.V, 64)
+	case "bool":
+		return strings.EqualFold(t.V, "true"), nil
+	case "null":
+		return nil, nil
+	case "date", "timestamp":
+		value, err := t.LiteralText()
+		if err != nil {
+			return nil, err
+		}
+		return parseDateLiteral(t.Lk, value)
+	case "string":
+		return Unquote(t.V)
+	default:
+		return nil, fmt.Errorf("unknown literal kind '%s' of %s", t.Lk, t.V)
+	}
+}
+
+// LiteralText trả về nội dung chuỗi (đã bỏ nháy) của hằng string, date hoặc timestamp
+func (t *SimpleExprTree) LiteralText() (string, error) {
+	switch t.Lk {
+	case "date", "timestamp":
+		return Unquote(strings.TrimSpace(t.V[len(t.Lk):]))
+	case "string":
+		return Unquote(t.V)
+	default:
+		return t.V, nil
+	}
+}
@@ -0,0 +1,459 @@
+package compiler
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Optimize trả về bản sao của cây đã được viết lại để câu sql dùng được index
+// và gọn hơn mà không đổi ý nghĩa (cây gốc giữ nguyên):
+//
+//   - tính trước các hằng số nguyên: 2 * 3 + 1 thành 7, x and true thành x (số thực không được
+//     tính vì float64 khác numeric của database, vế có tham số không bao giờ bị bỏ đi)
+//   - so sánh year(F) với hằng số hoặc tham số thành khoảng thời gian nửa mở:
+//     year(F) == 2024 thành F >= timestamp '2024-01-01 00:00:00' and F < timestamp '2025-01-01 00:00:00',
+//     year(F) == ? thành F >= make_date(?, 1, 1) and F < make_date(? + 1, 1, 1)
+//     (hai "?" là cùng một nút tham số, chỉ cần truyền một giá trị)
+//   - year(F) == y and month(F) == m [and day(F) == d] với hằng số thành khoảng của tháng (ngày)
+//   - bỏ các ngoặc thừa, chỉ khi việc bỏ ngoặc cũng an toàn trong sql
+func Optimize(tree *SimpleExprTree) *SimpleExprTree {
+	n := foldConstants(tree.Clone())
+	n = rewriteDateParts(n)
+	return stripParens(n, nil)
+}
+
+// foldableOps là các toán tử được tính trước khi hai vế là hằng số nguyên hoặc bool;
+// "/" và "%" không được tính vì kết quả khác nhau giữa các database
+var foldableOps = map[string]bool{
+	"+": true, "-": true, "*": true,
+	"==": true, "=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+func foldConstants(n *SimpleExprTree) *SimpleExprTree {
+	for i, c := range n.Ns {
+		n.Ns[i] = foldConstants(c)
+	}
+	op := strings.ToLower(n.Op)
+	switch {
+	case op == "()" && n.Ns[0].Nt == "const" && !strings.HasPrefix(n.Ns[0].V, "-"):
+		// (-1) giữ ngoặc, stripParens quyết định có bỏ được không (-(-1) không được thành --1)
+		return n.Ns[0]
+	case n.Nt == "unary" && (op == "not" || op == "!") && isBoolConst(n.Ns[0]):
+		return boolConst(!strings.EqualFold(n.Ns[0].V, "true"))
+	case n.Nt == "" && len(n.Ns) == 2 && (op == "and" || op == "&&" || op == "or" || op == "||"):
+		isAnd := op == "and" || op == "&&"
+		for i, c := range n.Ns {
+			if !isBoolConst(c) {
+				continue
+			}
+			// x and true = x, x and false = false, x or false = x, x or true = true
+			if strings.EqualFold(c.V, "true") == isAnd {
+				return n.Ns[1-i]
+			}
+			if hasParam(n.Ns[1-i]) {
+				// bỏ vế có tham số thì số tham số của sql không còn khớp với args của người gọi
+				return n
+			}
+			return c
+		}
+	case n.Nt == "" && len(n.Ns) == 2 && foldableOps[op] && isIntOrBool(unwrapParens(n.Ns[0])) && isIntOrBool(unwrapParens(n.Ns[1])):
+		if intOverflow(op, unwrapParens(n.Ns[0]), unwrapParens(n.Ns[1])) {
+			return n
+		}
+		v, err := Eval(n, nil)
+		if err != nil {
+			return n
+		}
+		if ret := constNode(v); ret != nil {
+			return ret
+		}
+	}
+	return n
+}
+
+func isBoolConst(n *SimpleExprTree) bool {
+	return n.Nt == "const" && n.Lk == "bool"
+}
+
+func isIntOrBool(n *SimpleExprTree) bool {
+	return n.Nt == "const" && (n.Lk == "int" || n.Lk == "bool")
+}
+
+// hasParam cho biết cây n có nút tham số
+func hasParam(n *SimpleExprTree) bool {
+	if n.Nt == "param" {
+		return true
+	}
+	for _, c := range n.Ns {
+		if hasParam(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// intOverflow cho biết a op b (+, -, * của hai số nguyên) vượt quá int64,
+// khi đó giữ nguyên để database báo lỗi thay vì tính ra số sai
+func intOverflow(op string, a *SimpleExprTree, b *SimpleExprTree) bool {
+	if a.Lk != "int" || b.Lk != "int" {
+		return false
+	}
+	x, okX := new(big.Int).SetString(a.V, 10)
+	y, okY := new(big.Int).SetString(b.V, 10)
+	if !okX || !okY {
+		return true
+	}
+	switch op {
+	case "+":
+		x.Add(x, y)
+	case "-":
+		x.Sub(x, y)
+	case "*":
+		x.Mul(x, y)
+	}
+	return !x.IsInt64()
+}
+
+func boolConst(b bool) *SimpleExprTree {
+	return &SimpleExprTree{V: strconv.FormatBool(b), Nt: "const", Lk: "bool"}
+}
+
+// constNode tạo nút hằng số từ kết quả của Eval, nil nếu không tạo được
+func constNode(v interface{}) *SimpleExprTree {
+	switch x := v.(type) {
+	case bool:
+		return boolConst(x)
+	case int64:
+		return &SimpleExprTree{V: strconv.FormatInt(x, 10), Nt: "const", Lk: "int"}
+	case float64:
+		text := strconv.FormatFloat(x, 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		return &SimpleExprTree{V: text, Nt: "const", Lk: "float"}
+	}
+	return nil
+}
+
+// datePartCmp là một phép so sánh year/month/day(F) với hằng số nguyên hoặc tham số
+type datePartCmp struct {
+	part  string          // "year", "month" hoặc "day"
+	field *SimpleExprTree // F
+	op    string          // toán tử với date part ở vế trái
+	value *SimpleExprTree // hằng số hoặc tham số
+}
+
+// flippedOps là toán tử khi đổi chỗ hai vế: 2024 < year(F) là year(F) > 2024
+var flippedOps = map[string]string{
+	"==": "==", "=": "==", "!=": "!=", "<>": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+// datePart trả về tên hàm và field nếu n là year(F), month(F) hoặc day(F) với F là field
+func datePart(n *SimpleExprTree) (string, *SimpleExprTree, bool) {
+	if n.Nt != "func" || len(n.Ns) != 1 || n.Ns[0].Nt != "field" {
+		return "", nil, false
+	}
+	part := strings.ToLower(n.V)
+	if part != "year" && part != "month" && part != "day" {
+		return "", nil, false
+	}
+	return part, n.Ns[0], true
+}
+
+func toDatePartCmp(n *SimpleExprTree) (*datePartCmp, bool) {
+	if n.Nt != "" || len(n.Ns) != 2 {
+		return nil, false
+	}
+	op, ok := flippedOps[n.Op]
+	if !ok {
+		return nil, false
+	}
+	for i, side := range n.Ns {
+		part, field, ok := datePart(side)
+		value := n.Ns[1-i]
+		if !ok || !(value.Nt == "param" || (value.Nt == "const" && value.Lk == "int")) {
+			continue
+		}
+		if i == 0 {
+			op = n.Op
+			if op == "=" {
+				op = "=="
+			} else if op == "<>" {
+				op = "!="
+			}
+		}
+		return &datePartCmp{part: part, field: field, op: op, value: value}, true
+	}
+	return nil, false
+}
+
+func rewriteDateParts(n *SimpleExprTree) *SimpleExprTree {
+	if isAndNode(n) {
+		return rewriteAndChain(n)
+	}
+	for i, c := range n.Ns {
+		n.Ns[i] = rewriteDateParts(c)
+	}
+	if c, ok := toDatePartCmp(n); ok && c.part == "year" {
+		if ret := yearRange(c); ret != nil {
+			return ret
+		}
+	}
+	if n.Nt == "between" && len(n.Ns) == 3 {
+		if ret := yearBetween(n); ret != nil {
+			return ret
+		}
+	}
+	return n
+}
+
+func isAndNode(n *SimpleExprTree) bool {
+	op := strings.ToLower(n.Op)
+	return n.Nt == "" && len(n.Ns) == 2 && (op == "and" || op == "&&")
+}
+
+// flattenAnd liệt kê các vế của chuỗi and, kể cả các vế trong ngoặc như (a and b) and (c)
+func flattenAnd(n *SimpleExprTree, ret []*SimpleExprTree) []*SimpleExprTree {
+	inner := n
+	for inner.Op == "()" {
+		inner = inner.Ns[0]
+	}
+	if !isAndNode(inner) {
+		return append(ret, n)
+	}
+	for _, c := range inner.Ns {
+		ret = flattenAnd(c, ret)
+	}
+	return ret
+}
+
+// rewriteAndChain gộp year(F) == y and month(F) == m [and day(F) == d] (hằng số) thành khoảng
+// thời gian, các vế khác được viết lại riêng
+func rewriteAndChain(n *SimpleExprTree) *SimpleExprTree {
+	items := flattenAnd(n, nil)
+	groups := map[string]map[string]int{} // field -> part -> vị trí trong items
+	for i, item := range items {
+		inner := item
+		for inner.Op == "()" {
+			inner = inner.Ns[0]
+		}
+		c, ok := toDatePartCmp(inner)
+		if !ok || c.op != "==" || c.value.Nt != "const" {
+			continue
+		}
+		key := strings.ToLower(c.field.V)
+		if groups[key] == nil {
+			groups[key] = map[string]int{}
+		}
+		if _, dup := groups[key][c.part]; !dup {
+			groups[key][c.part] = i
+		}
+	}
+	replaced := map[int]*SimpleExprTree{}
+	removed := map[int]bool{}
+	for _, g := range groups {
+		yi, hasYear := g["year"]
+		mi, hasMonth := g["month"]
+		if !hasYear || !hasMonth {
+			continue
+		}
+		c, _ := toDatePartCmp(unwrapParens(items[yi]))
+		year, _ := strconv.Atoi(c.value.V)
+		cm, _ := toDatePartCmp(unwrapParens(items[mi]))
+		month, _ := strconv.Atoi(cm.value.V)
+		day := 0
+		di, hasDay := g["day"]
+		if hasDay {
+			cd, _ := toDatePartCmp(unwrapParens(items[di]))
+			day, _ = strconv.Atoi(cd.value.V)
+		}
+		start, end, ok := dateRange(year, month, day)
+		if !ok {
+			continue
+		}
+		replaced[yi] = rangeNode(c.field, timestampConst(start), timestampConst(end), false)
+		removed[mi] = true
+		if hasDay {
+			removed[di] = true
+		}
+	}
+	var ret *SimpleExprTree
+	for i, item := range items {
+		if removed[i] {
+			continue
+		}
+		if r, ok := replaced[i]; ok {
+			item = r
+		} else {
+			item = rewriteDateParts(item)
+		}
+		if ret == nil {
+			ret = item
+			continue
+		}
+		ret = &SimpleExprTree{Op: n.Op, Ns: []*SimpleExprTree{ret, item}}
+	}
+	return ret
+}
+
+func unwrapParens(n *SimpleExprTree) *SimpleExprTree {
+	for n.Op == "()" {
+		n = n.Ns[0]
+	}
+	return n
+}
+
+// dateRange trả về khoảng [start, end) của tháng (day == 0) hoặc ngày, false nếu ngày không hợp lệ
+func dateRange(year, month, day int) (time.Time, time.Time, bool) {
+	if year < 1 || year > 9998 || month < 1 || month > 12 || day < 0 || day > 31 {
+		return time.Time{}, time.Time{}, false
+	}
+	if day == 0 {
+		start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0), true
+	}
+	start := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if start.Day() != day {
+		// 31/02: điều kiện luôn sai, giữ nguyên
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.AddDate(0, 0, 1), true
+}
+
+func timestampConst(t time.Time) *SimpleExprTree {
+	return &SimpleExprTree{V: "timestamp " + Quote(t.Format("2006-01-02 15:04:05")), Nt: "const", Lk: "timestamp"}
+}
+
+// yearStart là đầu năm của giá trị year (+ offset): hằng số timestamp hoặc make_date(?, 1, 1)
+func yearStart(value *SimpleExprTree, offset int) *SimpleExprTree {
+	if value.Nt == "const" {
+		year, err := strconv.Atoi(value.V)
+		if err != nil || year+offset < 1 || year+offset > 9999 {
+			return nil
+		}
+		return timestampConst(time.Date(year+offset, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	year := value
+	if offset != 0 {
+		year = &SimpleExprTree{Op: "+", Ns: []*SimpleExprTree{value, {V: strconv.Itoa(offset), Nt: "const", Lk: "int"}}}
+	}
+	one := func() *SimpleExprTree { return &SimpleExprTree{V: "1", Nt: "const", Lk: "int"} }
+	return &SimpleExprTree{V: "make_date", Nt: "func", Ns: []*SimpleExprTree{year, one(), one()}}
+}
+
+// rangeNode tạo "(F >= start && F < end)", hoặc "(F < start || F >= end)" khi not là true.
+// Toán tử viết như parser đọc "&&" / "||" để resolver của mọi dialect đổi được (AND / OR)
+func rangeNode(field *SimpleExprTree, start *SimpleExprTree, end *SimpleExprTree, not bool) *SimpleExprTree {
+	var inner *SimpleExprTree
+	if not {
+		inner = &SimpleExprTree{Op: "||", Ns: []*SimpleExprTree{
+			{Op: "<", Ns: []*SimpleExprTree{field.Clone(), start}},
+			{Op: ">=", Ns: []*SimpleExprTree{field.Clone(), end}},
+		}}
+	} else {
+		inner = &SimpleExprTree{Op: "&&", Ns: []*SimpleExprTree{
+			{Op: ">=", Ns: []*SimpleExprTree{field.Clone(), start}},
+			{Op: "<", Ns: []*SimpleExprTree{field.Clone(), end}},
+		}}
+	}
+	return &SimpleExprTree{Op: "()", Ns: []*SimpleExprTree{inner}}
+}
+
+// yearRange viết lại year(F) op value thành so sánh trực tiếp trên F, nil nếu không viết lại được
+func yearRange(c *datePartCmp) *SimpleExprTree {
+	start, end := yearStart(c.value, 0), yearStart(c.value, 1)
+	if start == nil || end == nil {
+		return nil
+	}
+	switch c.op {
+	case "==":
+		return rangeNode(c.field, start, end, false)
+	case "!=":
+		return rangeNode(c.field, start, end, true)
+	case ">":
+		return &SimpleExprTree{Op: ">=", Ns: []*SimpleExprTree{c.field.Clone(), end}}
+	case ">=":
+		return &SimpleExprTree{Op: ">=", Ns: []*SimpleExprTree{c.field.Clone(), start}}
+	case "<":
+		return &SimpleExprTree{Op: "<", Ns: []*SimpleExprTree{c.field.Clone(), start}}
+	case "<=":
+		return &SimpleExprTree{Op: "<", Ns: []*SimpleExprTree{c.field.Clone(), end}}
+	}
+	return nil
+}
+
+// yearBetween viết lại year(F) [not] between a and b
+func yearBetween(n *SimpleExprTree) *SimpleExprTree {
+	part, field, ok := datePart(n.Ns[0])
+	if !ok || part != "year" {
+		return nil
+	}
+	for _, v := range n.Ns[1:] {
+		if !(v.Nt == "param" || (v.Nt == "const" && v.Lk == "int")) {
+			return nil
+		}
+	}
+	start, end := yearStart(n.Ns[1], 0), yearStart(n.Ns[2], 1)
+	if start == nil || end == nil {
+		return nil
+	}
+	return rangeNode(field, start, end, strings.EqualFold(n.Op, "not between"))
+}
+
+// stripParens bỏ các nút "()" thừa, parent là nút cha (nil nếu n là gốc)
+func stripParens(n *SimpleExprTree, parent *SimpleExprTree) *SimpleExprTree {
+	for i, c := range n.Ns {
+		n.Ns[i] = stripParens(c, n)
+	}
+	if n.Op == "()" && parenNotNeeded(parent, n.Ns[0]) {
+		return n.Ns[0]
+	}
+	return n
+}
+
+// parenNotNeeded cho biết inner viết không cần ngoặc trong parent mà vẫn đúng cả trong
+// biểu thức lẫn sql (thứ tự ưu tiên của sql khác với biểu thức ở "is null", "^", ...)
+func parenNotNeeded(parent *SimpleExprTree, inner *SimpleExprTree) bool {
+	if parent == nil || parent.Op == "()" || inner.Op == "()" {
+		return true
+	}
+	if parent.Nt == "unary" && parent.Op == "-" && (strings.HasPrefix(inner.V, "-") || (inner.Nt == "unary" && inner.Op == "-")) {
+		// -(-1) viết thành --1 là chú thích trong sql
+		return false
+	}
+	if NodePrecedence(inner) == maxPrecedence {
+		// field, hằng số, hàm, tham số...
+		return true
+	}
+	switch parent.Nt {
+	case "func", "list", "cast":
+		// các đối số cách nhau bởi dấu phẩy
+		return true
+	case "":
+	default:
+		return false
+	}
+	if len(parent.Ns) != 2 {
+		return false
+	}
+	pop, iop := strings.ToLower(parent.Op), strings.ToLower(inner.Op)
+	innerBinary := inner.Nt == "" && len(inner.Ns) == 2
+	switch pop {
+	case "and", "&&":
+		// and, not, so sánh, tính toán đều ưu tiên hơn and
+		return !(innerBinary && (iop == "or" || iop == "||"))
+	case "or", "||":
+		// giữ ngoặc của a or (b and c) cho dễ đọc
+		return !(innerBinary && (iop == "and" || iop == "&&"))
+	case "+", "-":
+		return innerBinary && (iop == "*" || iop == "/" || iop == "%" || (parent.Ns[0] == inner && (iop == "+" || iop == "-")))
+	case "*", "/", "%":
+		return innerBinary && parent.Ns[0] == inner && (iop == "*" || iop == "/" || iop == "%")
+	}
+	if OpPrecedence(pop) == comparePrecedence {
+		return innerBinary && (iop == "+" || iop == "-" || iop == "*" || iop == "/" || iop == "%")
+	}
+	return false
+}
@@ -0,0 +1,450 @@
+package compiler
+
+import (
+	"strings"
+)
+
+// binaryPrecedence là độ ưu tiên của các toán tử hai ngôi, số càng lớn ưu tiên càng cao
+var binaryPrecedence = map[string]int{
+	"or": 1, "||": 1,
+	"and": 2, "&&": 2,
+	"==": 3, "=": 3, "!=": 3, "<>": 3, "<=": 3, ">=": 3, "<": 3, ">": 3, "like": 3, "ilike": 3, "?": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5, "^": 5,
+}
+
+const (
+	// notPrecedence: "not a == b" được hiểu là "not (a == b)"
+	notPrecedence = 3
+	// comparePrecedence là mức của các phép so sánh và "is null"
+	comparePrecedence = 3
+)
+
+// maxPrecedence là độ ưu tiên của toán hạng không cần ngoặc: field, hằng số, hàm, ngoặc, ...
+const maxPrecedence = 10
+
+// NodePrecedence trả về độ ưu tiên của nút khi được viết lại thành biểu thức,
+// dùng để biết khi nào một nút con phải được đặt trong ngoặc
+func NodePrecedence(n *SimpleExprTree) int {
+	op := strings.ToLower(n.Op)
+	switch {
+	case n.Op == "()":
+		return maxPrecedence
+	case n.Nt == "unary":
+		if op == "-" {
+			return maxPrecedence
+		}
+		// "not a and b" là "(not a) and b" nhưng "not a == b" là "not (a == b)"
+		return binaryPrecedence["and"]
+	case n.Nt == "postfix" || n.Nt == "between":
+		return comparePrecedence
+	case n.Nt != "" || len(n.Ns) != 2:
+		return maxPrecedence
+	}
+	return OpPrecedence(op)
+}
+
+// OpPrecedence trả về độ ưu tiên của toán tử hai ngôi op (kể cả in, not in, not like),
+// maxPrecedence nếu op không phải toán tử hai ngôi
+func OpPrecedence(op string) int {
+	op = strings.ToLower(op)
+	if op == "in" || strings.HasPrefix(op, "not ") {
+		return comparePrecedence
+	}
+	if prec, ok := binaryPrecedence[op]; ok {
+		return prec
+	}
+	return maxPrecedence
+}
+
+// parser phân tích danh sách token theo phương pháp precedence climbing
+type parser struct {
+	src    string
+	tokens []Token
+	pos    int
+}
+
+// parseToSimpleExprTree chuyển đổi biểu thức thành cây SimpleExprTree
+func parseToSimpleExprTree(expr string) (*SimpleExprTree, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, newParseError(expr, Token{Kind: TokEOF, Pos: 0}, "expression", "expression cannot be empty")
+	}
+	tokens, err := Tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: expr, tokens: tokens}
+	node, _, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != TokEOF {
+		return nil, unexpectedToken(expr, tok, "operator or end of expression")
+	}
+	return node, nil
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// binaryOp trả về toán tử hai ngôi (đã chuẩn hoá) nếu token là toán tử
+func binaryOp(tok Token) (string, int, bool) {
+	if tok.Kind == TokParam && tok.Text == "?" {
+		// "?" đứng sau toán hạng là toán tử json: json(Data, 'tags') ? 'vip'
+		return "?", binaryPrecedence["?"], true
+	}
+	if tok.Kind != TokOp && tok.Kind != TokKeyword {
+		return "", 0, false
+	}
+	op := tok.Text
+	if tok.Kind == TokKeyword {
+		op = strings.ToLower(op)
+	}
+	prec, ok := binaryPrecedence[op]
+	return op, prec, ok
+}
+
+// parseExpr phân tích biểu thức có toán tử với độ ưu tiên >= minPrec,
+// các toán tử cùng mức được nhóm từ trái sang phải.
+// Giá trị trả về thứ hai là vị trí kết thúc (byte) của biểu thức trong chuỗi gốc
+func (p *parser) parseExpr(minPrec int) (*SimpleExprTree, int, error) {
+	start := p.peek().Pos
+	left, end, err := p.parsePrimary()
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		if tok := p.peek(); isKeyword(tok, "is") && comparePrecedence >= minPrec {
+			left, end, err = p.parseNullTest(left, start)
+			if err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if op := p.peekSetOp(); op != "" && comparePrecedence >= minPrec {
+			left, end, err = p.parseSetOp(op, left, start)
+			if err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		op, prec, ok := binaryOp(p.peek())
+		if !ok || prec < minPrec {
+			return left, end, nil
+		}
+		p.next()
+		right, rightEnd, err := p.parseExpr(prec + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		end = rightEnd
+		left = &SimpleExprTree{
+			V:  p.src[start:end],
+			Op: op,
+			Ns: []*SimpleExprTree{left, right},
+		}
+	}
+}
+
+// parsePrimary phân tích một toán hạng: tham số, hằng số, field, hàm hoặc biểu thức trong ngoặc
+func (p *parser) parsePrimary() (*SimpleExprTree, int, error) {
+	tok := p.next()
+	end := tok.Pos + len(tok.Text)
+	switch tok.Kind {
+	case TokParam:
+		return &SimpleExprTree{V: tok.Text, Nt: "param"}, end, nil
+	case TokString:
+		return &SimpleExprTree{V: tok.Text, Nt: "const", Lk: "string"}, end, nil
+	case TokNumber:
+		node := &SimpleExprTree{V: tok.Text}
+		if kind := numberKind(tok.Text); kind != "" {
+			node.Nt = "const"
+			node.Lk = kind
+		} else if isOperand(tok.Text) {
+			node.Nt = "field"
+		}
+		return node, end, nil
+	case TokIdent:
+		if p.peek().Kind == TokLParen {
+			return p.parseFunction(tok)
+		}
+		if (strings.EqualFold(tok.Text, "date") || strings.EqualFold(tok.Text, "timestamp")) && p.peek().Kind == TokString {
+			return p.parseDateLiteral(tok)
+		}
+		if strings.Contains(tok.Text, ".") {
+			return jsonPath(tok.Text), end, nil
+		}
+		return &SimpleExprTree{V: tok.Text, Nt: "field"}, end, nil
+	case TokOp, TokKeyword:
+		if tok.Text == "!" || tok.Text == "-" || isKeyword(tok, "not") {
+			return p.parseUnary(tok)
+		}
+		if isKeyword(tok, "true") || isKeyword(tok, "false") {
+			return &SimpleExprTree{V: strings.ToLower(tok.Text), Nt: "const", Lk: "bool"}, end, nil
+		}
+		if isKeyword(tok, "null") {
+			return &SimpleExprTree{V: "null", Nt: "const", Lk: "null"}, end, nil
+		}
+		return nil, 0, unexpectedToken(p.src, tok, "operand")
+	case TokLParen:
+		inner, _, err := p.parseExpr(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		closing := p.next()
+		if closing.Kind != TokRParen {
+			return nil, 0, unexpectedToken(p.src, closing, "')'")
+		}
+		end = closing.Pos + 1
+		return &SimpleExprTree{
+			V:  p.src[tok.Pos:end],
+			Op: "()",
+			Ns: []*SimpleExprTree{inner},
+		}, end, nil
+	default:
+		return nil, 0, unexpectedToken(p.src, tok, "operand")
+	}
+}
+
+// parseFunction phân tích lời gọi hàm, name là token tên hàm và token kế tiếp là "("
+func (p *parser) parseFunction(name Token) (*SimpleExprTree, int, error) {
+	p.next()
+	funcNode := &SimpleExprTree{V: name.Text, Nt: "func"}
+	if tok := p.peek(); tok.Kind == TokRParen {
+		p.next()
+		return funcNode, tok.Pos + 1, nil
+	}
+	if tok := p.peek(); tok.Text == "*" && strings.EqualFold(name.Text, "count") && p.tokens[p.pos+1].Kind == TokRParen {
+		// count(*)
+		p.next()
+		closing := p.next()
+		funcNode.Ns = []*SimpleExprTree{{V: "*", Nt: "star"}}
+		return funcNode, closing.Pos + 1, nil
+	}
+	for {
+		arg, _, err := p.parseExpr(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		funcNode.Ns = append(funcNode.Ns, arg)
+		tok := p.next()
+		switch tok.Kind {
+		case TokComma:
+			continue
+		case TokRParen:
+			if strings.EqualFold(funcNode.V, "json") {
+				return p.jsonFunc(name, funcNode, tok)
+			}
+			return funcNode, tok.Pos + 1, nil
+		default:
+			return nil, 0, unexpectedToken(p.src, tok, "',' or ')' in call to "+name.Text)
+		}
+	}
+}
+
+// jsonPath tạo nút "json" từ đường dẫn Data.address.city:
+// Ns[0] là field gốc, các nút sau là các key, Op "->>" cho biết kết quả là text
+func jsonPath(path string) *SimpleExprTree {
+	parts := strings.Split(path, ".")
+	node := &SimpleExprTree{
+		V:  path,
+		Op: "->>",
+		Nt: "json",
+		Ns: []*SimpleExprTree{{V: parts[0], Nt: "field"}},
+	}
+	for _, key := range parts[1:] {
+		node.Ns = append(node.Ns, &SimpleExprTree{V: Quote(key), Nt: "const", Lk: "string"})
+	}
+	return node
+}
+
+// jsonFunc đổi lời gọi json(Data, 'k1', 'k2') thành nút "json" với Op "->" (kết quả là json),
+// closing là token ")" kết thúc lời gọi
+func (p *parser) jsonFunc(name Token, funcNode *SimpleExprTree, closing Token) (*SimpleExprTree, int, error) {
+	if len(funcNode.Ns) < 2 {
+		return nil, 0, newParseError(p.src, closing, "json key", "function json requires a json value and at least one key")
+	}
+	end := closing.Pos + 1
+	return &SimpleExprTree{
+		V:  p.src[name.Pos:end],
+		Op: "->",
+		Nt: "json",
+		Ns: funcNode.Ns,
+	}, end, nil
+}
+
+// parseUnary phân tích toán tử một ngôi "!", "not" hoặc "-", tok là token toán tử đã đọc
+func (p *parser) parseUnary(tok Token) (*SimpleExprTree, int, error) {
+	op := strings.ToLower(tok.Text)
+	var operand *SimpleExprTree
+	var end int
+	var err error
+	if op == "-" {
+		// Dấu trừ một ngôi gắn chặt hơn mọi toán tử hai ngôi
+		operand, end, err = p.parsePrimary()
+	} else {
+		operand, end, err = p.parseExpr(notPrecedence)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if op == "-" && operand.Nt == "const" && (operand.Lk == "int" || operand.Lk == "float") {
+		// Số âm là một hằng số, không phải phép trừ; - -1 là 1, không được viết thành --1
+		// (chú thích trong sql)
+		return &SimpleExprTree{V: negateNumber(operand.V), Nt: "const", Lk: operand.Lk}, end, nil
+	}
+	return &SimpleExprTree{
+		V:  p.src[tok.Pos:end],
+		Op: op,
+		Nt: "unary",
+		Ns: []*SimpleExprTree{operand},
+	}, end, nil
+}
+
+// parseDateLiteral phân tích hằng date '2024-01-31' hoặc timestamp '2024-01-31 10:00:00',
+// kind là token date/timestamp đã đọc và token kế tiếp là chuỗi
+func (p *parser) parseDateLiteral(kind Token) (*SimpleExprTree, int, error) {
+	tok := p.next()
+	lk := strings.ToLower(kind.Text)
+	value, err := Unquote(tok.Text)
+	if err != nil {
+		return nil, 0, newParseError(p.src, tok, "", "invalid %s literal %s", lk, tok.Text)
+	}
+	if _, err := parseDateLiteral(lk, value); err != nil {
+		return nil, 0, newParseError(p.src, tok, "", "invalid %s literal %s", lk, tok.Text)
+	}
+	return &SimpleExprTree{V: lk + " " + tok.Text, Nt: "const", Lk: lk}, tok.Pos + len(tok.Text), nil
+}
+
+// parseNullTest phân tích "is null" hoặc "is not null" đứng sau toán hạng left
+func (p *parser) parseNullTest(left *SimpleExprTree, start int) (*SimpleExprTree, int, error) {
+	p.next()
+	op := "is null"
+	if isKeyword(p.peek(), "not") {
+		p.next()
+		op = "is not null"
+	}
+	tok := p.next()
+	if !isKeyword(tok, "null") {
+		return nil, 0, unexpectedToken(p.src, tok, "'null'")
+	}
+	end := tok.Pos + len(tok.Text)
+	return &SimpleExprTree{
+		V:  p.src[start:end],
+		Op: op,
+		Nt: "postfix",
+		Ns: []*SimpleExprTree{left},
+	}, end, nil
+}
+
+// peekSetOp trả về "in", "not in", "between", "not between", "not like" hoặc "not ilike"
+// nếu các token kế tiếp là một trong các toán tử này, ngược lại trả về ""
+func (p *parser) peekSetOp() string {
+	tok := p.peek()
+	if isKeyword(tok, "in") || isKeyword(tok, "between") {
+		return strings.ToLower(tok.Text)
+	}
+	if isKeyword(tok, "not") && p.pos+1 < len(p.tokens) {
+		after := p.tokens[p.pos+1]
+		if isKeyword(after, "in") || isKeyword(after, "between") || isKeyword(after, "like") || isKeyword(after, "ilike") {
+			return "not " + strings.ToLower(after.Text)
+		}
+	}
+	return ""
+}
+
+// parseSetOp phân tích vế phải của in/not in, between/not between, not like và not ilike,
+// left là toán hạng bên trái đã được phân tích bắt đầu tại vị trí start
+func (p *parser) parseSetOp(op string, left *SimpleExprTree, start int) (*SimpleExprTree, int, error) {
+	p.next()
+	if strings.HasPrefix(op, "not ") {
+		p.next()
+	}
+	switch op {
+	case "in", "not in":
+		// "in ?" nhận một slice, "in (?, ?)" nhận danh sách giá trị
+		var right *SimpleExprTree
+		var end int
+		var err error
+		if p.peek().Kind == TokLParen {
+			right, end, err = p.parseList()
+		} else {
+			right, end, err = p.parsePrimary()
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return &SimpleExprTree{
+			V:  p.src[start:end],
+			Op: op,
+			Ns: []*SimpleExprTree{left, right},
+		}, end, nil
+	case "between", "not between":
+		low, _, err := p.parseExpr(comparePrecedence + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		tok := p.next()
+		if !isKeyword(tok, "and") {
+			return nil, 0, unexpectedToken(p.src, tok, "'and' in "+op)
+		}
+		high, end, err := p.parseExpr(comparePrecedence + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &SimpleExprTree{
+			V:  p.src[start:end],
+			Op: op,
+			Nt: "between",
+			Ns: []*SimpleExprTree{left, low, high},
+		}, end, nil
+	default:
+		right, end, err := p.parseExpr(comparePrecedence + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &SimpleExprTree{
+			V:  p.src[start:end],
+			Op: op,
+			Ns: []*SimpleExprTree{left, right},
+		}, end, nil
+	}
+}
+
+// parseList phân tích danh sách giá trị "(a, b, ...)" của toán tử in
+func (p *parser) parseList() (*SimpleExprTree, int, error) {
+	open := p.next()
+	list := &SimpleExprTree{Nt: "list"}
+	for {
+		item, _, err := p.parseExpr(comparePrecedence + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		list.Ns = append(list.Ns, item)
+		tok := p.next()
+		switch tok.Kind {
+		case TokComma:
+			continue
+		case TokRParen:
+			end := tok.Pos + 1
+			list.V = p.src[open.Pos:end]
+			return list, end, nil
+		default:
+			return nil, 0, unexpectedToken(p.src, tok, "',' or ')' in list")
+		}
+	}
+}
+
+// isKeyword kiểm tra token có phải từ khoá word hay không (không phân biệt hoa thường)
+func isKeyword(tok Token, word string) bool {
+	return tok.Kind == TokKeyword && strings.EqualFold(tok.Text, word)
+}
@@ -0,0 +1,294 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// SchemaColumn là một cột của entity: tên field Go và tên cột trong database
+type SchemaColumn struct {
+	Field  string // Tên field Go, ví dụ "CreatedOn"
+	Name   string // Tên cột trong database, ví dụ "created_on" hoặc giá trị của tag column:
+	DbType string // Kiểu dữ liệu trong tag type: (nếu có)
+}
+
+// Schema mô tả các cột của một entity, dùng để biên dịch biểu thức theo metadata của entity
+type Schema struct {
+	Name    string // Tên kiểu Go của entity
+	Table   string // Tên bảng
+	Columns []SchemaColumn
+	// Các quan hệ tới entity khác, thêm bằng AddRelation
+	Relations []*SchemaRelation
+	// Ghi kèm tên bảng cho mọi cột, dùng cho các phần khác của câu truy vấn có join
+	Qualify bool
+
+	qualified     *Schema
+	qualifiedOnce sync.Once
+
+	id atomic.Uint64
+
+	byField map[string]*SchemaColumn
+	byName  map[string]*SchemaColumn
+	byLower map[string]*SchemaColumn
+}
+
+// NewSchema tạo Schema từ danh sách cột
+func NewSchema(name string, table string, columns []SchemaColumn) *Schema {
+	s := &Schema{
+		Name:    name,
+		Table:   table,
+		Columns: columns,
+		byField: make(map[string]*SchemaColumn),
+		byName:  make(map[string]*SchemaColumn),
+		byLower: make(map[string]*SchemaColumn),
+	}
+	for i := range s.Columns {
+		col := &s.Columns[i]
+		s.byField[col.Field] = col
+		s.byName[col.Name] = col
+		for _, key := range []string{col.Field, col.Name} {
+			if _, ok := s.byLower[strings.ToLower(key)]; !ok {
+				s.byLower[strings.ToLower(key)] = col
+			}
+		}
+	}
+	return s
+}
+
+// Column tìm cột theo tên field Go hoặc tên cột trong database,
+// ưu tiên khớp chính xác rồi mới đến khớp không phân biệt hoa thường
+func (s *Schema) Column(name string) (*SchemaColumn, bool) {
+	if col, ok := s.byField[name]; ok {
+		return col, true
+	}
+	if col, ok := s.byName[name]; ok {
+		return col, true
+	}
+	col, ok := s.byLower[strings.ToLower(name)]
+	return col, ok
+}
+
+// ResolveField đổi nút field thành nút "column" mang tên cột trong database,
+// trả về lỗi nếu entity không có field này
+func (s *Schema) ResolveField(n *SimpleExprTree) error {
+	col, ok := s.Column(n.V)
+	if !ok {
+		return fmt.Errorf("unknown field '%s' in %s", n.V, s.Name)
+	}
+	n.V = col.Name
+	n.Nt = "column"
+	return nil
+}
+
+// IsJSON cho biết cột có kiểu json hoặc jsonb (theo tag type:)
+func (c *SchemaColumn) IsJSON() bool {
+	t := strings.ToLower(c.DbType)
+	return t == "json" || t == "jsonb"
+}
+
+// ResolveJSON kiểm tra nút "json" (Data.address.city hoặc json(Data, 'tags')):
+// nếu giá trị gốc là field thì field phải là cột json/jsonb của entity
+func (s *Schema) ResolveJSON(n *SimpleExprTree) error {
+	base := n.Ns[0]
+	if base.Nt != "field" {
+		return nil
+	}
+	col, ok := s.Column(base.V)
+	if !ok {
+		return fmt.Errorf("unknown field '%s' in %s", base.V, s.Name)
+	}
+	if !col.IsJSON() {
+		return fmt.Errorf("field '%s' in %s is not a json column", base.V, s.Name)
+	}
+	return s.ResolveField(base)
+}
+
+// SchemaRelation là quan hệ của entity tới một entity khác (field có tag foreignKey),
+// điều kiện nối là <bảng liên quan>.RefColumn = <bảng này>.Column
+type SchemaRelation struct {
+	Field     string  // Tên field Go, ví dụ "User"
+	Target    *Schema // Schema của entity liên quan
+	Column    string  // Cột của entity này trong điều kiện nối, ví dụ "id"
+	RefColumn string  // Cột của entity liên quan trong điều kiện nối, ví dụ "department_id"
+	Many      bool    // Quan hệ has-many (field là slice)
+}
+
+// Join là một bảng được nối vào câu truy vấn vì biểu thức dùng field của entity liên quan
+// như User.Username. Alias là đường dẫn quan hệ tính từ bảng gốc ("emps__user",
+// "emps__works__user") nên cùng một đường dẫn luôn cho cùng một alias
+type Join struct {
+	Table string          // Tên bảng liên quan
+	Alias string          // Tên đặt lại của bảng
+	On    *SimpleExprTree // Điều kiện nối: so sánh hai nút "column"
+}
+
+// Qualified trả về bản sao của schema có Qualify = true (luôn là cùng một bản sao),
+// dùng khi điều kiện đã thêm join nên ORDER BY, SELECT... cũng phải ghi kèm tên bảng
+func (s *Schema) Qualified() *Schema {
+	if s.Qualify {
+		return s
+	}
+	s.qualifiedOnce.Do(func() {
+		q := NewSchema(s.Name, s.Table, s.Columns)
+		q.Relations = s.Relations
+		q.Qualify = true
+		s.qualified = q
+	})
+	return s.qualified
+}
+
+// schemaIDs là số định danh cuối cùng đã cấp cho một schema
+var schemaIDs atomic.Uint64
+
+// ID trả về số định danh của schema, duy nhất trong process và không bao giờ được dùng lại
+// (khác với địa chỉ của một schema đã bị thu hồi), dùng làm khoá của cache
+func (s *Schema) ID() uint64 {
+	if id := s.id.Load(); id != 0 {
+		return id
+	}
+	s.id.CompareAndSwap(0, schemaIDs.Add(1))
+	return s.id.Load()
+}
+
+// AddRelation thêm quan hệ vào schema, chỉ gọi khi đang tạo schema
+func (s *Schema) AddRelation(rel *SchemaRelation) {
+	s.Relations = append(s.Relations, rel)
+}
+
+// Relation tìm quan hệ theo tên field Go, không phân biệt hoa thường
+func (s *Schema) Relation(name string) (*SchemaRelation, bool) {
+	for _, rel := range s.Relations {
+		if rel.Field == name {
+			return rel, true
+		}
+	}
+	for _, rel := range s.Relations {
+		if strings.EqualFold(rel.Field, name) {
+			return rel, true
+		}
+	}
+	return nil, false
+}
+
+// relationPath trả về quan hệ ở đầu đường dẫn của nút json dạng A.b.c, nil nếu không phải
+func (s *Schema) relationPath(n *SimpleExprTree) *SchemaRelation {
+	if n.Nt != "json" || n.Op != "->>" || n.Ns[0].Nt != "field" {
+		return nil
+	}
+	rel, _ := s.Relation(n.Ns[0].V)
+	return rel
+}
+
+// UsesRelations cho biết biểu thức có dùng field của entity liên quan hay không,
+// khi có thì các cột của bảng gốc phải ghi kèm tên bảng để không trùng với bảng được nối
+func (s *Schema) UsesRelations(n *SimpleExprTree) bool {
+	if s.relationPath(n) != nil {
+		return true
+	}
+	for _, c := range n.Ns {
+		if s.UsesRelations(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePath đổi nút json dạng User.Username (hoặc Works.User.Username, Info.Data.city)
+// thành cột của bảng liên quan và thêm các join cần thiết vào joins (mỗi alias một lần).
+// alias là tên của bảng entity này trong câu truy vấn (tên bảng, hoặc alias trong truy vấn con).
+// Trả về false nếu nút không bắt đầu bằng một quan hệ
+func (s *Schema) ResolvePath(n *SimpleExprTree, alias string, joins *[]Join) (bool, error) {
+	rel := s.relationPath(n)
+	if rel == nil {
+		return false, nil
+	}
+	path := n.Ns[0].V
+	cur := s
+	for i := 1; ; i++ {
+		if rel.Many {
+			return true, fmt.Errorf("'%s' of %s is a has-many relation and cannot be used in the path %s, use any(%s, ...)", rel.Field, cur.Name, n.String(), rel.Field)
+		}
+		child := alias + "__" + ToSnakeCase(rel.Field)
+		addJoin(joins, Join{
+			Table: rel.Target.Table,
+			Alias: child,
+			On: &SimpleExprTree{Op: "==", Ns: []*SimpleExprTree{
+				{V: rel.RefColumn, Nt: "column", Tb: child},
+				{V: rel.Column, Nt: "column", Tb: alias},
+			}},
+		})
+		cur, alias = rel.Target, child
+		if i >= len(n.Ns) {
+			return true, fmt.Errorf("path %s must end with a field of %s", n.String(), cur.Name)
+		}
+		name, err := n.Ns[i].LiteralText()
+		if err != nil {
+			return true, err
+		}
+		path += "." + name
+		if r, ok := cur.Relation(name); ok {
+			rel = r
+			continue
+		}
+		col, ok := cur.Column(name)
+		if !ok {
+			return true, fmt.Errorf("unknown field '%s' in %s", path, s.Name)
+		}
+		colNode := &SimpleExprTree{V: col.Name, Nt: "column", Tb: alias}
+		if i == len(n.Ns)-1 {
+			*n = *colNode
+			return true, nil
+		}
+		// phần còn lại của đường dẫn là json trong cột này
+		if !col.IsJSON() {
+			return true, fmt.Errorf("field '%s' in %s is not a json column", path, s.Name)
+		}
+		n.Ns = append([]*SimpleExprTree{colNode}, n.Ns[i+1:]...)
+		return true, nil
+	}
+}
+
+// IsQuantifier cho biết name là any, all hoặc none: điều kiện trên các bản ghi của một quan hệ
+// như any(Emps, year(StartDate) == 2024)
+func IsQuantifier(name string) bool {
+	switch strings.ToLower(name) {
+	case "any", "all", "none":
+		return true
+	}
+	return false
+}
+
+// QuantifierRelation kiểm tra nút any/all/none: đối số đầu là tên quan hệ của entity này,
+// đối số thứ hai (nếu có) là điều kiện trên entity liên quan. all bắt buộc có điều kiện
+func (s *Schema) QuantifierRelation(n *SimpleExprTree) (*SchemaRelation, error) {
+	fn := strings.ToLower(n.V)
+	minArgs := 1
+	if fn == "all" {
+		minArgs = 2
+	}
+	if len(n.Ns) < minArgs || len(n.Ns) > 2 {
+		if minArgs == 2 {
+			return nil, fmt.Errorf("invalid function call: function %s requires 2 argument(s)", fn)
+		}
+		return nil, fmt.Errorf("invalid function call: function %s requires 1 to 2 arguments", fn)
+	}
+	if n.Ns[0].Nt != "field" {
+		return nil, fmt.Errorf("invalid function call: the first argument of %s must be a relation of %s", fn, s.Name)
+	}
+	rel, ok := s.Relation(n.Ns[0].V)
+	if !ok {
+		return nil, fmt.Errorf("invalid function call: '%s' is not a relation of %s", n.Ns[0].V, s.Name)
+	}
+	return rel, nil
+}
+
+func addJoin(joins *[]Join, j Join) {
+	for _, x := range *joins {
+		if x.Alias == j.Alias {
+			return
+		}
+	}
+	*joins = append(*joins, j)
+}
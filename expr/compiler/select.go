@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"strings"
+)
+
+// OrderItem là một phần của ORDER BY: biểu thức và chiều sắp xếp
+type OrderItem struct {
+	Expr *SimpleExprTree
+	Desc bool
+}
+
+// SelectItem là một cột của danh sách select: biểu thức và tên đặt lại (có thể rỗng)
+type SelectItem struct {
+	Expr  *SimpleExprTree
+	Alias string
+}
+
+// ParseOrderBy phân tích chuỗi sắp xếp như "CreatedOn desc, len(Name) asc".
+// Tham số ("?", "@name") không được phép vì ORDER BY không nhận tham số
+func ParseOrderBy(spec string) ([]OrderItem, error) {
+	p, err := newListParser(spec)
+	if err != nil {
+		return nil, err
+	}
+	var ret []OrderItem
+	for {
+		node, err := p.parseListItem()
+		if err != nil {
+			return nil, err
+		}
+		item := OrderItem{Expr: node}
+		if tok := p.peek(); isWord(tok, "asc") || isWord(tok, "desc") {
+			p.next()
+			item.Desc = strings.EqualFold(tok.Text, "desc")
+		}
+		ret = append(ret, item)
+		if done, err := p.endOfItem("'asc', 'desc', ',' or end of expression"); done || err != nil {
+			return ret, err
+		}
+	}
+}
+
+// ParseSelectList phân tích danh sách cột như "ID, Name, year(CreatedOn) as Year",
+// tên đặt lại viết sau "as" hoặc ngay sau biểu thức. Tham số không được phép
+func ParseSelectList(spec string) ([]SelectItem, error) {
+	p, err := newListParser(spec)
+	if err != nil {
+		return nil, err
+	}
+	var ret []SelectItem
+	for {
+		node, err := p.parseListItem()
+		if err != nil {
+			return nil, err
+		}
+		item := SelectItem{Expr: node}
+		if isWord(p.peek(), "as") {
+			p.next()
+			tok := p.next()
+			if tok.Kind != TokIdent || strings.Contains(tok.Text, ".") {
+				return nil, unexpectedToken(p.src, tok, "alias")
+			}
+			item.Alias = tok.Text
+		} else if tok := p.peek(); tok.Kind == TokIdent && !strings.Contains(tok.Text, ".") {
+			p.next()
+			item.Alias = tok.Text
+		}
+		ret = append(ret, item)
+		if done, err := p.endOfItem("alias, ',' or end of expression"); done || err != nil {
+			return ret, err
+		}
+	}
+}
+
+// ParseExprList phân tích danh sách biểu thức cách nhau bởi dấu phẩy như "DepartmentID, year(CreatedOn)"
+// (dùng cho GROUP BY). Tham số không được phép
+func ParseExprList(spec string) ([]*SimpleExprTree, error) {
+	p, err := newListParser(spec)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*SimpleExprTree
+	for {
+		node, err := p.parseListItem()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, node)
+		if done, err := p.endOfItem("',' or end of expression"); done || err != nil {
+			return ret, err
+		}
+	}
+}
+
+// ReplaceAliases thay các field trùng tên đặt lại (alias) của danh sách select bằng bản sao
+// biểu thức của alias đó, ví dụ "Year" thành year(CreatedOn), vì GROUP BY và HAVING
+// không dùng được alias một cách nhất quán
+func ReplaceAliases(n *SimpleExprTree, items []SelectItem) *SimpleExprTree {
+	if n.Nt == "field" {
+		for _, item := range items {
+			if item.Alias != "" && strings.EqualFold(item.Alias, n.V) {
+				return item.Expr.Clone()
+			}
+		}
+		return n
+	}
+	for i, c := range n.Ns {
+		n.Ns[i] = ReplaceAliases(c, items)
+	}
+	return n
+}
+
+func newListParser(spec string) (*parser, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, newParseError(spec, Token{Kind: TokEOF, Pos: 0}, "expression", "expression cannot be empty")
+	}
+	tokens, err := Tokenize(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{src: spec, tokens: tokens}, nil
+}
+
+// parseListItem phân tích một biểu thức của danh sách và từ chối tham số trong đó
+func (p *parser) parseListItem() (*SimpleExprTree, error) {
+	tok := p.peek()
+	node, _, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if param := findParam(node); param != nil {
+		return nil, newParseError(p.src, tok, "", "parameter %s is not allowed here", param.V)
+	}
+	return node, nil
+}
+
+// findParam trả về nút tham số đầu tiên trong cây, nil nếu không có
+func findParam(n *SimpleExprTree) *SimpleExprTree {
+	if n.Nt == "param" {
+		return n
+	}
+	for _, c := range n.Ns {
+		if ret := findParam(c); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// endOfItem đọc dấu phẩy giữa các phần tử, trả về true khi đã hết danh sách
+func (p *parser) endOfItem(expected string) (bool, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case TokEOF:
+		return true, nil
+	case TokComma:
+		return false, nil
+	default:
+		return true, unexpectedToken(p.src, tok, expected)
+	}
+}
+
+// isWord so sánh token tên (không phải từ khoá) với word, không phân biệt hoa thường
+func isWord(tok Token, word string) bool {
+	return tok.Kind == TokIdent && strings.EqualFold(tok.Text, word)
+}
@@ -0,0 +1,181 @@
+package expr
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// Dialect implements IExpr for one database on top of its resolver: caching, policy,
+// optimisation and the order by / select / aggregate lists are the same for every database.
+// A dialect package embeds a *Dialect, registers its functions and sets its resolver.
+type Dialect struct {
+	IBaseExpr
+	name       string
+	funcs      *FuncRegistry
+	quoteAlias func(name string) string
+
+	optionsLock    sync.RWMutex
+	policy         *Policy
+	noOptimize     bool
+	options        map[string]string
+	optionsVersion int
+}
+
+// NewDialect creates the dialect named name (the key of its sql in the compiled expression cache),
+// quoteAlias quotes the aliases of select lists
+func NewDialect(name string, quoteAlias func(name string) string) *Dialect {
+	return &Dialect{
+		IBaseExpr:  NewBaseExpr(),
+		name:       name,
+		funcs:      NewFuncRegistry(),
+		quoteAlias: quoteAlias,
+	}
+}
+
+func (d *Dialect) Name() string {
+	return d.name
+}
+
+func (d *Dialect) CompileExpr(exprStr string) (string, error) {
+	return d.CompileExprWithSchema(exprStr, nil)
+}
+
+func (d *Dialect) CompileExprWithSchema(exprStr string, schema *compiler.Schema) (string, error) {
+	ret, err := d.CompileCond(exprStr, schema)
+	if err != nil {
+		return "", err
+	}
+	return ret.SQL, nil
+}
+
+// cacheKey is the dialect part of the cache key, it changes when a function is registered,
+// a policy or an option is set or the optimisation is switched
+func (d *Dialect) cacheKey() string {
+	d.optionsLock.RLock()
+	defer d.optionsLock.RUnlock()
+	return fmt.Sprintf("%s#%d#%d", d.name, d.funcs.Version(), d.optionsVersion)
+}
+
+func (d *Dialect) SetPolicy(policy *Policy) {
+	d.optionsLock.Lock()
+	defer d.optionsLock.Unlock()
+	d.policy = policy
+	d.optionsVersion++
+}
+
+func (d *Dialect) GetPolicy() *Policy {
+	d.optionsLock.RLock()
+	defer d.optionsLock.RUnlock()
+	return d.policy
+}
+
+func (d *Dialect) SetOptimize(enabled bool) {
+	d.optionsLock.Lock()
+	defer d.optionsLock.Unlock()
+	d.noOptimize = !enabled
+	d.optionsVersion++
+}
+
+func (d *Dialect) GetOptimize() bool {
+	d.optionsLock.RLock()
+	defer d.optionsLock.RUnlock()
+	return !d.noOptimize
+}
+
+// SetOption sets an option of the dialect package, such as the text search configuration
+// of postgres, the sql compiled with the previous value is not reused
+func (d *Dialect) SetOption(name string, value string) {
+	d.optionsLock.Lock()
+	defer d.optionsLock.Unlock()
+	if d.options == nil {
+		d.options = make(map[string]string)
+	}
+	d.options[name] = value
+	d.optionsVersion++
+}
+
+// GetOption returns the option name, "" when it is not set
+func (d *Dialect) GetOption(name string) string {
+	d.optionsLock.RLock()
+	defer d.optionsLock.RUnlock()
+	return d.options[name]
+}
+
+func (d *Dialect) CompileCond(exprStr string, schema *compiler.Schema) (*CompiledExpr, error) {
+	return CompileCached(d.cacheKey(), exprStr, schema, func() (*CompiledExpr, error) {
+		if err := d.GetPolicy().CheckLength(exprStr); err != nil {
+			return nil, fmt.Errorf("error compiling expression %q: %w", exprStr, err)
+		}
+		n, err := d.Compile(exprStr)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling expression %q: %w", exprStr, err)
+		}
+		if err := d.GetPolicy().Check(exprStr, schema, n); err != nil {
+			return nil, fmt.Errorf("error compiling expression %q: %w", exprStr, err)
+		}
+		if d.GetOptimize() {
+			n = compiler.Optimize(n)
+		}
+		r, err := d.GetCompiledCond(n, schema)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling expression %q: %w", exprStr, err)
+		}
+		return r, nil
+	})
+}
+
+func (d *Dialect) CompileOrderBy(orderBy string, schema *compiler.Schema) (string, error) {
+	ret, err := CompileCached(d.cacheKey()+"/order", orderBy, schema, func() (*CompiledExpr, error) {
+		if err := d.GetPolicy().CheckLength(orderBy); err != nil {
+			return nil, fmt.Errorf("error compiling order by %q: %w", orderBy, err)
+		}
+		items, err := compiler.ParseOrderBy(orderBy)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling order by %q: %w", orderBy, err)
+		}
+		sql, err := OrderBySQL(d, orderBy, items, schema)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling order by %q: %w", orderBy, err)
+		}
+		return &CompiledExpr{SQL: sql}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return ret.SQL, nil
+}
+
+func (d *Dialect) CompileSelect(selects string, schema *compiler.Schema) (string, error) {
+	ret, err := CompileCached(d.cacheKey()+"/select", selects, schema, func() (*CompiledExpr, error) {
+		if err := d.GetPolicy().CheckLength(selects); err != nil {
+			return nil, fmt.Errorf("error compiling select %q: %w", selects, err)
+		}
+		items, err := compiler.ParseSelectList(selects)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling select %q: %w", selects, err)
+		}
+		sql, err := SelectSQL(d, selects, items, schema, d.quoteAlias)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling select %q: %w", selects, err)
+		}
+		return &CompiledExpr{SQL: sql}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return ret.SQL, nil
+}
+
+func (d *Dialect) CompileAggregate(selects string, groupBy string, having string, schema *compiler.Schema) (*CompiledAggregate, error) {
+	return AggregateSQL(d, selects, groupBy, having, schema, d.quoteAlias)
+}
+
+func (d *Dialect) RegisterFunc(name string, minArgs int, maxArgs int, translate FuncTranslator) {
+	d.funcs.Register(name, minArgs, maxArgs, translate)
+}
+
+func (d *Dialect) GetFuncRegistry() *FuncRegistry {
+	return d.funcs
+}
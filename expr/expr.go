@@ -1,17 +1,34 @@
 package expr
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/nttlong/regorm/expr/compiler"
 )
 
 type IBaseExpr interface {
 	Compile(cond string) (*compiler.SimpleExprTree, error)
 	GetStrExpr(node *compiler.SimpleExprTree) (string, error)
+	// like GetStrExpr, field names are resolved to columns of schema first
+	GetStrExprWithSchema(node *compiler.SimpleExprTree, schema *compiler.Schema) (string, error)
+	// like GetStrExprWithSchema (schema may be nil), named parameters are rendered as "?"
+	// and listed in the result in the order they appear. Fields of related entities
+	// (User.Username) become columns of joined tables listed in the result
+	GetCompiledExpr(node *compiler.SimpleExprTree, schema *compiler.Schema) (*CompiledExpr, error)
+	// like GetCompiledExpr for a condition (where, having), the root of node and of the
+	// conditions of any/all/none are first given to the condition resolver
+	GetCompiledCond(node *compiler.SimpleExprTree, schema *compiler.Schema) (*CompiledExpr, error)
 	SetResolver(resolver func(node *compiler.SimpleExprTree) error)
+	// set the resolver called with the root of every condition before the other nodes are
+	// resolved, for databases where a condition is not any expression (sql server needs
+	// "active = 1" instead of "active"). It is optional
+	SetCondResolver(resolver func(node *compiler.SimpleExprTree) error)
 }
 
 type BaseExpr struct {
-	resolver func(node *compiler.SimpleExprTree) error
+	resolver     func(node *compiler.SimpleExprTree) error
+	condResolver func(node *compiler.SimpleExprTree) error
 }
 
 func (b *BaseExpr) Compile(cond string) (*compiler.SimpleExprTree, error) {
@@ -21,6 +38,18 @@ func (b *BaseExpr) SetResolver(resolver func(node *compiler.SimpleExprTree) erro
 	b.resolver = resolver
 }
 
+func (b *BaseExpr) SetCondResolver(resolver func(node *compiler.SimpleExprTree) error) {
+	b.condResolver = resolver
+}
+
+// resolveCond gives the root of a condition to the condition resolver (if any)
+func (b *BaseExpr) resolveCond(node *compiler.SimpleExprTree) error {
+	if b.condResolver == nil {
+		return nil
+	}
+	return b.condResolver(node)
+}
+
 func (b *BaseExpr) GetStrExpr(node *compiler.SimpleExprTree) (string, error) {
 	if b.resolver == nil {
 		panic("resolver is not set, please call SetResolver() first")
@@ -28,14 +57,212 @@ func (b *BaseExpr) GetStrExpr(node *compiler.SimpleExprTree) (string, error) {
 	return compiler.Resolve(node, b.resolver)
 }
 
-var bBaseExpr IBaseExpr = &BaseExpr{}
+func (b *BaseExpr) GetStrExprWithSchema(node *compiler.SimpleExprTree, schema *compiler.Schema) (string, error) {
+	ret, err := b.GetCompiledExpr(node, schema)
+	if err != nil {
+		return "", err
+	}
+	return ret.SQL, nil
+}
+
+func (b *BaseExpr) GetCompiledCond(node *compiler.SimpleExprTree, schema *compiler.Schema) (*CompiledExpr, error) {
+	if err := b.resolveCond(node); err != nil {
+		return nil, err
+	}
+	return b.GetCompiledExpr(node, schema)
+}
+
+func (b *BaseExpr) GetCompiledExpr(node *compiler.SimpleExprTree, schema *compiler.Schema) (*CompiledExpr, error) {
+	if b.resolver == nil {
+		panic("resolver is not set, please call SetResolver() first")
+	}
+	ret := &CompiledExpr{}
+	var joins []compiler.Join
+	alias := ""
+	if schema != nil {
+		alias = schema.Table
+	}
+	// with joins the columns of the entity are qualified by its table
+	qualify := schema != nil && (schema.Qualify || schema.UsesRelations(node))
+	sql, err := b.compileNode(node, schema, alias, qualify, ret, &joins)
+	if err != nil {
+		return nil, err
+	}
+	ret.SQL = sql
+	ret.doneParams()
+	if ret.Joins, err = b.joinsSQL(joins); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// compileNode renders node for the entity of schema named alias in the query,
+// parameters are added to ret.Params and the joins needed by relation paths to joins
+func (b *BaseExpr) compileNode(node *compiler.SimpleExprTree, schema *compiler.Schema, alias string, qualify bool, ret *CompiledExpr, joins *[]compiler.Join) (string, error) {
+	return compiler.Resolve(node, func(n *compiler.SimpleExprTree) error {
+		if n.Nt == "field" && schema != nil {
+			if err := schema.ResolveField(n); err != nil {
+				return err
+			}
+			if qualify {
+				n.Tb = alias
+			}
+		}
+		if n.Nt == "json" && schema != nil {
+			isPath, err := schema.ResolvePath(n, alias, joins)
+			if err != nil {
+				return err
+			}
+			if !isPath {
+				if err := schema.ResolveJSON(n); err != nil {
+					return err
+				}
+				if qualify && n.Ns[0].Nt == "column" {
+					n.Ns[0].Tb = alias
+				}
+			}
+		}
+		if n.Nt == "func" && compiler.IsQuantifier(n.V) {
+			return b.compileQuantifier(n, schema, alias, ret)
+		}
+		if n.Nt == "param" {
+			// the resolver is called in the order nodes are rendered,
+			// so Params follows the order of "?" in the sql
+			ret.addParam(n)
+			n.V = "?"
+		}
+		return b.resolver(n)
+	})
+}
+
+// compileQuantifier turns any(Emps, cond), all(Emps, cond) and none(Emps, cond) into a
+// correlated subquery over the related table, named <alias>__<relation> in the subquery:
+//
+//	any:  EXISTS (SELECT 1 FROM emps depts__emps WHERE depts__emps.department_id = depts.id AND (cond))
+//	none: NOT EXISTS (... AND (cond))
+//	all:  NOT EXISTS (... AND CASE WHEN (cond) THEN 1 ELSE 0 END = 0)
+//
+// all treats a NULL condition as false, like a WHERE clause. The node becomes a "raw" leaf
+// holding the sql.
+func (b *BaseExpr) compileQuantifier(n *compiler.SimpleExprTree, schema *compiler.Schema, alias string, ret *CompiledExpr) error {
+	fn := strings.ToLower(n.V)
+	if schema == nil {
+		return fmt.Errorf("%s() requires the schema of the entity", fn)
+	}
+	rel, err := schema.QuantifierRelation(n)
+	if err != nil {
+		return err
+	}
+	sub := alias + "__" + compiler.ToSnakeCase(rel.Field)
+	where, err := compiler.Resolve(&compiler.SimpleExprTree{Op: "==", Ns: []*compiler.SimpleExprTree{
+		{V: rel.RefColumn, Nt: "column", Tb: sub},
+		{V: rel.Column, Nt: "column", Tb: alias},
+	}}, b.resolver)
+	if err != nil {
+		return err
+	}
+	var joins []compiler.Join
+	if len(n.Ns) == 2 {
+		if err := b.resolveCond(n.Ns[1]); err != nil {
+			return err
+		}
+		cond, err := b.compileNode(n.Ns[1], rel.Target, sub, true, ret, &joins)
+		if err != nil {
+			return err
+		}
+		if fn == "all" {
+			where += " AND CASE WHEN (" + cond + ") THEN 1 ELSE 0 END = 0"
+		} else {
+			where += " AND (" + cond + ")"
+		}
+	}
+	from, err := b.joinSQL(compiler.Join{Table: rel.Target.Table, Alias: sub})
+	if err != nil {
+		return err
+	}
+	subJoins, err := b.joinsSQL(joins)
+	if err != nil {
+		return err
+	}
+	for _, j := range subJoins {
+		from += " " + j
+	}
+	sql := "EXISTS (SELECT 1 FROM " + from + " WHERE " + where + ")"
+	if fn != "any" {
+		sql = "NOT " + sql
+	}
+	*n = compiler.SimpleExprTree{V: sql, Nt: "raw"}
+	return nil
+}
+
+func (b *BaseExpr) joinsSQL(joins []compiler.Join) ([]string, error) {
+	var ret []string
+	for _, j := range joins {
+		join, err := b.joinSQL(j)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, "LEFT JOIN "+join)
+	}
+	return ret, nil
+}
+
+// joinSQL renders "table alias ON cond" of a join (or "table alias" without On) with the
+// resolver, so table names and aliases are quoted like columns
+func (b *BaseExpr) joinSQL(j compiler.Join) (string, error) {
+	table, err := compiler.Resolve(&compiler.SimpleExprTree{V: j.Table, Nt: "column"}, b.resolver)
+	if err != nil {
+		return "", err
+	}
+	alias, err := compiler.Resolve(&compiler.SimpleExprTree{V: j.Alias, Nt: "column"}, b.resolver)
+	if err != nil {
+		return "", err
+	}
+	if j.On == nil {
+		return table + " " + alias, nil
+	}
+	on, err := compiler.Resolve(j.On, b.resolver)
+	if err != nil {
+		return "", err
+	}
+	return table + " " + alias + " ON " + on, nil
+}
 
+// NewBaseExpr returns a new base without resolver, every dialect needs its own
+// because the resolver is kept in it
 func NewBaseExpr() IBaseExpr {
-	return bBaseExpr
+	return &BaseExpr{}
 }
 
 type IExpr interface {
 	IBaseExpr
 	// compiler to sqldb driver
 	CompileExpr(expr string) (string, error)
+	// compiler to sqldb driver, field names are checked against the entity's columns
+	// (Go field name or column name) and unknown fields are rejected
+	CompileExprWithSchema(expr string, schema *compiler.Schema) (string, error)
+	// like CompileExprWithSchema (schema may be nil), the result also lists the
+	// parameters so named parameters (@name, :name) can be bound with CompiledExpr.Bind
+	CompileCond(expr string, schema *compiler.Schema) (*CompiledExpr, error)
+	// compile a sort spec such as "CreatedOn desc, len(Name) asc" to an ORDER BY list,
+	// parameters are rejected
+	CompileOrderBy(orderBy string, schema *compiler.Schema) (string, error)
+	// compile a projection such as "ID, Name, year(CreatedOn) as Year" to a SELECT list,
+	// parameters are rejected
+	CompileSelect(selects string, schema *compiler.Schema) (string, error)
+	// compile the select list, GROUP BY and HAVING of an aggregate query such as
+	// "DepartmentID, sum(Price) as Total", "DepartmentID", "Total > ?"
+	CompileAggregate(selects string, groupBy string, having string, schema *compiler.Schema) (*CompiledAggregate, error)
+	// register a function (name is case-insensitive, maxArgs -1 means no limit)
+	// which can be used in expressions of this dialect
+	RegisterFunc(name string, minArgs int, maxArgs int, translate FuncTranslator)
+	GetFuncRegistry() *FuncRegistry
+	// limit the expressions accepted from now on (fields, functions, size, constants),
+	// nil removes the limits. Violations fail with a *PolicyError before any sql is built
+	SetPolicy(policy *Policy)
+	GetPolicy() *Policy
+	// turn the optimisation of conditions (compiler.Optimize) on or off, it is on by default.
+	// Switch it off to see the sql of an expression as written when debugging
+	SetOptimize(enabled bool)
+	GetOptimize() bool
 }
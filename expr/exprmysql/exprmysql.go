@@ -0,0 +1,213 @@
+package exprmysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nttlong/regorm/expr"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+type ExprMySql struct {
+	*expr.Dialect
+	funcs *expr.FuncRegistry
+}
+
+// dialect is the key of mysql in the compiled expression cache
+const dialect = "mysql"
+
+// LikeCollation là collation dùng cho like để phân biệt hoa thường như postgres,
+// collation mặc định của mysql (utf8mb4_0900_ai_ci, ...) không phân biệt hoa thường
+const LikeCollation = "utf8mb4_bin"
+
+var exprMySql = &ExprMySql{}
+var once sync.Once
+
+func New() expr.IExpr {
+	once.Do(func() {
+		exprMySql = &ExprMySql{Dialect: expr.NewDialect(dialect, quoteIdent)}
+		exprMySql.funcs = exprMySql.GetFuncRegistry()
+		registerBuiltinFuncs(exprMySql.funcs)
+		exprMySql.SetResolver(exprMySql.resolveMySql)
+	})
+	return exprMySql
+}
+
+var compilerOp = map[string]string{
+	"&&":          "AND",
+	"||":          "OR",
+	"!":           "NOT",
+	"not":         "NOT",
+	"==":          "=",
+	"!=":          "<>",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+	"in":          "IN",
+	"not in":      "NOT IN",
+	"between":     "BETWEEN",
+	"not between": "NOT BETWEEN",
+	"like":        "LIKE",
+	"not like":    "NOT LIKE",
+}
+
+// sqlFunc đánh dấu (trong Lk) nút hàm do resolver tạo ra, tên hàm đã là sql của mysql
+// nên không tra trong registry (JSON_EXTRACT, POW... không dùng được trong biểu thức)
+const sqlFunc = "sql"
+
+func newSqlFunc(name string, args ...*compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	return &compiler.SimpleExprTree{Nt: "func", V: name, Lk: sqlFunc, Ns: args}
+}
+
+func (e *ExprMySql) resolveMySql(n *compiler.SimpleExprTree) error {
+	if (n.Op == "==" || n.Op == "=" || n.Op == "!=" || n.Op == "<>") && len(n.Ns) == 2 && n.Ns[1].Lk == "null" {
+		// "x == null" luôn là NULL, phải dùng IS NULL
+		if n.Op == "==" || n.Op == "=" {
+			n.Op = "is null"
+		} else {
+			n.Op = "is not null"
+		}
+		n.Nt = "postfix"
+		n.Ns = n.Ns[:1]
+	}
+	if n.Nt == "" && len(n.Ns) == 2 {
+		if err := e.resolveBinary(n); err != nil {
+			return err
+		}
+	}
+	if p, ok := compilerOp[strings.ToLower(n.Op)]; ok {
+		n.Op = p
+	}
+	switch n.Nt {
+	case "const":
+		return compileLiteral(n)
+	case "field":
+		if !compiler.IsValidColumnName(n.V) {
+			return fmt.Errorf("invalid column name: %s", n.V)
+		}
+		n.V = quoteIdent(compiler.ToSnakeCase(n.V))
+	case "column":
+		n.V = quoteIdent(n.V)
+		if n.Tb != "" {
+			n.V = quoteIdent(n.Tb) + "." + n.V
+			n.Tb = ""
+		}
+	case "json":
+		return compileJSON(n)
+	case "func":
+		if n.Lk == sqlFunc {
+			return nil
+		}
+		return e.funcs.Translate(n)
+	}
+	return nil
+}
+
+// resolveBinary đổi các toán tử hai ngôi khác nghĩa trong mysql
+func (e *ExprMySql) resolveBinary(n *compiler.SimpleExprTree) error {
+	switch strings.ToLower(n.Op) {
+	case "^":
+		// ^ của mysql là xor
+		*n = *newSqlFunc("POW", n.Ns...)
+	case "like", "not like":
+		// like của mysql theo collation của cột, thường không phân biệt hoa thường
+		n.Ns[1] = newCollate(n.Ns[1])
+	case "ilike", "not ilike":
+		n.Op = strings.Replace(strings.ToUpper(n.Op), "ILIKE", "LIKE", 1)
+		n.Ns[0] = newSqlFunc("LOWER", n.Ns[0])
+		n.Ns[1] = newSqlFunc("LOWER", n.Ns[1])
+	case "?":
+		// json(Data, 'tags') ? 'vip': mảng json có phần tử 'vip'
+		*n = *newSqlFunc("JSON_CONTAINS", n.Ns[0], newSqlFunc("JSON_QUOTE", n.Ns[1]))
+	default:
+		if _, ok := compareOps[n.Op]; ok {
+			boolToJSONText(n)
+		}
+	}
+	return nil
+}
+
+var compareOps = map[string]bool{
+	"==": true, "=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// newCollate: x COLLATE utf8mb4_bin, COLLATE ưu tiên hơn mọi toán tử nên x phức tạp phải ở trong ngoặc
+func newCollate(x *compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	if len(x.Ns) > 0 && x.Nt != "func" && x.Op != "()" {
+		x = &compiler.SimpleExprTree{Op: "()", Ns: []*compiler.SimpleExprTree{x}}
+	}
+	return &compiler.SimpleExprTree{Op: "COLLATE", Ns: []*compiler.SimpleExprTree{
+		x, {Nt: "raw", V: LikeCollation},
+	}}
+}
+
+// boolToJSONText: giá trị json lấy ra bằng ->> là text nên so với 'true' / 'false'
+// thay vì TRUE / FALSE (là 1 / 0 trong mysql)
+func boolToJSONText(n *compiler.SimpleExprTree) {
+	for i, c := range n.Ns {
+		other := n.Ns[1-i]
+		if c.Nt == "const" && c.Lk == "bool" && other.Nt == "json" && other.Op == "->>" {
+			n.Ns[i] = &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: compiler.Quote(strings.ToLower(c.V))}
+		}
+	}
+}
+
+// compileJSON: data->'address'->>'city' -> JSON_UNQUOTE(JSON_EXTRACT(`data`, '$."address"."city"'))
+func compileJSON(n *compiler.SimpleExprTree) error {
+	var path strings.Builder
+	path.WriteString("$")
+	for _, key := range n.Ns[1:] {
+		if key.Lk == "int" {
+			path.WriteString("[" + key.V + "]")
+			continue
+		}
+		text, err := key.LiteralText()
+		if err != nil || key.Nt != "const" || key.Lk != "string" {
+			return fmt.Errorf("invalid json key %s", key.V)
+		}
+		path.WriteString(`."` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`)
+	}
+	ret := newSqlFunc("JSON_EXTRACT", n.Ns[0], &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: compiler.Quote(path.String())})
+	if n.Op == "->>" {
+		ret = newSqlFunc("JSON_UNQUOTE", ret)
+	}
+	*n = *ret
+	return nil
+}
+
+// quoteIdent luôn đặt tên cột trong dấu `, tránh trùng từ khoá như order, key, desc
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// compileLiteral render hằng số theo loại của nó (Lk)
+func compileLiteral(n *compiler.SimpleExprTree) error {
+	switch n.Lk {
+	case "bool":
+		n.V = strings.ToUpper(n.V)
+	case "null":
+		n.V = "NULL"
+	case "date", "timestamp":
+		value, err := n.LiteralText()
+		if err != nil {
+			return err
+		}
+		n.V = strings.ToUpper(n.Lk) + " " + compiler.Quote(strings.Replace(value, "T", " ", 1))
+	case "string":
+		// "\" là ký tự escape trong chuỗi của mysql, nhân đôi để chuỗi giữ nguyên như postgres
+		n.V = strings.ReplaceAll(n.V, `\`, `\\`)
+	case "int", "float":
+		// đã được lexer kiểm tra, giữ nguyên
+	default:
+		return fmt.Errorf("unsupported literal %s", n.V)
+	}
+	return nil
+}
+
+// intConst cho biết n là hằng số nguyên có giá trị v
+func intConst(n *compiler.SimpleExprTree, v int) bool {
+	i, err := strconv.Atoi(n.V)
+	return n.Nt == "const" && n.Lk == "int" && err == nil && i == v
+}
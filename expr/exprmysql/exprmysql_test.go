@@ -0,0 +1,123 @@
+package exprmysql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nttlong/regorm/expr/compiler"
+	"github.com/nttlong/regorm/expr/exprmysql"
+	"github.com/nttlong/regorm/expr/exprpostgres"
+	"github.com/nttlong/regorm/expr/exprtest"
+	"github.com/nttlong/regorm/expr/factory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseConditional compiles the shared table of exprtest
+func TestParseConditional(t *testing.T) {
+	exprtest.Run(t, exprmysql.New().CompileExpr, func(c exprtest.Case) string { return c.MySQL })
+}
+
+func TestCompileWithSchema(t *testing.T) {
+	schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "CreatedOn", Name: "created_on"},
+		{Field: "Code", Name: "emp_code"},
+		{Field: "FullName", Name: "FullName"},
+		{Field: "Order", Name: "order"},
+	})
+	parser := exprmysql.New()
+	data := []string{
+		"Code == ? && year(CreatedOn) == ?->`emp_code` = ? AND `created_on` >= MAKEDATE(?, 1) AND `created_on` < MAKEDATE(? + 1, 1)",
+		"emp_code == ? || id in ?->`emp_code` = ? OR `id` IN ?",
+		"FullName like ?->`FullName` LIKE ? COLLATE utf8mb4_bin",
+		"Order > 1->`order` > 1",
+	}
+	for _, test := range data {
+		parts := strings.Split(test, "->")
+		r, err := parser.CompileExprWithSchema(parts[0], schema)
+		assert.NoError(t, err, parts[0])
+		assert.Equal(t, parts[1], r)
+	}
+	_, err := parser.CompileExprWithSchema("Name == ?", schema)
+	assert.EqualError(t, err, `error compiling expression "Name == ?": unknown field 'Name' in Emp`)
+}
+
+func TestJSONPath(t *testing.T) {
+	parser := exprmysql.New()
+	data := []struct{ input, output string }{
+		{"Data.address.city == ?", "JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"address\".\"city\"')) = ?"},
+		{"json(Data, 'tags') ? 'vip'", "JSON_CONTAINS(JSON_EXTRACT(`data`, '$.\"tags\"'), JSON_QUOTE('vip'))"},
+		{"json(Data, 'items', 0, 'qty') == ?", "JSON_EXTRACT(`data`, '$.\"items\"[0].\"qty\"') = ?"},
+		{"Data.age > 30 && Data.active == true", "JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"age\"')) > 30 AND JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"active\"')) = 'true'"},
+		{"cast(Data.age, 'numeric') > ?", "CAST(JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"age\"')) AS DECIMAL(65, 30)) > ?"},
+		{"Data.city is null || Data.city in ?", "JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"city\"')) IS NULL OR JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"city\"')) IN ?"},
+	}
+	for _, test := range data {
+		r, err := parser.CompileExpr(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.output, r)
+	}
+	for _, input := range []string{"json(Data) == ?", "cast(Code, 'money') == ?", "cast(Code, 'boolean') == ?"} {
+		_, err := parser.CompileExpr(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCompileOrderByAndSelect(t *testing.T) {
+	parser := exprmysql.New()
+	r, err := parser.CompileOrderBy("CreatedOn desc, len(Name) asc", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "`created_on` DESC, CHAR_LENGTH(`name`) ASC", r)
+
+	r, err = parser.CompileSelect("ID, year(CreatedOn) as Year, Price * Qty Total", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "`id`, YEAR(`created_on`) AS `year`, `price` * `qty` AS `total`", r)
+
+	agg, err := parser.CompileAggregate("DepartmentID, sum(Price) as Total, count(*) as Orders", "DepartmentID", "Total > ?", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "`department_id`, SUM(`price`) AS `total`, COUNT(*) AS `orders`", agg.Select)
+	assert.Equal(t, "`department_id`", agg.GroupBy)
+	assert.Equal(t, "SUM(`price`) > ?", agg.Having.SQL)
+}
+
+func TestRelations(t *testing.T) {
+	user := compiler.NewSchema("User", "users", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "Username", Name: "username"},
+	})
+	emp := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "DepartmentID", Name: "department_id"},
+		{Field: "Salary", Name: "salary"},
+	})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "User", Target: user, Column: "id", RefColumn: "id"})
+	dept := compiler.NewSchema("Dept", "depts", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+	})
+	dept.AddRelation(&compiler.SchemaRelation{Field: "Emps", Target: emp, Column: "id", RefColumn: "department_id", Many: true})
+
+	parser := exprmysql.New()
+	c, err := parser.CompileCond("User.Username == ? and Salary > 1000", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "`emps__user`.`username` = ? and `emps`.`salary` > 1000", c.SQL)
+	assert.Equal(t, []string{"LEFT JOIN `users` `emps__user` ON `emps__user`.`id` = `emps`.`id`"}, c.Joins)
+
+	c, err = parser.CompileCond("any(Emps, Salary >= ?)", dept)
+	assert.NoError(t, err)
+	assert.Equal(t, "EXISTS (SELECT 1 FROM `emps` `depts__emps` WHERE `depts__emps`.`department_id` = `depts`.`id` AND (`depts__emps`.`salary` >= ?))", c.SQL)
+}
+
+func TestFactory(t *testing.T) {
+	assert.Same(t, exprmysql.New(), factory.NewExpr("mysql"))
+	assert.Same(t, exprpostgres.New(), factory.NewExpr("postgres"))
+	assert.Panics(t, func() { factory.NewExpr("oracle") })
+
+	// each dialect keeps its own resolver
+	my, err := factory.NewExpr("mysql").CompileExpr("len(Name) > ?")
+	assert.NoError(t, err)
+	pg, err := factory.NewExpr("postgres").CompileExpr("len(Name) > ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "CHAR_LENGTH(`name`) > ?", my)
+	assert.Equal(t, "length(name) > ?", pg)
+}
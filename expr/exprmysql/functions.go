@@ -0,0 +1,89 @@
+package exprmysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// registerBuiltinFuncs đăng ký các hàm có sẵn của mysql, cùng tên và cùng kết quả với postgres
+func registerBuiltinFuncs(funcs *expr.FuncRegistry) {
+	for _, name := range []string{"year", "month", "day", "hour", "minute", "second"} {
+		funcs.Register(name, 1, 1, upperFunc)
+	}
+	// length của mysql đếm byte, char_length đếm ký tự như postgres
+	funcs.Register("len", 1, 1, expr.RenameFunc("CHAR_LENGTH"))
+	funcs.Register("concat", 1, -1, compileConcat)
+	funcs.Register("lower", 1, 1, upperFunc)
+	funcs.Register("upper", 1, 1, upperFunc)
+	funcs.Register("trim", 1, 1, upperFunc)
+	funcs.Register("coalesce", 1, -1, upperFunc)
+	funcs.Register("substring", 2, 3, upperFunc)
+	funcs.Register("abs", 1, 1, upperFunc)
+	funcs.Register("round", 1, 2, upperFunc)
+	funcs.Register("now", 0, 0, upperFunc)
+	// make_date(năm, tháng, ngày), Optimize dùng cho year(F) == ?
+	funcs.Register("make_date", 3, 3, compileMakeDate)
+	funcs.Register("cast", 2, 2, compileCast)
+	// hàm gộp, dùng trong Aggregate
+	funcs.Register("count", 1, 1, upperFunc)
+	for _, name := range []string{"sum", "avg", "min", "max"} {
+		funcs.Register(name, 1, 1, upperFunc)
+	}
+}
+
+// upperFunc viết tên hàm bằng chữ hoa: year(x) -> YEAR(x)
+func upperFunc(n *compiler.SimpleExprTree) error {
+	n.V = strings.ToUpper(n.V)
+	return nil
+}
+
+// compileConcat: CONCAT của mysql trả về NULL khi có một đối số NULL, concat của postgres
+// bỏ qua NULL, CONCAT_WS với dấu phân cách rỗng cho cùng kết quả
+func compileConcat(n *compiler.SimpleExprTree) error {
+	n.V = "CONCAT_WS"
+	n.Ns = append([]*compiler.SimpleExprTree{{Nt: "const", Lk: "string", V: "''"}}, n.Ns...)
+	return nil
+}
+
+// compileMakeDate: make_date(y, 1, 1) -> MAKEDATE(y, 1),
+// các trường hợp khác -> STR_TO_DATE(CONCAT_WS('-', y, m, d), '%Y-%c-%e')
+func compileMakeDate(n *compiler.SimpleExprTree) error {
+	if intConst(n.Ns[1], 1) && intConst(n.Ns[2], 1) {
+		n.V = "MAKEDATE"
+		n.Ns = []*compiler.SimpleExprTree{n.Ns[0], n.Ns[2]}
+		return nil
+	}
+	n.V = "STR_TO_DATE"
+	n.Ns = []*compiler.SimpleExprTree{
+		newSqlFunc("CONCAT_WS", append([]*compiler.SimpleExprTree{{Nt: "const", Lk: "string", V: "'-'"}}, n.Ns...)...),
+		{Nt: "const", Lk: "string", V: "'%Y-%c-%e'"},
+	}
+	return nil
+}
+
+// castTypes là kiểu của mysql cho các kiểu được phép dùng trong cast(x, 'type'),
+// mysql không ép được sang boolean
+var castTypes = map[string]string{
+	"numeric": "DECIMAL(65, 30)", "integer": "SIGNED", "bigint": "SIGNED", "double precision": "DOUBLE",
+	"text": "CHAR", "date": "DATE", "timestamp": "DATETIME", "jsonb": "JSON",
+}
+
+// compileCast: cast(Data.age, 'numeric') -> CAST(JSON_UNQUOTE(JSON_EXTRACT(`data`, '$."age"')) AS DECIMAL(65, 30))
+func compileCast(n *compiler.SimpleExprTree) error {
+	typ, err := n.Ns[1].LiteralText()
+	if n.Ns[1].Nt != "const" || n.Ns[1].Lk != "string" || err != nil {
+		return fmt.Errorf("invalid function call: the second argument of cast must be a type name such as 'numeric'")
+	}
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	sqlType, ok := castTypes[typ]
+	if !ok {
+		return fmt.Errorf("invalid function call: cast to '%s' is not supported", typ)
+	}
+	n.Nt = "cast"
+	n.V = sqlType
+	n.Ns = n.Ns[:1]
+	return nil
+}
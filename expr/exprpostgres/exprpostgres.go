@@ -1,8 +1,8 @@
 package exprpostgres
 
 import (
-	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -12,30 +12,23 @@ import (
 )
 
 type ExprPostgres struct {
-	expr.IBaseExpr
+	*expr.Dialect
+	funcs *expr.FuncRegistry
 }
 
-func (e *ExprPostgres) CompileExpr(expr string) (string, error) {
-	n, err := e.Compile(expr)
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("\nerror compiling expression: %s\t %s", err.Error(), expr))
-	}
-
-	r, err := e.GetStrExpr(n)
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("\nerror compiling expression: %s\t %s", err.Error(), expr))
-	}
-	return r, nil
-}
+// dialect is the key of postgres in the compiled expression cache
+const dialect = "postgres"
 
 var exprPostgres = &ExprPostgres{}
 var once sync.Once
 
 func New() expr.IExpr {
 	once.Do(func() {
-		exprPostgres = &ExprPostgres{}
-		exprPostgres.IBaseExpr = expr.NewBaseExpr()
-		exprPostgres.SetResolver(resolvePostgres)
+		exprPostgres = &ExprPostgres{Dialect: expr.NewDialect(dialect, quoteAlias)}
+		exprPostgres.funcs = exprPostgres.GetFuncRegistry()
+		registerBuiltinFuncs(exprPostgres.funcs)
+		exprPostgres.registerSearchFuncs()
+		exprPostgres.SetResolver(exprPostgres.resolvePostgres)
 	})
 
 	return exprPostgres
@@ -43,34 +36,131 @@ func New() expr.IExpr {
 }
 
 var compilerOp = map[string]string{
-	"&&": "AND",
-	"||": "OR",
-	"!":  "NOT",
-	"==": "=",
+	"&&":          "AND",
+	"||":          "OR",
+	"!":           "NOT",
+	"not":         "NOT",
+	"==":          "=",
+	"!=":          "<>",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+	"in":          "IN",
+	"not in":      "NOT IN",
+	"between":     "BETWEEN",
+	"not between": "NOT BETWEEN",
 }
 
-func resolvePostgres(n *compiler.SimpleExprTree) error {
+func (e *ExprPostgres) resolvePostgres(n *compiler.SimpleExprTree) error {
+	if (n.Op == "==" || n.Op == "=" || n.Op == "!=" || n.Op == "<>") && len(n.Ns) == 2 && n.Ns[1].Lk == "null" {
+		// "x == null" trong postgres luôn là NULL, phải dùng IS NULL
+		if n.Op == "==" || n.Op == "=" {
+			n.Op = "is null"
+		} else {
+			n.Op = "is not null"
+		}
+		n.Nt = "postfix"
+		n.Ns = n.Ns[:1]
+	}
 	if p, ok := compilerOp[n.Op]; ok {
 		n.Op = p
 	}
+	if n.Op == "?" && len(n.Ns) == 2 {
+		// gorm hiểu "?" là tham số nên dùng hàm jsonb_exists thay cho toán tử ?
+		n.Nt = "func"
+		n.V = "jsonb_exists"
+		n.Op = ""
+		return nil
+	}
+	if jsonCastOps[n.Op] || n.Nt == "between" {
+		castJSONOperands(n)
+	}
+	if n.Nt == "const" {
+		return compileLiteral(n)
+	}
 	if n.Nt == "field" {
 		if !compiler.IsValidColumnName(n.V) {
 			return fmt.Errorf("invalid column name: %s", n.V)
 		}
 		n.V = compiler.ToSnakeCase(n.V)
 	}
+	if n.Nt == "column" {
+		// tên cột lấy từ metadata, chỉ cần quote khi không phải tên thường
+		n.V = quoteIdent(n.V)
+		if n.Tb != "" {
+			n.V = quoteIdent(n.Tb) + "." + n.V
+			n.Tb = ""
+		}
+	}
 	if n.Nt == "func" {
-		fncName := strings.ToLower(n.V)
-		switch fncName {
-		case "year", "month", "day", "hour", "minute", "second":
-			err := compileTimeFunc(n)
-			if err != nil {
-				return err
-			}
+		return e.funcs.Translate(n)
+	}
+	return nil
+}
 
+// jsonCastOps là các toán tử mà giá trị json dạng text (->>) cần ép kiểu khi so với hằng số
+var jsonCastOps = map[string]bool{
+	"=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"+": true, "-": true, "*": true, "/": true, "%": true,
+}
+
+// castJSONOperands: data->>'age' là text, khi so sánh hoặc tính toán với hằng số
+// (data->>'age' > 30) phải ép sang kiểu của hằng số
+func castJSONOperands(n *compiler.SimpleExprTree) {
+	castType := ""
+	for _, c := range n.Ns {
+		switch {
+		case c.Nt == "const" && (c.Lk == "int" || c.Lk == "float"):
+			castType = "numeric"
+		case c.Nt == "const" && c.Lk == "bool":
+			castType = "boolean"
+		case c.Nt == "const" && c.Lk == "date":
+			castType = "date"
+		case c.Nt == "const" && c.Lk == "timestamp":
+			castType = "timestamp"
 		}
+	}
+	if castType == "" {
+		return
+	}
+	for i, c := range n.Ns {
+		if c.Nt == "json" && c.Op == "->>" {
+			n.Ns[i] = &compiler.SimpleExprTree{Nt: "cast", V: castType, Ns: []*compiler.SimpleExprTree{c}}
+		}
+	}
+}
 
-		// TODO: implement resolver for postgres
+var plainIdent = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// quoteIdent đặt tên cột trong dấu nháy kép nếu có chữ hoa hoặc ký tự đặc biệt
+func quoteIdent(name string) string {
+	if plainIdent.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteAlias luôn đặt alias trong dấu nháy kép để không trùng từ khoá như "order"
+func quoteAlias(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// compileLiteral render hằng số theo loại của nó (Lk)
+func compileLiteral(n *compiler.SimpleExprTree) error {
+	switch n.Lk {
+	case "bool":
+		n.V = strings.ToUpper(n.V)
+	case "null":
+		n.V = "NULL"
+	case "date", "timestamp":
+		value, err := n.LiteralText()
+		if err != nil {
+			return err
+		}
+		n.V = strings.ToUpper(n.Lk) + " " + compiler.Quote(strings.Replace(value, "T", " ", 1))
+	case "int", "float", "string":
+		// đã được lexer kiểm tra, giữ nguyên
+	default:
+		return fmt.Errorf("unsupported literal %s", n.V)
 	}
 	return nil
 }
@@ -85,7 +175,7 @@ func compileTimeFunc(n *compiler.SimpleExprTree) error {
 	*/
 	//fP := fmt.Sprint("date_part('%s',id)")
 	if n.Ns == nil || len(n.Ns) != 1 {
-		return errors.New(fmt.Sprintf("\nnvalid function call. Function %s requires only one argument", n.V))
+		return fmt.Errorf("invalid function call: function %s requires only one argument", n.V)
 	}
 	oldFnName := n.V
 	n.V = "date_part"
@@ -93,6 +183,7 @@ func compileTimeFunc(n *compiler.SimpleExprTree) error {
 	n.Ns = []*compiler.SimpleExprTree{
 		{
 			Nt: "const",
+			Lk: "string",
 			V:  "'" + oldFnName + "'",
 		},
 	}
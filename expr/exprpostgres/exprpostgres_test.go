@@ -1,46 +1,565 @@
 package exprpostgres_test
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
 	"github.com/nttlong/regorm/expr/exprpostgres"
+	"github.com/nttlong/regorm/expr/exprtest"
 
 	"github.com/stretchr/testify/assert"
 )
 
-var testData = []string{
-	"(year(CreatedOn) == ?) && (month(CreatedOn) == ?)->(date_part('year', created_on) = ?) AND (date_part('month', created_on) = ?)",
-	"year(Id,code)->error",
-	"year(Id)->date_part('year', id)",
-	"UserName like '%%adm\\%in%%'->user_name like '%%adm\\%in%%'",
-	"year()->date_part('year', id)",
+// TestParseConditional compiles the shared table of exprtest
+func TestParseConditional(t *testing.T) {
+	exprtest.Run(t, exprpostgres.New().CompileExpr, func(c exprtest.Case) string { return c.Postgres })
+}
 
-	"month(ID)->date_part('month', id)",
-	"day(ID)->date_part('day', id)",
-	"hour(ID)->date_part('hour', id)",
-	"minute(ID)->date_part('minute', id)",
-	"second(ID)->date_part('second', id)",
-	"ID->id",
+func TestCompileParseError(t *testing.T) {
+	_, err := exprpostgres.New().CompileExpr("Code == ? and (Name like ?")
+	var pe *compiler.ParseError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "')'", pe.Expected)
+	assert.Equal(t, len("Code == ? and (Name like ?"), pe.Pos)
+	assert.NotContains(t, err.Error(), "\n")
 }
 
-func TestParseConditional(t *testing.T) {
+func TestCompileWithSchema(t *testing.T) {
+	schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "CreatedOn", Name: "created_on"},
+		{Field: "Code", Name: "emp_code"},
+		{Field: "FullName", Name: "FullName"},
+	})
 	parser := exprpostgres.New()
-	for _, test := range testData {
+	data := []string{
+		"Code == ? && year(CreatedOn) == ?->emp_code = ? AND created_on >= make_date(?, 1, 1) AND created_on < make_date(? + 1, 1, 1)",
+		"emp_code == ? || id in ?->emp_code = ? OR id IN ?",
+		"FullName like ?->\"FullName\" like ?",
+		"code == ?->emp_code = ?",
+	}
+	for _, test := range data {
 		input := strings.Split(test, "->")[0]
-		ouput := strings.Split(test, "->")[1]
-		expr, err := parser.CompileExpr(input)
-		if err != nil {
-			if ouput == "error" {
-				t.Log(err)
-				fmt.Print(err)
+		output := strings.Split(test, "->")[1]
+		r, err := parser.CompileExprWithSchema(input, schema)
+		assert.NoError(t, err, input)
+		assert.Equal(t, output, r)
+	}
+	_, err := parser.CompileExprWithSchema("Name == ?", schema)
+	assert.EqualError(t, err, `error compiling expression "Name == ?": unknown field 'Name' in Emp`)
+}
+
+func TestRegisterFunc(t *testing.T) {
+	parser := exprpostgres.New()
+	_, err := parser.CompileExpr("initials(FirstName) == ?")
+	assert.Error(t, err)
+
+	parser.RegisterFunc("initials", 1, 1, func(n *compiler.SimpleExprTree) error {
+		n.V = "left"
+		n.Ns = append(n.Ns, &compiler.SimpleExprTree{Nt: "const", Lk: "int", V: "1"})
+		return nil
+	})
+	r, err := parser.CompileExpr("initials(FirstName) == ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "left(first_name, 1) = ?", r)
+	assert.Contains(t, parser.GetFuncRegistry().Names(), "initials")
+
+	// registering again replaces the translator, cached sql is not reused
+	parser.RegisterFunc("INITIALS", 1, 1, expr.RenameFunc("upper"))
+	r, err = parser.CompileExpr("initials(FirstName) == ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "upper(first_name) = ?", r)
+}
+
+func TestNamedParams(t *testing.T) {
+	parser := exprpostgres.New()
+	c, err := parser.CompileCond("Code == @code || (Name like :name && Alias == @code)", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "code = ? OR (name like ? AND alias = ?)", c.SQL)
+	assert.Equal(t, []string{"code", "name", "code"}, c.Params)
+
+	args, err := c.Bind(map[string]interface{}{"code": "E01", "name": "A%"})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E01", "A%", "E01"}, args)
+
+	args, err = c.Bind(&struct {
+		Code  string
+		Name  string
+		Other int
+	}{Code: "E02", Name: "B%"})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E02", "B%", "E02"}, args)
+
+	args, err = c.Bind(sql.Named("name", "C%"), sql.Named("code", "E03"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E03", "C%", "E03"}, args)
+
+	_, err = c.Bind(map[string]interface{}{"code": "E01", "age": 1})
+	var perr *expr.ParamError
+	assert.ErrorAs(t, err, &perr)
+	assert.Equal(t, []string{"name"}, perr.Missing)
+	assert.Equal(t, []string{"age"}, perr.Unused)
+	assert.EqualError(t, err, "missing parameter(s) name; unused parameter(s) age")
+
+	_, err = c.Bind(struct{ Code string }{})
+	assert.EqualError(t, err, "missing parameter(s) name")
+
+	_, err = c.Bind("E01", "A%")
+	assert.Error(t, err)
+
+	// positional parameters are passed through unchanged
+	c, err = parser.CompileCond("Code == ? && Id in ?", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", ""}, c.Params)
+	args, err = c.Bind("E01", []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E01", []int{1, 2}}, args)
+
+	c, err = parser.CompileCond("Code == ? && Name == @name", nil)
+	assert.NoError(t, err)
+	_, err = c.Bind(map[string]interface{}{"name": "x"})
+	assert.Error(t, err)
+}
 
+func TestJSONPath(t *testing.T) {
+	parser := exprpostgres.New()
+	data := []struct{ input, output string }{
+		{"Data.address.city == ?", "data->'address'->>'city' = ?"},
+		{"json(Data, 'tags') ? 'vip'", "jsonb_exists(data->'tags', 'vip')"},
+		{"json(Data, 'items', 0, 'qty') == ?", "data->'items'->0->'qty' = ?"},
+		{"Data.age > 30 && Data.active == true", "CAST(data->>'age' AS numeric) > 30 AND CAST(data->>'active' AS boolean) = TRUE"},
+		{"Data.price * 2 between 10 and 20.5", "CAST(data->>'price' AS numeric) * 2 BETWEEN 10 AND 20.5"},
+		{"cast(Data.age, 'numeric') > ?", "CAST(data->>'age' AS numeric) > ?"},
+		{"Data.city is null || Data.city in ?", "data->>'city' IS NULL OR data->>'city' IN ?"},
+	}
+	for _, test := range data {
+		r, err := parser.CompileExpr(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.output, r)
+	}
+	for _, input := range []string{"json(Data) == ?", "cast(Code, 'money') == ?", "cast(Code, Name) == ?"} {
+		_, err := parser.CompileExpr(input)
+		assert.Error(t, err, input)
+	}
+
+	schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "Code", Name: "code", DbType: "varchar"},
+		{Field: "Attrs", Name: "attrs", DbType: "jsonb"},
+	})
+	r, err := parser.CompileExprWithSchema("Attrs.address.city == ? && json(Attrs, 'tags') ? 'vip'", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "attrs->'address'->>'city' = ? AND jsonb_exists(attrs->'tags', 'vip')", r)
+
+	_, err = parser.CompileExprWithSchema("Code.city == ?", schema)
+	assert.EqualError(t, err, `error compiling expression "Code.city == ?": field 'Code' in Emp is not a json column`)
+	_, err = parser.CompileExprWithSchema("json(Other, 'k') ? 'v'", schema)
+	assert.Error(t, err)
+}
+
+func TestSearchConfig(t *testing.T) {
+	parser := exprpostgres.New()
+	assert.Equal(t, exprpostgres.DefaultSearchConfig, exprpostgres.SearchConfig())
+	assert.NoError(t, exprpostgres.SetSearchConfig("english"))
+	defer exprpostgres.SetSearchConfig(exprpostgres.DefaultSearchConfig)
+
+	r, err := parser.CompileExpr("search(Title, ?)")
+	assert.NoError(t, err)
+	assert.Equal(t, "to_tsvector('english', title) @@ plainto_tsquery('english', ?)", r)
+	assert.Error(t, exprpostgres.SetSearchConfig("english'); drop table x; --"))
+	assert.Equal(t, "english", exprpostgres.SearchConfig())
+
+	// the sql cached with the previous configuration is not reused
+	assert.NoError(t, exprpostgres.SetSearchConfig("french"))
+	r, err = parser.CompileExpr("search(Title, ?)")
+	assert.NoError(t, err)
+	assert.Equal(t, "to_tsvector('french', title) @@ plainto_tsquery('french', ?)", r)
+
+	// compiling while the configuration changes is safe (go test -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i == 0 {
+					_ = exprpostgres.SetSearchConfig([]string{"english", "french"}[j%2])
+					continue
+				}
+				_, err := parser.CompileExpr(fmt.Sprintf("search(Title, ?) && Code == %d", j))
+				assert.NoError(t, err)
 			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCompileOrderByAndSelect(t *testing.T) {
+	parser := exprpostgres.New()
+	r, err := parser.CompileOrderBy("CreatedOn desc, len(Name) asc, Data.rank", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "created_on DESC, length(name) ASC, data->>'rank' ASC", r)
+
+	r, err = parser.CompileSelect("ID, Name, year(CreatedOn) as Year, Price * Qty Total", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `id, name, date_part('year', created_on) AS "year", price * qty AS "total"`, r)
+
+	schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "Code", Name: "emp_code"},
+	})
+	r, err = parser.CompileOrderBy("Code desc", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "emp_code DESC", r)
+	_, err = parser.CompileOrderBy("Name desc", schema)
+	assert.Error(t, err)
+
+	_, err = parser.CompileOrderBy("Code desc; drop table emps", nil)
+	var perr *compiler.ParseError
+	assert.ErrorAs(t, err, &perr)
+	_, err = parser.CompileOrderBy("Code == ?", nil)
+	assert.EqualError(t, err, `error compiling order by "Code == ?": parameter ? is not allowed here at position 0`)
+	_, err = parser.CompileSelect("Code, foo(Name)", nil)
+	assert.Error(t, err)
+}
+
+func TestCompileAggregate(t *testing.T) {
+	parser := exprpostgres.New()
+	agg, err := parser.CompileAggregate(
+		"DepartmentID, year(CreatedOn) as Year, sum(Price) as Total, count(*) as Orders, avg(Salary)",
+		"DepartmentID, Year",
+		"Total > @min && count(*) >= 2",
+		nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `department_id, date_part('year', created_on) AS "year", sum(price) AS "total", count(*) AS "orders", avg(salary)`, agg.Select)
+	assert.Equal(t, "department_id, date_part('year', created_on)", agg.GroupBy)
+	assert.Equal(t, "sum(price) > ? AND count(*) >= 2", agg.Having.SQL)
+	assert.Equal(t, []string{"min"}, agg.Having.Params)
 
-		} else {
-			assert.Equal(t, ouput, expr)
+	agg, err = parser.CompileAggregate("min(Price), max(Price)", "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "min(price), max(price)", agg.Select)
+	assert.Equal(t, "", agg.GroupBy)
+	assert.Nil(t, agg.Having)
+
+	for _, test := range [][3]string{
+		{"sum(*)", "", ""},
+		{"sum(Price) as Total", "?", ""},
+		{"sum(Price, Qty)", "", ""},
+		{"sum(Price) as Total", "", "Total >"},
+	} {
+		_, err = parser.CompileAggregate(test[0], test[1], test[2], nil)
+		assert.Error(t, err, test[0])
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	parser := exprpostgres.New()
+	schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "Code", Name: "code"},
+		{Field: "Name", Name: "name"},
+		{Field: "Price", Name: "price"},
+		{Field: "Secret", Name: "secret"},
+		{Field: "Data", Name: "data", DbType: "jsonb"},
+	})
+	parser.SetPolicy(&expr.Policy{
+		Fields:       map[string][]string{"Emp": {"Code", "name", "Price", "Data"}},
+		Funcs:        []string{"len", "lower", "cast", "sum"},
+		MaxLength:    80,
+		MaxDepth:     4,
+		MaxNodes:     12,
+		MaxStringLen: 5,
+	})
+	defer parser.SetPolicy(nil)
+
+	for _, test := range []string{
+		"Code == ? and len(Name) > 3",
+		"lower(code) == 'abc' or Price is null",
+		"cast(Data.age, 'numeric') > 18",
+	} {
+		_, err := parser.CompileCond(test, schema)
+		assert.NoError(t, err, test)
+	}
+
+	var perr *expr.PolicyError
+	for _, test := range []struct {
+		expr string
+		rule string
+	}{
+		{"Secret == ?", expr.PolicyField},
+		{"upper(Code) == ?", expr.PolicyFunc},
+		{"Code == 'abcdef'", expr.PolicyString},
+		{"Code == ? and (Name == ? or (Price > ? and (Price < ?)))", expr.PolicyDepth},
+		{"Code in (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", expr.PolicyNodes},
+		{"Code == ? " + strings.Repeat("and Code == ? ", 6), expr.PolicyLength},
+	} {
+		_, err := parser.CompileCond(test.expr, schema)
+		if assert.True(t, errors.As(err, &perr), test.expr) {
+			assert.Equal(t, test.rule, perr.Rule, test.expr)
 		}
 	}
+	// the length is checked before parsing: an oversized text that does not even parse
+	// fails on the policy, not with a parse error
+	long := strings.Repeat("(", 100)
+	for _, compile := range []func() error{
+		func() error { _, err := parser.CompileCond(long, schema); return err },
+		func() error { _, err := parser.CompileOrderBy(long, schema); return err },
+		func() error { _, err := parser.CompileSelect(long, schema); return err },
+		func() error { _, err := parser.CompileAggregate("Code", "Code", long, schema); return err },
+	} {
+		err := compile()
+		if assert.True(t, errors.As(err, &perr)) {
+			assert.Equal(t, expr.PolicyLength, perr.Rule)
+		}
+	}
+	_, err := parser.CompileCond("Code == ?", nil)
+	assert.True(t, errors.As(err, &perr), "no schema: only the fields of \"*\" are allowed")
+	_, err = parser.CompileOrderBy("Secret desc", schema)
+	assert.True(t, errors.As(err, &perr))
+	_, err = parser.CompileAggregate("Code, sum(Price) as Total", "Code", "Total > ? and Secret == ?", schema)
+	assert.True(t, errors.As(err, &perr))
+	_, err = parser.CompileAggregate("Code, sum(Price) as Total", "Code", "Total > ?", schema)
+	assert.NoError(t, err)
+
+	parser.SetPolicy(&expr.Policy{ParamsOnly: true})
+	_, err = parser.CompileCond("Code == ? and Name is null and Price != null", schema)
+	assert.NoError(t, err)
+	_, err = parser.CompileCond("Code == 'x'", schema)
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, expr.PolicyLiteral, perr.Rule)
+	}
+
+	// expressions compiled before the policy was set are not served from the cache
+	parser.SetPolicy(nil)
+	_, err = parser.CompileCond("Secret == ?", schema)
+	assert.NoError(t, err)
+	parser.SetPolicy(&expr.Policy{Fields: map[string][]string{"Emp": {"Code"}}})
+	_, err = parser.CompileCond("Secret == ?", schema)
+	assert.True(t, errors.As(err, &perr))
+}
+
+func TestRelationPath(t *testing.T) {
+	parser := exprpostgres.New()
+	user := compiler.NewSchema("User", "users", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "Username", Name: "username"},
+		{Field: "Profile", Name: "profile", DbType: "jsonb"},
+	})
+	work := compiler.NewSchema("Working", "workings", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "StartDate", Name: "start_date"},
+	})
+	info := compiler.NewSchema("PersonalInfo", "personal_infos", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "BirthDay", Name: "birth_day"},
+		{Field: "OwnerID", Name: "owner_id"},
+	})
+	info.AddRelation(&compiler.SchemaRelation{Field: "Owner", Target: user, Column: "owner_id", RefColumn: "id"})
+	emp := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "CreatedOn", Name: "created_on"},
+		{Field: "Data", Name: "data", DbType: "jsonb"},
+	})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "User", Target: user, Column: "id", RefColumn: "id"})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "Works", Target: work, Column: "id", RefColumn: "id", Many: true})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "Info", Target: info, Column: "id", RefColumn: "id"})
+
+	c, err := parser.CompileCond("User.Username == ? and Info.BirthDay >= ? and year(CreatedOn) == 2024", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "emps__user.username = ? and emps__info.birth_day >= ? and emps.created_on >= TIMESTAMP '2024-01-01 00:00:00' AND emps.created_on < TIMESTAMP '2025-01-01 00:00:00'", c.SQL)
+	assert.Equal(t, []string{
+		"LEFT JOIN users emps__user ON emps__user.id = emps.id",
+		"LEFT JOIN personal_infos emps__info ON emps__info.id = emps.id",
+	}, c.Joins)
+
+	// nested relations, the same path always gives the same alias
+	c, err = parser.CompileCond("Info.Owner.Username == ? or Info.Owner.ID == ? or User.Profile.city == 'Hue'", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "emps__info__owner.username = ? or emps__info__owner.id = ? or emps__user.profile->>'city' = 'Hue'", c.SQL)
+	assert.Equal(t, []string{
+		"LEFT JOIN personal_infos emps__info ON emps__info.id = emps.id",
+		"LEFT JOIN users emps__info__owner ON emps__info__owner.id = emps__info.owner_id",
+		"LEFT JOIN users emps__user ON emps__user.id = emps.id",
+	}, c.Joins)
+
+	// without relation nothing changes, json columns stay json paths
+	c, err = parser.CompileCond("Data.city == ?", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "data->>'city' = ?", c.SQL)
+	assert.Empty(t, c.Joins)
+	c, err = parser.CompileCond("Data.city == ?", emp.Qualified())
+	assert.NoError(t, err)
+	assert.Equal(t, "emps.data->>'city' = ?", c.SQL)
+
+	order, err := parser.CompileOrderBy("CreatedOn desc", emp.Qualified())
+	assert.NoError(t, err)
+	assert.Equal(t, "emps.created_on DESC", order)
+
+	for _, test := range []string{
+		"Works.StartDate >= ?", // has-many
+		"User.Password == ?",   // unknown field
+		"User.Username.x == ?", // not a json column
+		"Info.Owner == ?",      // not a field
+	} {
+		_, err = parser.CompileCond(test, emp)
+		assert.Error(t, err, test)
+	}
+	_, err = parser.CompileOrderBy("User.Username", emp)
+	assert.Error(t, err)
+
+	// allowing a relation does not allow every field of the related entity
+	parser.SetPolicy(&expr.Policy{Fields: map[string][]string{
+		"Emp":          {"User", "Info"},
+		"User":         {"Username"},
+		"PersonalInfo": {"Owner"},
+	}})
+	defer parser.SetPolicy(nil)
+	for _, test := range []string{"User.Username == ?", "Info.Owner.Username == ?"} {
+		_, err = parser.CompileCond(test, emp)
+		assert.NoError(t, err, test)
+	}
+	var perr *expr.PolicyError
+	for _, test := range []string{"User.ID == ?", "User.Profile.city == ?", "Info.BirthDay == ?", "Info.Owner.ID == ?"} {
+		_, err = parser.CompileCond(test, emp)
+		if assert.True(t, errors.As(err, &perr), test) {
+			assert.Equal(t, expr.PolicyField, perr.Rule, test)
+		}
+	}
+}
+
+func TestQuantifier(t *testing.T) {
+	parser := exprpostgres.New()
+	user := compiler.NewSchema("User", "users", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "Username", Name: "username"},
+	})
+	work := compiler.NewSchema("Working", "workings", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "StartDate", Name: "start_date"},
+	})
+	emp := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "DepartmentID", Name: "department_id"},
+		{Field: "Salary", Name: "salary"},
+	})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "User", Target: user, Column: "id", RefColumn: "id"})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "Works", Target: work, Column: "id", RefColumn: "id", Many: true})
+	dept := compiler.NewSchema("Dept", "depts", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "Name", Name: "name"},
+	})
+	dept.AddRelation(&compiler.SchemaRelation{Field: "Emps", Target: emp, Column: "id", RefColumn: "department_id", Many: true})
+
+	tests := []struct {
+		expr   string
+		sql    string
+		params []string
+	}{
+		{"any(Emps)",
+			"EXISTS (SELECT 1 FROM emps depts__emps WHERE depts__emps.department_id = depts.id)", nil},
+		{"Name like ? and any(Emps, Salary > @min and User.Username != ?)",
+			"name like ? and EXISTS (SELECT 1 FROM emps depts__emps LEFT JOIN users depts__emps__user ON depts__emps__user.id = depts__emps.id" +
+				" WHERE depts__emps.department_id = depts.id AND (depts__emps.salary > ? and depts__emps__user.username <> ?))",
+			[]string{"", "min", ""}},
+		{"none(Emps, Salary < 1000)",
+			"NOT EXISTS (SELECT 1 FROM emps depts__emps WHERE depts__emps.department_id = depts.id AND (depts__emps.salary < 1000))", nil},
+		{"all(Emps, Salary >= ?)",
+			"NOT EXISTS (SELECT 1 FROM emps depts__emps WHERE depts__emps.department_id = depts.id AND CASE WHEN (depts__emps.salary >= ?) THEN 1 ELSE 0 END = 0)",
+			[]string{""}},
+		// departments having at least one employee who started this year
+		{"any(Emps, any(Works, year(StartDate) == ?))",
+			"EXISTS (SELECT 1 FROM emps depts__emps WHERE depts__emps.department_id = depts.id AND " +
+				"(EXISTS (SELECT 1 FROM workings depts__emps__works WHERE depts__emps__works.id = depts__emps.id AND " +
+				"(depts__emps__works.start_date >= make_date(?, 1, 1) AND depts__emps__works.start_date < make_date(? + 1, 1, 1)))))",
+			[]string{"", ""}},
+	}
+	for _, tt := range tests {
+		c, err := parser.CompileCond(tt.expr, dept)
+		if assert.NoError(t, err, tt.expr) {
+			assert.Equal(t, tt.sql, c.SQL, tt.expr)
+			assert.Equal(t, tt.params, c.Params, tt.expr)
+			assert.Empty(t, c.Joins)
+		}
+	}
+
+	for _, test := range []string{
+		"any(Name, Name == ?)",      // not a relation
+		"all(Emps)",                 // all requires a condition
+		"any(Emps, Foo == ?)",       // unknown field of Emp
+		"any(Emps, ?, ?)",           // too many arguments
+		"any(len(Name), Name == ?)", // not a field
+	} {
+		_, err := parser.CompileCond(test, dept)
+		assert.Error(t, err, test)
+	}
+	_, err := parser.CompileCond("any(Emps)", nil)
+	assert.Error(t, err)
+
+	// the policy checks the condition against the fields of the related entity
+	parser.SetPolicy(&expr.Policy{Fields: map[string][]string{"Dept": {"Name", "Emps"}, "Emp": {"Salary"}}})
+	defer parser.SetPolicy(nil)
+	_, err = parser.CompileCond("any(Emps, Salary > ?)", dept)
+	assert.NoError(t, err)
+	_, err = parser.CompileCond("any(Emps, DepartmentID == ?)", dept)
+	var perr *expr.PolicyError
+	assert.True(t, errors.As(err, &perr))
+}
+
+func TestOptimize(t *testing.T) {
+	parser := exprpostgres.New()
+	schema := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "Code", Name: "code"},
+		{Field: "CreatedOn", Name: "created_on"},
+	})
+	c, err := parser.CompileCond("Code == ? and year(CreatedOn) == ?", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "code = ? and created_on >= make_date(?, 1, 1) AND created_on < make_date(? + 1, 1, 1)", c.SQL)
+	assert.Equal(t, []int{0, 1, 1}, c.ArgIdx)
+	assert.Equal(t, 2, c.NumArgs())
+	args, err := c.Bind("E01", 2024)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E01", 2024, 2024}, args)
+	_, err = c.Bind("E01")
+	assert.Error(t, err)
+
+	c, err = parser.CompileCond("year(CreatedOn) == 2024 and month(CreatedOn) == 2 and 1 + 1 == 2", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "created_on >= TIMESTAMP '2024-02-01 00:00:00' AND created_on < TIMESTAMP '2024-03-01 00:00:00'", c.SQL)
+	assert.Nil(t, c.ArgIdx)
+
+	// the "?" of a branch known to be true is kept, the argument of the caller still has a place
+	c, err = parser.CompileCond("1 == 1 or Code == ?", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "TRUE or code = ?", c.SQL)
+	c, err = parser.CompileCond("Code == -(-1)", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "code = -(-1)", c.SQL)
+
+	c, err = parser.CompileCond("year(CreatedOn) != @year", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "created_on < make_date(?, 1, 1) OR created_on >= make_date(? + 1, 1, 1)", c.SQL)
+	args, err = c.Bind(map[string]interface{}{"year": 2024})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{2024, 2024}, args)
+
+	// the where and having of an aggregate query are bound together
+	all := &expr.CompiledExpr{}
+	all.Append(&expr.CompiledExpr{Params: []string{"", "", ""}, ArgIdx: []int{0, 1, 1}})
+	all.Append(&expr.CompiledExpr{Params: []string{""}})
+	args, err = all.Bind("E01", 2024, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"E01", 2024, 2024, 10}, args)
 
+	// switched off the sql follows the expression as written
+	assert.True(t, parser.GetOptimize())
+	parser.SetOptimize(false)
+	defer parser.SetOptimize(true)
+	c, err = parser.CompileCond("Code == ? and year(CreatedOn) == ?", schema)
+	assert.NoError(t, err)
+	assert.Equal(t, "code = ? and date_part('year', created_on) = ?", c.SQL)
+	assert.Nil(t, c.ArgIdx)
 }
@@ -0,0 +1,69 @@
+package exprpostgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// registerBuiltinFuncs đăng ký các hàm có sẵn của postgres
+func registerBuiltinFuncs(funcs *expr.FuncRegistry) {
+	for _, name := range []string{"year", "month", "day", "hour", "minute", "second"} {
+		funcs.Register(name, 1, 1, compileTimeFunc)
+	}
+	funcs.Register("len", 1, 1, expr.RenameFunc("length"))
+	funcs.Register("concat", 1, -1, nil)
+	funcs.Register("lower", 1, 1, nil)
+	funcs.Register("upper", 1, 1, nil)
+	funcs.Register("trim", 1, 1, nil)
+	funcs.Register("coalesce", 1, -1, nil)
+	funcs.Register("substring", 2, 3, nil)
+	funcs.Register("abs", 1, 1, nil)
+	funcs.Register("round", 1, 2, compileRound)
+	funcs.Register("now", 0, 0, nil)
+	// make_date(năm, tháng, ngày), Optimize dùng cho year(F) == ?
+	funcs.Register("make_date", 3, 3, nil)
+	funcs.Register("cast", 2, 2, compileCast)
+	// hàm gộp, dùng trong Aggregate
+	funcs.Register("count", 1, 1, nil)
+	for _, name := range []string{"sum", "avg", "min", "max"} {
+		funcs.Register(name, 1, 1, nil)
+	}
+}
+
+// castTypes là các kiểu được phép dùng trong cast(x, 'type')
+var castTypes = map[string]bool{
+	"numeric": true, "integer": true, "bigint": true, "double precision": true,
+	"text": true, "boolean": true, "date": true, "timestamp": true, "jsonb": true,
+}
+
+// compileCast: cast(Data.age, 'numeric') -> CAST(data->>'age' AS numeric)
+func compileCast(n *compiler.SimpleExprTree) error {
+	typ, err := n.Ns[1].LiteralText()
+	if n.Ns[1].Nt != "const" || n.Ns[1].Lk != "string" || err != nil {
+		return fmt.Errorf("invalid function call: the second argument of cast must be a type name such as 'numeric'")
+	}
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if !castTypes[typ] {
+		return fmt.Errorf("invalid function call: cast to '%s' is not supported", typ)
+	}
+	n.Nt = "cast"
+	n.V = typ
+	n.Ns = n.Ns[:1]
+	return nil
+}
+
+// compileRound: round(x, n) của postgres chỉ nhận numeric, cần ép kiểu đối số đầu
+func compileRound(n *compiler.SimpleExprTree) error {
+	n.V = "round"
+	if len(n.Ns) == 2 {
+		n.Ns[0] = &compiler.SimpleExprTree{
+			Nt: "cast",
+			V:  "numeric",
+			Ns: []*compiler.SimpleExprTree{n.Ns[0]},
+		}
+	}
+	return nil
+}
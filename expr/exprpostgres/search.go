@@ -0,0 +1,86 @@
+package exprpostgres
+
+import (
+	"fmt"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// DefaultSearchConfig là text search configuration mặc định của search()
+const DefaultSearchConfig = "simple"
+
+// searchConfigOption là tên option của dialect giữ text search configuration
+const searchConfigOption = "search_config"
+
+// SetSearchConfig đổi text search configuration (ví dụ "english") dùng cho search()
+// và cho các index fulltext do AutoMigrate tạo. Option được giữ trong dialect (có khoá)
+// và đổi version của cache nên sql đã compile với configuration cũ không được dùng lại
+func (e *ExprPostgres) SetSearchConfig(config string) error {
+	if !plainIdent.MatchString(config) {
+		return fmt.Errorf("invalid text search configuration '%s'", config)
+	}
+	e.SetOption(searchConfigOption, config)
+	return nil
+}
+
+func (e *ExprPostgres) GetSearchConfig() string {
+	if config := e.GetOption(searchConfigOption); config != "" {
+		return config
+	}
+	return DefaultSearchConfig
+}
+
+// SetSearchConfig đổi text search configuration của dialect postgres
+func SetSearchConfig(config string) error {
+	return New().(*ExprPostgres).SetSearchConfig(config)
+}
+
+// SearchConfig trả về text search configuration đang dùng của dialect postgres
+func SearchConfig() string {
+	return New().(*ExprPostgres).GetSearchConfig()
+}
+
+// registerSearchFuncs đăng ký search(), configuration được đọc lúc compile
+// (sau khi lấy cache key, nên sql trong cache không bao giờ cũ hơn key của nó)
+func (e *ExprPostgres) registerSearchFuncs() {
+	e.funcs.Register("to_tsvector", 1, 2, nil)
+	e.funcs.Register("plainto_tsquery", 1, 2, nil)
+	e.funcs.Register("search", 2, 3, func(n *compiler.SimpleExprTree) error {
+		return compileSearch(n, e.GetSearchConfig())
+	})
+	e.funcs.Register("similar", 2, 2, compileSimilar)
+}
+
+// compileSearch: search(Title, ?) -> to_tsvector('simple', title) @@ plainto_tsquery('simple', ?),
+// đối số thứ ba (nếu có) là configuration riêng cho lần gọi này
+func compileSearch(n *compiler.SimpleExprTree, config string) error {
+	if len(n.Ns) == 3 {
+		arg := n.Ns[2]
+		value, err := arg.LiteralText()
+		if arg.Nt != "const" || arg.Lk != "string" || err != nil || !plainIdent.MatchString(value) {
+			return fmt.Errorf("invalid function call: the third argument of search must be a text search configuration such as 'english'")
+		}
+		config = value
+	}
+	cfg := func() *compiler.SimpleExprTree {
+		return &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: compiler.Quote(config)}
+	}
+	n.Nt = ""
+	n.Op = "@@"
+	n.Ns = []*compiler.SimpleExprTree{
+		{Nt: "func", V: "to_tsvector", Ns: []*compiler.SimpleExprTree{cfg(), n.Ns[0]}},
+		{Nt: "func", V: "plainto_tsquery", Ns: []*compiler.SimpleExprTree{cfg(), n.Ns[1]}},
+	}
+	return nil
+}
+
+// compileSimilar: similar(Name, ?) -> CAST(name AS text) % ? (toán tử của pg_trgm)
+func compileSimilar(n *compiler.SimpleExprTree) error {
+	n.Nt = ""
+	n.Op = "%"
+	n.Ns = []*compiler.SimpleExprTree{
+		{Nt: "cast", V: "text", Ns: []*compiler.SimpleExprTree{n.Ns[0]}},
+		n.Ns[1],
+	}
+	return nil
+}
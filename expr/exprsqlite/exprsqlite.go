@@ -0,0 +1,155 @@
+package exprsqlite
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nttlong/regorm/expr"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+type ExprSqlite struct {
+	*expr.Dialect
+	funcs *expr.FuncRegistry
+}
+
+// dialect is the key of sqlite in the compiled expression cache
+const dialect = "sqlite"
+
+var exprSqlite = &ExprSqlite{}
+var once sync.Once
+
+func New() expr.IExpr {
+	once.Do(func() {
+		exprSqlite = &ExprSqlite{Dialect: expr.NewDialect(dialect, quoteIdent)}
+		exprSqlite.funcs = exprSqlite.GetFuncRegistry()
+		registerBuiltinFuncs(exprSqlite.funcs)
+		exprSqlite.SetResolver(exprSqlite.resolveSqlite)
+	})
+	return exprSqlite
+}
+
+var compilerOp = map[string]string{
+	"&&":          "AND",
+	"||":          "OR",
+	"!":           "NOT",
+	"not":         "NOT",
+	"==":          "=",
+	"!=":          "<>",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+	"in":          "IN",
+	"not in":      "NOT IN",
+	"between":     "BETWEEN",
+	"not between": "NOT BETWEEN",
+	"like":        "LIKE",
+	"not like":    "NOT LIKE",
+}
+
+// sqlFunc đánh dấu (trong Lk) nút hàm do resolver tạo ra, tên hàm đã là sql của sqlite
+// nên không tra trong registry (strftime, printf... không dùng được trong biểu thức)
+const sqlFunc = "sql"
+
+func newSqlFunc(name string, args ...*compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	return &compiler.SimpleExprTree{Nt: "func", V: name, Lk: sqlFunc, Ns: args}
+}
+
+func (e *ExprSqlite) resolveSqlite(n *compiler.SimpleExprTree) error {
+	if (n.Op == "==" || n.Op == "=" || n.Op == "!=" || n.Op == "<>") && len(n.Ns) == 2 && n.Ns[1].Lk == "null" {
+		// "x == null" luôn là NULL, phải dùng IS NULL
+		if n.Op == "==" || n.Op == "=" {
+			n.Op = "is null"
+		} else {
+			n.Op = "is not null"
+		}
+		n.Nt = "postfix"
+		n.Ns = n.Ns[:1]
+	}
+	if n.Nt == "" && len(n.Ns) == 2 {
+		if err := resolveBinary(n); err != nil {
+			return err
+		}
+	}
+	if p, ok := compilerOp[strings.ToLower(n.Op)]; ok {
+		n.Op = p
+	}
+	switch n.Nt {
+	case "const":
+		return compileLiteral(n)
+	case "field":
+		if !compiler.IsValidColumnName(n.V) {
+			return fmt.Errorf("invalid column name: %s", n.V)
+		}
+		n.V = quoteIdent(compiler.ToSnakeCase(n.V))
+	case "column":
+		n.V = quoteIdent(n.V)
+		if n.Tb != "" {
+			n.V = quoteIdent(n.Tb) + "." + n.V
+			n.Tb = ""
+		}
+	case "func":
+		if n.Lk == sqlFunc {
+			return nil
+		}
+		return e.funcs.Translate(n)
+	}
+	// "json": sqlite (3.38+) có sẵn -> và ->> như postgres, "raw": sql đã render
+	return nil
+}
+
+// resolveBinary đổi các toán tử hai ngôi khác nghĩa trong sqlite
+func resolveBinary(n *compiler.SimpleExprTree) error {
+	switch strings.ToLower(n.Op) {
+	case "^":
+		return fmt.Errorf("operator ^ is not supported by sqlite")
+	case "?":
+		return fmt.Errorf("operator ? is not supported by sqlite")
+	case "like", "not like":
+		// sqlite không có ký tự escape mặc định, postgres dùng "\"
+		n.Ns[1] = newEscape(n.Ns[1])
+	case "ilike", "not ilike":
+		// like của sqlite vốn không phân biệt hoa thường (với chữ ascii)
+		n.Op = strings.Replace(strings.ToUpper(n.Op), "ILIKE", "LIKE", 1)
+		n.Ns[1] = newEscape(n.Ns[1])
+	}
+	return nil
+}
+
+// newEscape: x ESCAPE '\', x phức tạp phải ở trong ngoặc
+func newEscape(x *compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	if len(x.Ns) > 0 && x.Nt != "func" && x.Op != "()" {
+		x = &compiler.SimpleExprTree{Op: "()", Ns: []*compiler.SimpleExprTree{x}}
+	}
+	return &compiler.SimpleExprTree{Op: "ESCAPE", Ns: []*compiler.SimpleExprTree{
+		x, {Nt: "raw", V: `'\'`},
+	}}
+}
+
+// quoteIdent luôn đặt tên cột trong dấu nháy kép, tránh trùng từ khoá như order, key, desc
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// compileLiteral render hằng số theo loại của nó (Lk)
+func compileLiteral(n *compiler.SimpleExprTree) error {
+	switch n.Lk {
+	case "bool":
+		n.V = strings.ToUpper(n.V)
+	case "null":
+		n.V = "NULL"
+	case "date", "timestamp":
+		// sqlite không có kiểu ngày, ngày giờ được lưu dạng chuỗi 'YYYY-MM-DD HH:MM:SS'
+		value, err := n.LiteralText()
+		if err != nil {
+			return err
+		}
+		n.V = compiler.Quote(strings.Replace(value, "T", " ", 1))
+	case "int", "float", "string":
+		// đã được lexer kiểm tra, giữ nguyên
+	default:
+		return fmt.Errorf("unsupported literal %s", n.V)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package exprsqlite_test
+
+import (
+	"testing"
+
+	"github.com/nttlong/regorm/expr/compiler"
+	"github.com/nttlong/regorm/expr/exprsqlite"
+	"github.com/nttlong/regorm/expr/exprtest"
+	"github.com/nttlong/regorm/expr/factory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseConditional compiles the shared table of exprtest
+func TestParseConditional(t *testing.T) {
+	exprtest.Run(t, exprsqlite.New().CompileExpr, func(c exprtest.Case) string { return c.SQLite })
+}
+
+func TestJSONPath(t *testing.T) {
+	parser := exprsqlite.New()
+	data := []struct{ input, output string }{
+		{"Data.address.city == ?", "\"data\"->'address'->>'city' = ?"},
+		{"json(Data, 'items', 0, 'qty') == ?", "\"data\"->'items'->0->'qty' = ?"},
+		{"Data.age > 30 && Data.active == true", "\"data\"->>'age' > 30 AND \"data\"->>'active' = TRUE"},
+		{"cast(Data.age, 'numeric') > ?", "CAST(\"data\"->>'age' AS NUMERIC) > ?"},
+		{"cast(CreatedOn, 'date') == ? && cast(Data, 'jsonb') == ?", "date(\"created_on\") = ? AND json(\"data\") = ?"},
+	}
+	for _, test := range data {
+		r, err := parser.CompileExpr(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.output, r)
+	}
+	for _, input := range []string{"json(Data, 'tags') ? 'vip'", "cast(Code, 'money') == ?", "cast(Code, 'boolean') == ?"} {
+		_, err := parser.CompileExpr(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCompileOrderByAndSelect(t *testing.T) {
+	parser := exprsqlite.New()
+	r, err := parser.CompileOrderBy("CreatedOn desc, len(Name) asc", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"created_on\" DESC, length(\"name\") ASC", r)
+
+	r, err = parser.CompileSelect("ID, year(CreatedOn) as Year, Price * Qty Total", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"id\", CAST(strftime('%Y', \"created_on\") AS INTEGER) AS \"year\", \"price\" * \"qty\" AS \"total\"", r)
+}
+
+func TestRelations(t *testing.T) {
+	user := compiler.NewSchema("User", "users", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "Username", Name: "username"},
+	})
+	emp := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "DepartmentID", Name: "department_id"},
+		{Field: "Salary", Name: "salary"},
+	})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "User", Target: user, Column: "id", RefColumn: "id"})
+	dept := compiler.NewSchema("Dept", "depts", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+	})
+	dept.AddRelation(&compiler.SchemaRelation{Field: "Emps", Target: emp, Column: "id", RefColumn: "department_id", Many: true})
+
+	parser := exprsqlite.New()
+	c, err := parser.CompileCond("User.Username == ? and Salary > 1000", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"emps__user\".\"username\" = ? and \"emps\".\"salary\" > 1000", c.SQL)
+	assert.Equal(t, []string{"LEFT JOIN \"users\" \"emps__user\" ON \"emps__user\".\"id\" = \"emps\".\"id\""}, c.Joins)
+
+	c, err = parser.CompileCond("any(Emps, Salary >= ?)", dept)
+	assert.NoError(t, err)
+	assert.Equal(t, "EXISTS (SELECT 1 FROM \"emps\" \"depts__emps\" WHERE \"depts__emps\".\"department_id\" = \"depts\".\"id\" AND (\"depts__emps\".\"salary\" >= ?))", c.SQL)
+}
+
+func TestFactory(t *testing.T) {
+	assert.Same(t, exprsqlite.New(), factory.NewExpr("sqlite"))
+	r, err := factory.NewExpr("sqlite").CompileExpr("len(Name) > ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "length(\"name\") > ?", r)
+}
@@ -0,0 +1,96 @@
+package exprsqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// registerBuiltinFuncs đăng ký các hàm có sẵn của sqlite, cùng tên và cùng kết quả với postgres
+func registerBuiltinFuncs(funcs *expr.FuncRegistry) {
+	for _, name := range []string{"year", "month", "day", "hour", "minute", "second"} {
+		funcs.Register(name, 1, 1, compileTimeFunc)
+	}
+	funcs.Register("len", 1, 1, expr.RenameFunc("length"))
+	// concat của sqlite (3.44+) bỏ qua NULL như postgres
+	funcs.Register("concat", 1, -1, nil)
+	funcs.Register("lower", 1, 1, nil)
+	funcs.Register("upper", 1, 1, nil)
+	funcs.Register("trim", 1, 1, nil)
+	funcs.Register("coalesce", 1, -1, nil)
+	funcs.Register("substring", 2, 3, expr.RenameFunc("substr"))
+	funcs.Register("abs", 1, 1, nil)
+	funcs.Register("round", 1, 2, nil)
+	funcs.Register("now", 0, 0, compileNow)
+	// make_date(năm, tháng, ngày), Optimize dùng cho year(F) == ?
+	funcs.Register("make_date", 3, 3, compileMakeDate)
+	funcs.Register("cast", 2, 2, compileCast)
+	// hàm gộp, dùng trong Aggregate
+	funcs.Register("count", 1, 1, nil)
+	for _, name := range []string{"sum", "avg", "min", "max"} {
+		funcs.Register(name, 1, 1, nil)
+	}
+}
+
+// timeFormats là định dạng strftime của từng hàm lấy phần ngày giờ
+var timeFormats = map[string]string{
+	"year": "%Y", "month": "%m", "day": "%d", "hour": "%H", "minute": "%M", "second": "%S",
+}
+
+// compileTimeFunc: year(CreatedOn) -> CAST(strftime('%Y', "created_on") AS INTEGER),
+// strftime trả về chuỗi ('03') nên phải ép sang số để so với 3
+func compileTimeFunc(n *compiler.SimpleExprTree) error {
+	format := &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: compiler.Quote(timeFormats[strings.ToLower(n.V)])}
+	*n = compiler.SimpleExprTree{Nt: "cast", V: "INTEGER", Ns: []*compiler.SimpleExprTree{
+		newSqlFunc("strftime", format, n.Ns[0]),
+	}}
+	return nil
+}
+
+// compileNow: now() -> datetime('now'), cùng định dạng với hằng số timestamp
+func compileNow(n *compiler.SimpleExprTree) error {
+	*n = *newSqlFunc("datetime", &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: "'now'"})
+	return nil
+}
+
+// compileMakeDate: make_date(y, m, d) -> date(printf('%04d-%02d-%02d', y, m, d))
+func compileMakeDate(n *compiler.SimpleExprTree) error {
+	format := &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: "'%04d-%02d-%02d'"}
+	*n = *newSqlFunc("date", newSqlFunc("printf", append([]*compiler.SimpleExprTree{format}, n.Ns...)...))
+	return nil
+}
+
+// castTypes là kiểu của sqlite cho các kiểu được phép dùng trong cast(x, 'type'),
+// sqlite không ép được sang boolean
+var castTypes = map[string]string{
+	"numeric": "NUMERIC", "integer": "INTEGER", "bigint": "INTEGER", "double precision": "REAL", "text": "TEXT",
+}
+
+// castFuncs là các kiểu không có trong sqlite, dùng hàm chuẩn hoá giá trị thay cho CAST
+var castFuncs = map[string]string{
+	"date": "date", "timestamp": "datetime", "jsonb": "json",
+}
+
+// compileCast: cast(Data.age, 'numeric') -> CAST("data"->>'age' AS NUMERIC),
+// cast(x, 'date') -> date(x)
+func compileCast(n *compiler.SimpleExprTree) error {
+	typ, err := n.Ns[1].LiteralText()
+	if n.Ns[1].Nt != "const" || n.Ns[1].Lk != "string" || err != nil {
+		return fmt.Errorf("invalid function call: the second argument of cast must be a type name such as 'numeric'")
+	}
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if fn, ok := castFuncs[typ]; ok {
+		*n = *newSqlFunc(fn, n.Ns[0])
+		return nil
+	}
+	sqlType, ok := castTypes[typ]
+	if !ok {
+		return fmt.Errorf("invalid function call: cast to '%s' is not supported", typ)
+	}
+	n.Nt = "cast"
+	n.V = sqlType
+	n.Ns = n.Ns[:1]
+	return nil
+}
@@ -0,0 +1,257 @@
+package exprsqlserver
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nttlong/regorm/expr"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+type ExprSqlServer struct {
+	*expr.Dialect
+	funcs *expr.FuncRegistry
+}
+
+// dialect is the key of sql server in the compiled expression cache
+const dialect = "sqlserver"
+
+var exprSqlServer = &ExprSqlServer{}
+var once sync.Once
+
+func New() expr.IExpr {
+	once.Do(func() {
+		exprSqlServer = &ExprSqlServer{Dialect: expr.NewDialect(dialect, quoteIdent)}
+		exprSqlServer.funcs = exprSqlServer.GetFuncRegistry()
+		registerBuiltinFuncs(exprSqlServer.funcs)
+		exprSqlServer.SetResolver(exprSqlServer.resolveSqlServer)
+		exprSqlServer.SetCondResolver(resolveCondition)
+	})
+	return exprSqlServer
+}
+
+var compilerOp = map[string]string{
+	"&&":          "AND",
+	"||":          "OR",
+	"!":           "NOT",
+	"not":         "NOT",
+	"==":          "=",
+	"!=":          "<>",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+	"in":          "IN",
+	"not in":      "NOT IN",
+	"between":     "BETWEEN",
+	"not between": "NOT BETWEEN",
+	"like":        "LIKE",
+	"not like":    "NOT LIKE",
+}
+
+// sqlFunc đánh dấu (trong Lk) nút hàm do resolver tạo ra, tên hàm đã là sql của sql server
+// nên không tra trong registry (JSON_VALUE, POWER... không dùng được trong biểu thức)
+const sqlFunc = "sql"
+
+func newSqlFunc(name string, args ...*compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	return &compiler.SimpleExprTree{Nt: "func", V: name, Lk: sqlFunc, Ns: args}
+}
+
+func (e *ExprSqlServer) resolveSqlServer(n *compiler.SimpleExprTree) error {
+	if (n.Op == "==" || n.Op == "=" || n.Op == "!=" || n.Op == "<>") && len(n.Ns) == 2 && n.Ns[1].Lk == "null" {
+		// "x == null" luôn là NULL, phải dùng IS NULL
+		if n.Op == "==" || n.Op == "=" {
+			n.Op = "is null"
+		} else {
+			n.Op = "is not null"
+		}
+		n.Nt = "postfix"
+		n.Ns = n.Ns[:1]
+	}
+	if logicOps[strings.ToLower(n.Op)] {
+		bitOperands(n)
+	}
+	if n.Nt == "" && len(n.Ns) == 2 {
+		if err := resolveBinary(n); err != nil {
+			return err
+		}
+	}
+	if p, ok := compilerOp[strings.ToLower(n.Op)]; ok {
+		n.Op = p
+	}
+	switch n.Nt {
+	case "const":
+		return compileLiteral(n)
+	case "field":
+		if !compiler.IsValidColumnName(n.V) {
+			return fmt.Errorf("invalid column name: %s", n.V)
+		}
+		n.V = quoteIdent(compiler.ToSnakeCase(n.V))
+	case "column":
+		n.V = quoteIdent(n.V)
+		if n.Tb != "" {
+			n.V = quoteIdent(n.Tb) + "." + n.V
+			n.Tb = ""
+		}
+	case "json":
+		return compileJSON(n)
+	case "func":
+		if n.Lk == sqlFunc {
+			return nil
+		}
+		return e.funcs.Translate(n)
+	}
+	return nil
+}
+
+// logicOps là các toán tử mà toán hạng phải là điều kiện
+var logicOps = map[string]bool{"&&": true, "||": true, "and": true, "or": true, "!": true, "not": true}
+
+// bitOperands: sql server không có kiểu boolean, cột bit dùng làm điều kiện
+// (!Deleted && Active) phải so với 1: NOT [deleted] = 1 AND [active] = 1,
+// cột trong ngoặc cũng vậy: (Active) and Code == ? -> ([active] = 1) and [code] = ?
+func bitOperands(n *compiler.SimpleExprTree) {
+	for i, c := range n.Ns {
+		parent, idx := n, i
+		for c.Op == "()" && len(c.Ns) == 1 {
+			parent, idx, c = c, 0, c.Ns[0]
+		}
+		if isBitOperand(c) {
+			parent.Ns[idx] = compareWithOne(c)
+		}
+	}
+}
+
+// resolveCondition: cả điều kiện (where, having, điều kiện của any/all) chỉ là một cột bit
+// hoặc hằng bool cũng phải so với 1: Active -> [active] = 1, true -> 1 = 1
+func resolveCondition(n *compiler.SimpleExprTree) error {
+	for n.Op == "()" && len(n.Ns) == 1 {
+		n = n.Ns[0]
+	}
+	if isBitOperand(n) {
+		c := *n
+		*n = *compareWithOne(&c)
+	}
+	return nil
+}
+
+func isBitOperand(n *compiler.SimpleExprTree) bool {
+	return n.Nt == "field" || n.Nt == "column" || (n.Nt == "const" && n.Lk == "bool")
+}
+
+func compareWithOne(n *compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	return &compiler.SimpleExprTree{Op: "=", Ns: []*compiler.SimpleExprTree{
+		n, {Nt: "const", Lk: "int", V: "1"},
+	}}
+}
+
+// resolveBinary đổi các toán tử hai ngôi khác nghĩa trong sql server
+func resolveBinary(n *compiler.SimpleExprTree) error {
+	switch strings.ToLower(n.Op) {
+	case "^":
+		// ^ của sql server là xor
+		*n = *newSqlFunc("POWER", n.Ns...)
+	case "?":
+		return fmt.Errorf("operator ? is not supported by sqlserver")
+	case "like", "not like":
+		// sql server không có ký tự escape mặc định, postgres dùng "\"
+		n.Ns[1] = newEscape(n.Ns[1])
+	case "ilike", "not ilike":
+		n.Op = strings.Replace(strings.ToUpper(n.Op), "ILIKE", "LIKE", 1)
+		n.Ns[0] = newSqlFunc("LOWER", n.Ns[0])
+		n.Ns[1] = newEscape(newSqlFunc("LOWER", n.Ns[1]))
+	default:
+		if _, ok := compareOps[n.Op]; ok {
+			boolToJSONText(n)
+		}
+	}
+	return nil
+}
+
+var compareOps = map[string]bool{
+	"==": true, "=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// newEscape: x ESCAPE '\', x phức tạp phải ở trong ngoặc
+func newEscape(x *compiler.SimpleExprTree) *compiler.SimpleExprTree {
+	if len(x.Ns) > 0 && x.Nt != "func" && x.Op != "()" {
+		x = &compiler.SimpleExprTree{Op: "()", Ns: []*compiler.SimpleExprTree{x}}
+	}
+	return &compiler.SimpleExprTree{Op: "ESCAPE", Ns: []*compiler.SimpleExprTree{
+		x, {Nt: "raw", V: `'\'`},
+	}}
+}
+
+// boolToJSONText: giá trị json lấy ra bằng JSON_VALUE là text nên so với 'true' / 'false'
+func boolToJSONText(n *compiler.SimpleExprTree) {
+	for i, c := range n.Ns {
+		other := n.Ns[1-i]
+		if c.Nt == "const" && c.Lk == "bool" && other.Nt == "json" && other.Op == "->>" {
+			n.Ns[i] = &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: compiler.Quote(strings.ToLower(c.V))}
+		}
+	}
+}
+
+// compileJSON: data->'address'->>'city' -> JSON_VALUE([data], N'$."address"."city"'),
+// data->'tags' (object hoặc mảng) -> JSON_QUERY([data], N'$."tags"')
+func compileJSON(n *compiler.SimpleExprTree) error {
+	var path strings.Builder
+	path.WriteString("$")
+	for _, key := range n.Ns[1:] {
+		if key.Lk == "int" {
+			path.WriteString("[" + key.V + "]")
+			continue
+		}
+		text, err := key.LiteralText()
+		if err != nil || key.Nt != "const" || key.Lk != "string" {
+			return fmt.Errorf("invalid json key %s", key.V)
+		}
+		path.WriteString(`."` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`)
+	}
+	fn := "JSON_QUERY"
+	if n.Op == "->>" {
+		fn = "JSON_VALUE"
+	}
+	*n = *newSqlFunc(fn, n.Ns[0], &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: compiler.Quote(path.String())})
+	return nil
+}
+
+// quoteIdent luôn đặt tên cột trong ngoặc vuông, tránh trùng từ khoá như order, key, desc
+func quoteIdent(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// compileLiteral render hằng số theo loại của nó (Lk)
+func compileLiteral(n *compiler.SimpleExprTree) error {
+	switch n.Lk {
+	case "bool":
+		// bit: 1 / 0
+		if strings.ToLower(n.V) == "true" {
+			n.V = "1"
+		} else {
+			n.V = "0"
+		}
+	case "null":
+		n.V = "NULL"
+	case "date", "timestamp":
+		value, err := n.LiteralText()
+		if err != nil {
+			return err
+		}
+		typ := "DATE"
+		if n.Lk == "timestamp" {
+			typ = "DATETIME2"
+		}
+		*n = compiler.SimpleExprTree{Nt: "cast", V: typ, Ns: []*compiler.SimpleExprTree{
+			{Nt: "const", Lk: "string", V: compiler.Quote(strings.Replace(value, "T", " ", 1))},
+		}}
+	case "string":
+		// N'...' để giữ được ký tự unicode khi so với cột nvarchar
+		n.V = "N" + n.V
+	case "int", "float":
+		// đã được lexer kiểm tra, giữ nguyên
+	default:
+		return fmt.Errorf("unsupported literal %s", n.V)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package exprsqlserver_test
+
+import (
+	"testing"
+
+	"github.com/nttlong/regorm/expr/compiler"
+	"github.com/nttlong/regorm/expr/exprsqlserver"
+	"github.com/nttlong/regorm/expr/exprtest"
+	"github.com/nttlong/regorm/expr/factory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseConditional compiles the shared table of exprtest
+func TestParseConditional(t *testing.T) {
+	exprtest.Run(t, exprsqlserver.New().CompileExpr, func(c exprtest.Case) string { return c.SQLServer })
+}
+
+func TestBitOperandInParens(t *testing.T) {
+	parser := exprsqlserver.New()
+	// without the optimizer the parentheses stay, the column inside is still compared with 1
+	parser.SetOptimize(false)
+	defer parser.SetOptimize(true)
+	data := []struct{ input, output string }{
+		{"(Active) and Code == ?", "([active] = 1) and [code] = ?"},
+		{"((Active)) && !(Locked)", "(([active] = 1)) AND NOT ([locked] = 1)"},
+		{"Code == ? || (Active)", "[code] = ? OR ([active] = 1)"},
+		{"(Active)", "([active] = 1)"},
+	}
+	for _, d := range data {
+		r, err := parser.CompileExpr(d.input)
+		if assert.NoError(t, err, d.input) {
+			assert.Equal(t, d.output, r)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	parser := exprsqlserver.New()
+	data := []struct{ input, output string }{
+		{"Data.address.city == ?", "JSON_VALUE([data], N'$.\"address\".\"city\"') = ?"},
+		{"json(Data, 'tags') == ?", "JSON_QUERY([data], N'$.\"tags\"') = ?"},
+		{"Data.age > 30 && Data.active == true", "JSON_VALUE([data], N'$.\"age\"') > 30 AND JSON_VALUE([data], N'$.\"active\"') = N'true'"},
+		{"cast(Data.age, 'numeric') > ?", "CAST(JSON_VALUE([data], N'$.\"age\"') AS DECIMAL(38, 10)) > ?"},
+		{"cast(Data.vip, 'boolean') == true", "CAST(JSON_VALUE([data], N'$.\"vip\"') AS BIT) = 1"},
+	}
+	for _, test := range data {
+		r, err := parser.CompileExpr(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.output, r)
+	}
+	for _, input := range []string{"json(Data, 'tags') ? 'vip'", "cast(Code, 'money') == ?", "cast(Code, 'jsonb') == ?"} {
+		_, err := parser.CompileExpr(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCompileOrderByAndSelect(t *testing.T) {
+	parser := exprsqlserver.New()
+	r, err := parser.CompileOrderBy("CreatedOn desc, len(Name) asc", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "[created_on] DESC, LEN([name]) ASC", r)
+
+	r, err = parser.CompileSelect("ID, year(CreatedOn) as Year, Price * Qty Total", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "[id], DATEPART(year, [created_on]) AS [year], [price] * [qty] AS [total]", r)
+}
+
+func TestRelations(t *testing.T) {
+	user := compiler.NewSchema("User", "users", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "Username", Name: "username"},
+	})
+	emp := compiler.NewSchema("Emp", "emps", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+		{Field: "DepartmentID", Name: "department_id"},
+		{Field: "Salary", Name: "salary"},
+		{Field: "Active", Name: "active"},
+	})
+	emp.AddRelation(&compiler.SchemaRelation{Field: "User", Target: user, Column: "id", RefColumn: "id"})
+	dept := compiler.NewSchema("Dept", "depts", []compiler.SchemaColumn{
+		{Field: "ID", Name: "id"},
+	})
+	dept.AddRelation(&compiler.SchemaRelation{Field: "Emps", Target: emp, Column: "id", RefColumn: "department_id", Many: true})
+
+	parser := exprsqlserver.New()
+	c, err := parser.CompileCond("User.Username == ? and Salary > 1000", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "[emps__user].[username] = ? and [emps].[salary] > 1000", c.SQL)
+	assert.Equal(t, []string{"LEFT JOIN [users] [emps__user] ON [emps__user].[id] = [emps].[id]"}, c.Joins)
+
+	c, err = parser.CompileCond("any(Emps, Salary >= ?)", dept)
+	assert.NoError(t, err)
+	assert.Equal(t, "EXISTS (SELECT 1 FROM [emps] [depts__emps] WHERE [depts__emps].[department_id] = [depts].[id] AND ([depts__emps].[salary] >= ?))", c.SQL)
+
+	// a bit column alone is a condition too
+	c, err = parser.CompileCond("all(Emps, Active)", dept)
+	assert.NoError(t, err)
+	assert.Equal(t, "NOT EXISTS (SELECT 1 FROM [emps] [depts__emps] WHERE [depts__emps].[department_id] = [depts].[id] AND CASE WHEN ([depts__emps].[active] = 1) THEN 1 ELSE 0 END = 0)", c.SQL)
+	c, err = parser.CompileCond("any(Emps, (Active))", dept)
+	assert.NoError(t, err)
+	assert.Equal(t, "EXISTS (SELECT 1 FROM [emps] [depts__emps] WHERE [depts__emps].[department_id] = [depts].[id] AND ([depts__emps].[active] = 1))", c.SQL)
+
+	agg, err := parser.CompileAggregate("DepartmentID, Active", "DepartmentID, Active", "Active", emp)
+	assert.NoError(t, err)
+	assert.Equal(t, "[department_id], [active]", agg.Select)
+	assert.Equal(t, "[active] = 1", agg.Having.SQL)
+}
+
+func TestFactory(t *testing.T) {
+	assert.Same(t, exprsqlserver.New(), factory.NewExpr("sqlserver"))
+	r, err := factory.NewExpr("sqlserver").CompileExpr("len(Name) > ?")
+	assert.NoError(t, err)
+	assert.Equal(t, "LEN([name]) > ?", r)
+}
@@ -0,0 +1,99 @@
+package exprsqlserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// registerBuiltinFuncs đăng ký các hàm có sẵn của sql server, cùng tên và cùng kết quả với postgres
+func registerBuiltinFuncs(funcs *expr.FuncRegistry) {
+	for _, name := range []string{"year", "month", "day", "hour", "minute", "second"} {
+		funcs.Register(name, 1, 1, compileTimeFunc)
+	}
+	funcs.Register("len", 1, 1, expr.RenameFunc("LEN"))
+	funcs.Register("concat", 1, -1, compileConcat)
+	funcs.Register("lower", 1, 1, upperFunc)
+	funcs.Register("upper", 1, 1, upperFunc)
+	funcs.Register("trim", 1, 1, upperFunc)
+	funcs.Register("coalesce", 1, -1, upperFunc)
+	funcs.Register("substring", 2, 3, compileSubstring)
+	funcs.Register("abs", 1, 1, upperFunc)
+	funcs.Register("round", 1, 2, compileRound)
+	funcs.Register("now", 0, 0, expr.RenameFunc("SYSDATETIME"))
+	// make_date(năm, tháng, ngày), Optimize dùng cho year(F) == ?
+	funcs.Register("make_date", 3, 3, expr.RenameFunc("DATEFROMPARTS"))
+	funcs.Register("cast", 2, 2, compileCast)
+	// hàm gộp, dùng trong Aggregate
+	funcs.Register("count", 1, 1, upperFunc)
+	for _, name := range []string{"sum", "avg", "min", "max"} {
+		funcs.Register(name, 1, 1, upperFunc)
+	}
+}
+
+// upperFunc viết tên hàm bằng chữ hoa: lower(x) -> LOWER(x)
+func upperFunc(n *compiler.SimpleExprTree) error {
+	n.V = strings.ToUpper(n.V)
+	return nil
+}
+
+// compileTimeFunc: year(CreatedOn) -> DATEPART(year, [created_on])
+func compileTimeFunc(n *compiler.SimpleExprTree) error {
+	part := strings.ToLower(n.V)
+	n.V = "DATEPART"
+	n.Ns = []*compiler.SimpleExprTree{{Nt: "raw", V: part}, n.Ns[0]}
+	return nil
+}
+
+// compileConcat: CONCAT của sql server cần ít nhất hai đối số
+func compileConcat(n *compiler.SimpleExprTree) error {
+	n.V = "CONCAT"
+	if len(n.Ns) == 1 {
+		n.Ns = append(n.Ns, &compiler.SimpleExprTree{Nt: "const", Lk: "string", V: "''"})
+	}
+	return nil
+}
+
+// compileSubstring: SUBSTRING của sql server luôn cần độ dài, thiếu thì lấy đến hết chuỗi
+func compileSubstring(n *compiler.SimpleExprTree) error {
+	n.V = "SUBSTRING"
+	if len(n.Ns) == 2 {
+		n.Ns = append(n.Ns, &compiler.SimpleExprTree{Nt: "const", Lk: "int", V: "2147483647"})
+	}
+	return nil
+}
+
+// compileRound: ROUND của sql server luôn cần số chữ số
+func compileRound(n *compiler.SimpleExprTree) error {
+	n.V = "ROUND"
+	if len(n.Ns) == 1 {
+		n.Ns = append(n.Ns, &compiler.SimpleExprTree{Nt: "const", Lk: "int", V: "0"})
+	}
+	return nil
+}
+
+// castTypes là kiểu của sql server cho các kiểu được phép dùng trong cast(x, 'type'),
+// sql server không có kiểu json
+var castTypes = map[string]string{
+	"numeric": "DECIMAL(38, 10)", "integer": "INT", "bigint": "BIGINT", "double precision": "FLOAT",
+	"text": "NVARCHAR(MAX)", "boolean": "BIT", "date": "DATE", "timestamp": "DATETIME2",
+}
+
+// compileCast: cast(Data.age, 'numeric') -> CAST(JSON_VALUE([data], N'$."age"') AS DECIMAL(38, 10))
+func compileCast(n *compiler.SimpleExprTree) error {
+	typ, err := n.Ns[1].LiteralText()
+	if n.Ns[1].Nt != "const" || n.Ns[1].Lk != "string" || err != nil {
+		return fmt.Errorf("invalid function call: the second argument of cast must be a type name such as 'numeric'")
+	}
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	sqlType, ok := castTypes[typ]
+	if !ok {
+		return fmt.Errorf("invalid function call: cast to '%s' is not supported", typ)
+	}
+	n.Nt = "cast"
+	n.V = sqlType
+	n.Ns = n.Ns[:1]
+	return nil
+}
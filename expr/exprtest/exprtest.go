@@ -0,0 +1,285 @@
+// Package exprtest holds the compiler test table shared by the tests of the dialects,
+// so one filter string is checked on every database
+package exprtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Case is an expression with the sql expected from each dialect, "error" when the
+// dialect rejects it
+type Case struct {
+	Expr      string
+	Postgres  string
+	MySQL     string
+	SQLite    string
+	SQLServer string
+}
+
+// Cases is the compiler test table, every dialect compiles all of them
+var Cases = []Case{
+	{"(year(CreatedOn) == ?) && (month(CreatedOn) == ?)",
+		"created_on >= make_date(?, 1, 1) AND created_on < make_date(? + 1, 1, 1) AND date_part('month', created_on) = ?",
+		"`created_on` >= MAKEDATE(?, 1) AND `created_on` < MAKEDATE(? + 1, 1) AND MONTH(`created_on`) = ?",
+		"\"created_on\" >= date(printf('%04d-%02d-%02d', ?, 1, 1)) AND \"created_on\" < date(printf('%04d-%02d-%02d', ? + 1, 1, 1)) AND CAST(strftime('%m', \"created_on\") AS INTEGER) = ?",
+		"[created_on] >= DATEFROMPARTS(?, 1, 1) AND [created_on] < DATEFROMPARTS(? + 1, 1, 1) AND DATEPART(month, [created_on]) = ?"},
+	{"year(Id,code)",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"year(Id)",
+		"date_part('year', id)",
+		"YEAR(`id`)",
+		"CAST(strftime('%Y', \"id\") AS INTEGER)",
+		"DATEPART(year, [id])"},
+	{"UserName like '%%adm\\%in%%'",
+		"user_name like '%%adm\\%in%%'",
+		"`user_name` LIKE '%%adm\\\\%in%%' COLLATE utf8mb4_bin",
+		"\"user_name\" LIKE '%%adm\\%in%%' ESCAPE '\\'",
+		"[user_name] LIKE N'%%adm\\%in%%' ESCAPE '\\'"},
+	{"year()",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"month(ID)",
+		"date_part('month', id)",
+		"MONTH(`id`)",
+		"CAST(strftime('%m', \"id\") AS INTEGER)",
+		"DATEPART(month, [id])"},
+	{"day(ID)",
+		"date_part('day', id)",
+		"DAY(`id`)",
+		"CAST(strftime('%d', \"id\") AS INTEGER)",
+		"DATEPART(day, [id])"},
+	{"hour(ID)",
+		"date_part('hour', id)",
+		"HOUR(`id`)",
+		"CAST(strftime('%H', \"id\") AS INTEGER)",
+		"DATEPART(hour, [id])"},
+	{"minute(ID)",
+		"date_part('minute', id)",
+		"MINUTE(`id`)",
+		"CAST(strftime('%M', \"id\") AS INTEGER)",
+		"DATEPART(minute, [id])"},
+	{"second(ID)",
+		"date_part('second', id)",
+		"SECOND(`id`)",
+		"CAST(strftime('%S', \"id\") AS INTEGER)",
+		"DATEPART(second, [id])"},
+	{"ID",
+		"id",
+		"`id`",
+		"\"id\"",
+		"[id] = 1"},
+	{"!Deleted && ManagerID is null",
+		"NOT deleted AND manager_id IS NULL",
+		"NOT `deleted` AND `manager_id` IS NULL",
+		"NOT \"deleted\" AND \"manager_id\" IS NULL",
+		"NOT [deleted] = 1 AND [manager_id] IS NULL"},
+	{"not (Code == ?) || Code != ?",
+		"NOT (code = ?) OR code <> ?",
+		"NOT (`code` = ?) OR `code` <> ?",
+		"NOT (\"code\" = ?) OR \"code\" <> ?",
+		"NOT ([code] = ?) OR [code] <> ?"},
+	{"Code <> ? && Manager is not null",
+		"code <> ? AND manager IS NOT NULL",
+		"`code` <> ? AND `manager` IS NOT NULL",
+		"\"code\" <> ? AND \"manager\" IS NOT NULL",
+		"[code] <> ? AND [manager] IS NOT NULL"},
+	{"Status in ? && Code not in (?, ?)",
+		"status IN ? AND code NOT IN (?, ?)",
+		"`status` IN ? AND `code` NOT IN (?, ?)",
+		"\"status\" IN ? AND \"code\" NOT IN (?, ?)",
+		"[status] IN ? AND [code] NOT IN (?, ?)"},
+	{"Price between ? and ? || Price not between ? and ?",
+		"price BETWEEN ? AND ? OR price NOT BETWEEN ? AND ?",
+		"`price` BETWEEN ? AND ? OR `price` NOT BETWEEN ? AND ?",
+		"\"price\" BETWEEN ? AND ? OR \"price\" NOT BETWEEN ? AND ?",
+		"[price] BETWEEN ? AND ? OR [price] NOT BETWEEN ? AND ?"},
+	{"Active == true && Manager == null && Code != null",
+		"active = TRUE AND manager IS NULL AND code IS NOT NULL",
+		"`active` = TRUE AND `manager` IS NULL AND `code` IS NOT NULL",
+		"\"active\" = TRUE AND \"manager\" IS NULL AND \"code\" IS NOT NULL",
+		"[active] = 1 AND [manager] IS NULL AND [code] IS NOT NULL"},
+	{"CreatedOn >= date '2024-01-31' && UpdatedOn < timestamp '2024-02-01T10:30:00'",
+		"created_on >= DATE '2024-01-31' AND updated_on < TIMESTAMP '2024-02-01 10:30:00'",
+		"`created_on` >= DATE '2024-01-31' AND `updated_on` < TIMESTAMP '2024-02-01 10:30:00'",
+		"\"created_on\" >= '2024-01-31' AND \"updated_on\" < '2024-02-01 10:30:00'",
+		"[created_on] >= CAST(N'2024-01-31' AS DATE) AND [updated_on] < CAST(N'2024-02-01 10:30:00' AS DATETIME2)"},
+	{"Price > -1.5 && Note == 'it''s (a, b)'",
+		"price > -1.5 AND note = 'it''s (a, b)'",
+		"`price` > -1.5 AND `note` = 'it''s (a, b)'",
+		"\"price\" > -1.5 AND \"note\" = 'it''s (a, b)'",
+		"[price] > -1.5 AND [note] = N'it''s (a, b)'"},
+	{"Code == 1m2",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"Price == 1.5.3",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"A == - -1 && B == 2",
+		"a = 1 AND b = 2",
+		"`a` = 1 AND `b` = 2",
+		"\"a\" = 1 AND \"b\" = 2",
+		"[a] = 1 AND [b] = 2"},
+	{"len(Name) > ? && LOWER(Code) == lower(?)",
+		"length(name) > ? AND lower(code) = lower(?)",
+		"CHAR_LENGTH(`name`) > ? AND LOWER(`code`) = LOWER(?)",
+		"length(\"name\") > ? AND lower(\"code\") = lower(?)",
+		"LEN([name]) > ? AND LOWER([code]) = LOWER(?)"},
+	{"concat(FirstName, ' ', LastName) like ?",
+		"concat(first_name, ' ', last_name) like ?",
+		"CONCAT_WS('', `first_name`, ' ', `last_name`) LIKE ? COLLATE utf8mb4_bin",
+		"concat(\"first_name\", ' ', \"last_name\") LIKE ? ESCAPE '\\'",
+		"CONCAT([first_name], N' ', [last_name]) LIKE ? ESCAPE '\\'"},
+	{"coalesce(Note, trim(Code), '') == upper(?)",
+		"coalesce(note, trim(code), '') = upper(?)",
+		"COALESCE(`note`, TRIM(`code`), '') = UPPER(?)",
+		"coalesce(\"note\", trim(\"code\"), '') = upper(?)",
+		"COALESCE([note], TRIM([code]), N'') = UPPER(?)"},
+	{"substring(Code, 1, 3) == ? && abs(Qty) > round(Price, 2)",
+		"substring(code, 1, 3) = ? AND abs(qty) > round(CAST(price AS numeric), 2)",
+		"SUBSTRING(`code`, 1, 3) = ? AND ABS(`qty`) > ROUND(`price`, 2)",
+		"substr(\"code\", 1, 3) = ? AND abs(\"qty\") > round(\"price\", 2)",
+		"SUBSTRING([code], 1, 3) = ? AND ABS([qty]) > ROUND([price], 2)"},
+	{"CreatedOn < now() && round(Price) > 1",
+		"created_on < now() AND round(price) > 1",
+		"`created_on` < NOW() AND ROUND(`price`) > 1",
+		"\"created_on\" < datetime('now') AND round(\"price\") > 1",
+		"[created_on] < SYSDATETIME() AND ROUND([price], 0) > 1"},
+	{"foo(Code) == ?",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"lower(Code, Name) == ?",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"substring(Code) == ?",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"now(1) > CreatedOn",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"Name ilike ? && Code not ilike ?",
+		"name ilike ? AND code not ilike ?",
+		"LOWER(`name`) LIKE LOWER(?) AND LOWER(`code`) NOT LIKE LOWER(?)",
+		"\"name\" LIKE ? ESCAPE '\\' AND \"code\" NOT LIKE ? ESCAPE '\\'",
+		"LOWER([name]) LIKE LOWER(?) ESCAPE '\\' AND LOWER([code]) NOT LIKE LOWER(?) ESCAPE '\\'"},
+	// full text search is only available in postgres
+	{"search(Title, ?) && Active",
+		"to_tsvector('simple', title) @@ plainto_tsquery('simple', ?) AND active",
+		"error",
+		"error",
+		"error"},
+	{"search(concat(Title, ' ', Body), ?, 'english')",
+		"to_tsvector('english', concat(title, ' ', body)) @@ plainto_tsquery('english', ?)",
+		"error",
+		"error",
+		"error"},
+	{"similar(Name, ?) || Code == ?",
+		"CAST(name AS text) % ? OR code = ?",
+		"error",
+		"error",
+		"error"},
+	{"search(Title, ?, Lang)",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"similar(Name)",
+		"error",
+		"error",
+		"error",
+		"error"},
+	{"Price ^ 2 > 10",
+		"price ^ 2 > 10",
+		"POW(`price`, 2) > 10",
+		"error",
+		"POWER([price], 2) > 10"},
+	{"Name not like ? || Note like concat(Code, '%')",
+		"name not like ? OR note like concat(code, '%')",
+		"`name` NOT LIKE ? COLLATE utf8mb4_bin OR `note` LIKE CONCAT_WS('', `code`, '%') COLLATE utf8mb4_bin",
+		"\"name\" NOT LIKE ? ESCAPE '\\' OR \"note\" LIKE concat(\"code\", '%') ESCAPE '\\'",
+		"[name] NOT LIKE ? ESCAPE '\\' OR [note] LIKE CONCAT([code], N'%') ESCAPE '\\'"},
+	{"Note like Code + 'x'",
+		"note like code + 'x'",
+		"`note` LIKE (`code` + 'x') COLLATE utf8mb4_bin",
+		"\"note\" LIKE (\"code\" + 'x') ESCAPE '\\'",
+		"[note] LIKE ([code] + N'x') ESCAPE '\\'"},
+	{"Note == 'a\\nb'",
+		"note = 'a\\nb'",
+		"`note` = 'a\\\\nb'",
+		"\"note\" = 'a\\nb'",
+		"[note] = N'a\\nb'"},
+	{"year(CreatedOn) == 2024 && month(CreatedOn) == 2",
+		"created_on >= TIMESTAMP '2024-02-01 00:00:00' AND created_on < TIMESTAMP '2024-03-01 00:00:00'",
+		"`created_on` >= TIMESTAMP '2024-02-01 00:00:00' AND `created_on` < TIMESTAMP '2024-03-01 00:00:00'",
+		"\"created_on\" >= '2024-02-01 00:00:00' AND \"created_on\" < '2024-03-01 00:00:00'",
+		"[created_on] >= CAST(N'2024-02-01 00:00:00' AS DATETIME2) AND [created_on] < CAST(N'2024-03-01 00:00:00' AS DATETIME2)"},
+	{"year(CreatedOn) == 2024 && day(CreatedOn) == ?",
+		"created_on >= TIMESTAMP '2024-01-01 00:00:00' AND created_on < TIMESTAMP '2025-01-01 00:00:00' AND date_part('day', created_on) = ?",
+		"`created_on` >= TIMESTAMP '2024-01-01 00:00:00' AND `created_on` < TIMESTAMP '2025-01-01 00:00:00' AND DAY(`created_on`) = ?",
+		"\"created_on\" >= '2024-01-01 00:00:00' AND \"created_on\" < '2025-01-01 00:00:00' AND CAST(strftime('%d', \"created_on\") AS INTEGER) = ?",
+		"[created_on] >= CAST(N'2024-01-01 00:00:00' AS DATETIME2) AND [created_on] < CAST(N'2025-01-01 00:00:00' AS DATETIME2) AND DATEPART(day, [created_on]) = ?"},
+	{"make_date(2024, Month, 1) > CreatedOn",
+		"make_date(2024, month, 1) > created_on",
+		"STR_TO_DATE(CONCAT_WS('-', 2024, `month`, 1), '%Y-%c-%e') > `created_on`",
+		"date(printf('%04d-%02d-%02d', 2024, \"month\", 1)) > \"created_on\"",
+		"DATEFROMPARTS(2024, [month], 1) > [created_on]"},
+	{"(Locked)",
+		"locked",
+		"`locked`",
+		"\"locked\"",
+		"[locked] = 1"},
+	{"1 == 1",
+		"TRUE",
+		"TRUE",
+		"TRUE",
+		"1 = 1"},
+	{"!Active",
+		"NOT active",
+		"NOT `active`",
+		"NOT \"active\"",
+		"NOT [active] = 1"},
+	{"substring(Code, 2) == ? && concat(Name) == ?",
+		"substring(code, 2) = ? AND concat(name) = ?",
+		"SUBSTRING(`code`, 2) = ? AND CONCAT_WS('', `name`) = ?",
+		"substr(\"code\", 2) = ? AND concat(\"name\") = ?",
+		"SUBSTRING([code], 2, 2147483647) = ? AND CONCAT([name], N'') = ?"},
+	{"Active && (Code == ? || Locked)",
+		"active AND (code = ? OR locked)",
+		"`active` AND (`code` = ? OR `locked`)",
+		"\"active\" AND (\"code\" = ? OR \"locked\")",
+		"[active] = 1 AND ([code] = ? OR [locked] = 1)"},
+}
+
+// Run compiles the expression of every case with compile and compares the result
+// with the sql that want picks from the case, e.g. Run(t, exprmysql.New().CompileExpr, func(c Case) string { return c.MySQL })
+func Run(t *testing.T, compile func(expr string) (string, error), want func(c Case) string) {
+	t.Helper()
+	for _, c := range Cases {
+		sql, err := compile(c.Expr)
+		if want(c) == "error" {
+			assert.Error(t, err, c.Expr)
+			continue
+		}
+		if assert.NoError(t, err, c.Expr) {
+			assert.Equal(t, want(c), sql, c.Expr)
+		}
+	}
+}
@@ -3,13 +3,22 @@ package factory
 import (
 	"github.com/nttlong/regorm/expr"
 
+	"github.com/nttlong/regorm/expr/exprmysql"
 	"github.com/nttlong/regorm/expr/exprpostgres"
+	"github.com/nttlong/regorm/expr/exprsqlite"
+	"github.com/nttlong/regorm/expr/exprsqlserver"
 )
 
 func NewExpr(driver string) expr.IExpr {
 	switch driver {
 	case "postgres":
 		return exprpostgres.New()
+	case "mysql":
+		return exprmysql.New()
+	case "sqlite":
+		return exprsqlite.New()
+	case "sqlserver":
+		return exprsqlserver.New()
 	default:
 		panic("Unsupported driver: " + driver)
 	}
@@ -0,0 +1,382 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// Filter is a condition written as a JSON document, as sent by a UI or kept as a saved search:
+//
+//	{"and": [
+//	  {"field": "Code", "op": "eq", "value": "A01"},
+//	  {"or": [
+//	    {"field": "Price", "op": "between", "value": [10, 20]},
+//	    {"not": {"field": "Data.address.city", "op": "in", "value": ["Hanoi", "Hue"]}}
+//	  ]}
+//	]}
+//
+// A node is either a group ("and" / "or" with at least one item), a negation ("not")
+// or a test of a field. Ops are eq, ne, lt, lte, gt, gte, like, ilike, notLike, notIlike
+// (value is a scalar), in, notIn (value is a non-empty array), between, notBetween
+// (value is an array of 2) and isNull, isNotNull (no value).
+// Values are always bound as parameters, they never become part of the expression text.
+type Filter struct {
+	And   []*Filter   `json:"and,omitempty"`
+	Or    []*Filter   `json:"or,omitempty"`
+	Not   *Filter     `json:"not,omitempty"`
+	Field string      `json:"field,omitempty"`
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// operators of the filter ops which compare a field with one value
+var filterCompareOps = map[string]string{
+	"eq":       "==",
+	"ne":       "!=",
+	"lt":       "<",
+	"lte":      "<=",
+	"gt":       ">",
+	"gte":      ">=",
+	"like":     "like",
+	"ilike":    "ilike",
+	"notLike":  "not like",
+	"notIlike": "not ilike",
+}
+
+// filter ops of the operators of an expression, the reverse of filterCompareOps
+var filterOpNames = map[string]string{
+	"==": "eq", "=": "eq", "!=": "ne", "<>": "ne",
+	"<": "lt", "<=": "lte", ">": "gt", ">=": "gte",
+	"like": "like", "ilike": "ilike", "not like": "notLike", "not ilike": "notIlike",
+	"in": "in", "not in": "notIn", "between": "between", "not between": "notBetween",
+	"is null": "isNull", "is not null": "isNotNull",
+}
+
+// ToTree converts the filter to an expression tree with positional "?" parameters,
+// args are their values in order
+func (f *Filter) ToTree() (*compiler.SimpleExprTree, []interface{}, error) {
+	var args []interface{}
+	b, err := f.builder(&args)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := b.Build()
+	if err != nil {
+		return nil, nil, fmt.Errorf("filter: %w", err)
+	}
+	return tree, args, nil
+}
+
+func (f *Filter) builder(args *[]interface{}) (*Builder, error) {
+	if f == nil {
+		return nil, fmt.Errorf("filter: empty filter")
+	}
+	kinds := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Not != nil, f.Field != "" || f.Op != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("filter: a node must have exactly one of 'and', 'or', 'not' or 'field'")
+	}
+	switch {
+	case f.And != nil || f.Or != nil:
+		op, items := "and", f.And
+		if f.Or != nil {
+			op, items = "or", f.Or
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("filter: '%s' requires at least one item", op)
+		}
+		conds := make([]interface{}, len(items))
+		for i, item := range items {
+			b, err := item.builder(args)
+			if err != nil {
+				return nil, err
+			}
+			conds[i] = b
+		}
+		return join(op, conds), nil
+	case f.Not != nil:
+		b, err := f.Not.builder(args)
+		if err != nil {
+			return nil, err
+		}
+		return Not(b), nil
+	}
+
+	field := Field(f.Field)
+	if op, ok := filterCompareOps[f.Op]; ok {
+		if err := checkFilterValue(f, f.Value); err != nil {
+			return nil, err
+		}
+		*args = append(*args, f.Value)
+		return field.binary(op, Param()), nil
+	}
+	switch f.Op {
+	case "in", "notIn":
+		values, ok := filterValues(f.Value)
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("filter: op '%s' on %s requires a non-empty array", f.Op, f.Field)
+		}
+		for _, v := range values {
+			if err := checkFilterValue(f, v); err != nil {
+				return nil, err
+			}
+		}
+		*args = append(*args, values)
+		return field.in(strings.Replace(f.Op, "notIn", "not in", 1), []interface{}{Param()}), nil
+	case "between", "notBetween":
+		values, ok := filterValues(f.Value)
+		if !ok || len(values) != 2 {
+			return nil, fmt.Errorf("filter: op '%s' on %s requires an array of 2 values", f.Op, f.Field)
+		}
+		for _, v := range values {
+			if err := checkFilterValue(f, v); err != nil {
+				return nil, err
+			}
+		}
+		*args = append(*args, values...)
+		return field.between(strings.Replace(f.Op, "notBetween", "not between", 1), Param(), Param()), nil
+	case "isNull", "isNotNull":
+		if f.Value != nil {
+			return nil, fmt.Errorf("filter: op '%s' on %s does not take a value", f.Op, f.Field)
+		}
+		if f.Op == "isNull" {
+			return field.IsNull(), nil
+		}
+		return field.IsNotNull(), nil
+	}
+	return nil, fmt.Errorf("filter: unknown op '%s' on %s", f.Op, f.Field)
+}
+
+// checkFilterValue accepts scalar values only (numbers, strings, bool, time.Time)
+func checkFilterValue(f *Filter, v interface{}) error {
+	if v == nil {
+		return fmt.Errorf("filter: op '%s' on %s requires a value, use isNull to test for null", f.Op, f.Field)
+	}
+	if _, ok := v.(time.Time); ok {
+		return nil
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return nil
+	}
+	return fmt.Errorf("filter: invalid value %v of type %T for op '%s' on %s", v, v, f.Op, f.Field)
+}
+
+// filterValues returns the items of an array value
+func filterValues(v interface{}) ([]interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	ret := make([]interface{}, rv.Len())
+	for i := range ret {
+		ret[i] = rv.Index(i).Interface()
+	}
+	return ret, true
+}
+
+// FilterFromTree converts an expression tree back to a filter, args are the values of
+// its positional "?" parameters. Constants of the expression become values of the filter.
+// Only conditions a filter can express are accepted: and / or / not of tests whose left
+// operand is a field (or json path) and whose right operand is a parameter or a constant.
+func FilterFromTree(tree *compiler.SimpleExprTree, args ...interface{}) (*Filter, error) {
+	r := &filterReader{args: args}
+	ret, err := r.read(tree)
+	if err != nil {
+		return nil, err
+	}
+	if r.next < len(args) {
+		return nil, fmt.Errorf("filter: expression has %d parameter(s), got %d value(s)", r.next, len(args))
+	}
+	return ret, nil
+}
+
+type filterReader struct {
+	args []interface{}
+	next int
+}
+
+func (r *filterReader) read(n *compiler.SimpleExprTree) (*Filter, error) {
+	for n.Op == "()" {
+		n = n.Ns[0]
+	}
+	logic := logicOp(n.Op)
+	if n.Nt == "" && (logic == "and" || logic == "or") {
+		var items []*Filter
+		for _, c := range flattenOp(n, logic, nil) {
+			item, err := r.read(c)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if logic == "and" {
+			return &Filter{And: items}, nil
+		}
+		return &Filter{Or: items}, nil
+	}
+	if n.Nt == "unary" && logic == "not" {
+		inner, err := r.read(n.Ns[0])
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Not: inner}, nil
+	}
+	op, ok := filterOpNames[n.Op]
+	if !ok || len(n.Ns) == 0 || (n.Nt != "" && n.Nt != "postfix" && n.Nt != "between") {
+		return nil, fmt.Errorf("filter: expression %s cannot be written as a filter", n.String())
+	}
+	field := n.Ns[0]
+	for field.Op == "()" {
+		field = field.Ns[0]
+	}
+	if field.Nt != "field" && field.Nt != "json" {
+		return nil, fmt.Errorf("filter: left operand of %s must be a field", n.String())
+	}
+	ret := &Filter{Field: field.String(), Op: op}
+	switch {
+	case n.Nt == "postfix":
+		return ret, nil
+	case n.Nt == "between":
+		low, err := r.value(n.Ns[1])
+		if err != nil {
+			return nil, err
+		}
+		high, err := r.value(n.Ns[2])
+		if err != nil {
+			return nil, err
+		}
+		ret.Value = []interface{}{low, high}
+		return ret, nil
+	case op == "in" || op == "notIn":
+		right := n.Ns[1]
+		if right.Nt != "list" {
+			v, err := r.value(right)
+			if err != nil {
+				return nil, err
+			}
+			ret.Value = v
+			return ret, nil
+		}
+		values := make([]interface{}, len(right.Ns))
+		for i, c := range right.Ns {
+			v, err := r.value(c)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		ret.Value = values
+		return ret, nil
+	}
+	v, err := r.value(n.Ns[1])
+	if err != nil {
+		return nil, err
+	}
+	ret.Value = v
+	return ret, nil
+}
+
+// value returns the value of a parameter or constant operand
+func (r *filterReader) value(n *compiler.SimpleExprTree) (interface{}, error) {
+	for n.Op == "()" {
+		n = n.Ns[0]
+	}
+	switch n.Nt {
+	case "param":
+		if n.ParamName() != "" {
+			return nil, fmt.Errorf("filter: named parameter %s is not supported, use \"?\"", n.V)
+		}
+		if r.next >= len(r.args) {
+			return nil, fmt.Errorf("filter: missing value of parameter %d", r.next+1)
+		}
+		r.next++
+		return r.args[r.next-1], nil
+	case "const":
+		return constValue(n)
+	}
+	return nil, fmt.Errorf("filter: operand %s must be a parameter or a constant", n.String())
+}
+
+// constValue returns the Go value of a constant node, dates are returned as their text
+func constValue(n *compiler.SimpleExprTree) (interface{}, error) {
+	switch n.Lk {
+	case "null":
+		return nil, nil
+	case "bool":
+		return strings.EqualFold(n.V, "true"), nil
+	case "int":
+		return strconv.ParseInt(n.V, 10, 64)
+	case "float":
+		return strconv.ParseFloat(n.V, 64)
+	case "string":
+		return compiler.Unquote(n.V)
+	case "date", "timestamp":
+		return compiler.Unquote(strings.TrimSpace(n.V[len(n.Lk):]))
+	}
+	return nil, fmt.Errorf("filter: unsupported constant %s", n.V)
+}
+
+// logicOp returns and, or, not for both spellings of a logical operator (&&, ||, !),
+// other operators are returned unchanged
+func logicOp(op string) string {
+	switch strings.ToLower(op) {
+	case "and", "&&":
+		return "and"
+	case "or", "||":
+		return "or"
+	case "not", "!":
+		return "not"
+	}
+	return op
+}
+
+// flattenOp lists the operands of a chain of the same and/or operator
+func flattenOp(n *compiler.SimpleExprTree, op string, ret []*compiler.SimpleExprTree) []*compiler.SimpleExprTree {
+	for n.Op == "()" {
+		n = n.Ns[0]
+	}
+	if n.Nt != "" || logicOp(n.Op) != op {
+		return append(ret, n)
+	}
+	for _, c := range n.Ns {
+		ret = flattenOp(c, op, ret)
+	}
+	return ret
+}
+
+// ExpandFilter replaces a *Filter in conds[0] by its expression tree followed by its values,
+// so a storage handles it like any other condition. A filter carries its own values,
+// no other item may follow it.
+func ExpandFilter(conds []interface{}) ([]interface{}, error) {
+	if len(conds) == 0 {
+		return conds, nil
+	}
+	f, ok := conds[0].(*Filter)
+	if !ok {
+		return conds, nil
+	}
+	if len(conds) > 1 {
+		return nil, fmt.Errorf("filter: a filter carries its own values, got %d extra argument(s)", len(conds)-1)
+	}
+	tree, args, err := f.ToTree()
+	if err != nil {
+		return nil, err
+	}
+	return append([]interface{}{tree}, args...), nil
+}
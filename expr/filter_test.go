@@ -0,0 +1,119 @@
+package expr_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nttlong/regorm/expr"
+	"github.com/nttlong/regorm/expr/compiler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterToTree(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want string
+		args []interface{}
+	}{
+		{`{"field": "Code", "op": "eq", "value": "A01"}`, "Code == ?", []interface{}{"A01"}},
+		{`{"and": [{"field": "Code", "op": "eq", "value": "x' or 1 == 1"}, {"or": [{"field": "Price", "op": "between", "value": [10, 20]}, {"field": "Note", "op": "isNull"}]}]}`,
+			"Code == ? and (Price between ? and ? or Note is null)", []interface{}{"x' or 1 == 1", 10.0, 20.0}},
+		{`{"not": {"field": "Data.address.city", "op": "in", "value": ["Hanoi", "Hue"]}}`,
+			"not Data.address.city in ?", []interface{}{[]interface{}{"Hanoi", "Hue"}}},
+		{`{"or": [{"field": "Name", "op": "notIlike", "value": "a%"}, {"field": "Active", "op": "ne", "value": true}]}`,
+			"Name not ilike ? or Active != ?", []interface{}{"a%", true}},
+	}
+	for _, tt := range tests {
+		var f expr.Filter
+		assert.NoError(t, json.Unmarshal([]byte(tt.doc), &f))
+		tree, args, err := f.ToTree()
+		if assert.NoError(t, err, tt.doc) {
+			assert.Equal(t, tt.want, tree.String())
+			assert.Equal(t, tt.args, args)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		doc string
+		err string
+	}{
+		{`{}`, "exactly one"},
+		{`{"and": [], "field": "A", "op": "eq", "value": 1}`, "exactly one"},
+		{`{"or": []}`, "at least one"},
+		{`{"field": "A", "op": "contains", "value": 1}`, "unknown op"},
+		{`{"field": "A", "op": "eq"}`, "isNull"},
+		{`{"field": "A", "op": "eq", "value": {"x": 1}}`, "invalid value"},
+		{`{"field": "A", "op": "in", "value": []}`, "non-empty array"},
+		{`{"field": "A", "op": "between", "value": [1]}`, "array of 2"},
+		{`{"field": "A", "op": "isNull", "value": 1}`, "does not take a value"},
+		{`{"field": "A or 1", "op": "eq", "value": 1}`, "field"},
+	}
+	for _, tt := range tests {
+		var f expr.Filter
+		assert.NoError(t, json.Unmarshal([]byte(tt.doc), &f))
+		_, _, err := f.ToTree()
+		if assert.Error(t, err, tt.doc) {
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	}
+}
+
+func TestFilterFromTree(t *testing.T) {
+	tree, err := compiler.ParseExpr("Code == ? and (Price between 10 and ? or not Name like 'a%') and ID in (1, ?) and Note is not null")
+	assert.NoError(t, err)
+	f, err := expr.FilterFromTree(tree, "A01", 20.5, int64(2))
+	assert.NoError(t, err)
+	data, err := json.Marshal(f)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"and": [
+		{"field": "Code", "op": "eq", "value": "A01"},
+		{"or": [{"field": "Price", "op": "between", "value": [10, 20.5]}, {"not": {"field": "Name", "op": "like", "value": "a%"}}]},
+		{"field": "ID", "op": "in", "value": [1, 2]},
+		{"field": "Note", "op": "isNotNull"}]}`, string(data))
+
+	// replaying the saved filter gives the same condition
+	var saved expr.Filter
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	back, args, err := saved.ToTree()
+	assert.NoError(t, err)
+	assert.Equal(t, "Code == ? and (Price between ? and ? or not Name like ?) and ID in ? and Note is not null", back.String())
+	assert.Equal(t, []interface{}{"A01", 10.0, 20.5, "a%", []interface{}{1.0, 2.0}}, args)
+
+	// &&, || and ! are the same filter nodes as and, or, not
+	symbolic, err := compiler.ParseExpr("Code == ? && (Price between 10 and ? || !(Name like 'a%')) && ID in (1, ?) and Note is not null")
+	assert.NoError(t, err)
+	f, err = expr.FilterFromTree(symbolic, "A01", 20.5, int64(2))
+	assert.NoError(t, err)
+	same, err := json.Marshal(f)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(data), string(same))
+
+	for _, src := range []string{"len(Name) > 1", "Code == @code", "1 == Code", "Price + 1 > 2"} {
+		tree, err := compiler.ParseExpr(src)
+		assert.NoError(t, err)
+		_, err = expr.FilterFromTree(tree, "x")
+		assert.Error(t, err, src)
+	}
+	_, err = expr.FilterFromTree(tree)
+	assert.Error(t, err)
+	_, err = expr.FilterFromTree(tree, "A01", 20.5, int64(2), "extra")
+	assert.Error(t, err)
+}
+
+func TestExpandFilter(t *testing.T) {
+	f := &expr.Filter{Field: "Code", Op: "eq", Value: "A01"}
+	conds, err := expr.ExpandFilter([]interface{}{f})
+	assert.NoError(t, err)
+	assert.Equal(t, "Code == ?", conds[0].(*compiler.SimpleExprTree).String())
+	assert.Equal(t, []interface{}{"A01"}, conds[1:])
+
+	_, err = expr.ExpandFilter([]interface{}{f, "A01"})
+	assert.Error(t, err)
+
+	conds, err = expr.ExpandFilter([]interface{}{"Code == ?", 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"Code == ?", 1}, conds)
+}
@@ -0,0 +1,209 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// rules of a PolicyError
+const (
+	PolicyLength  = "length"  // the expression text is too long
+	PolicyDepth   = "depth"   // the tree is nested too deep
+	PolicyNodes   = "nodes"   // the tree has too many nodes
+	PolicyField   = "field"   // a field is not allowed for the entity
+	PolicyFunc    = "func"    // a function is not allowed
+	PolicyString  = "string"  // a string literal is too long
+	PolicyLiteral = "literal" // a constant is used where a parameter is required
+)
+
+// Policy limits the expressions an IExpr accepts, for expressions coming from API clients.
+// Every limit is checked on the parsed tree before any sql is built, a zero value means no limit.
+// A policy must not be modified after it is given to IExpr.SetPolicy (set a new one instead).
+type Policy struct {
+	// Fields lists the fields each entity allows (Go field name or column name), keyed by
+	// the name of the entity type. The key "*" applies to entities which are not listed
+	// and to expressions compiled without schema. When Fields is nil every field is allowed,
+	// otherwise an entity without entry allows no field.
+	Fields map[string][]string
+	// Funcs lists the functions allowed (case-insensitive), nil allows every registered function
+	Funcs []string
+	// MaxLength is the maximum length of the expression text
+	MaxLength int
+	// MaxDepth is the maximum depth of the tree, "a == 1" has depth 2
+	MaxDepth int
+	// MaxNodes is the maximum number of nodes of the tree, "a == 1" has 3 nodes
+	MaxNodes int
+	// MaxStringLen is the maximum length of a string literal
+	MaxStringLen int
+	// ParamsOnly rejects constants (except null), values must be passed as parameters
+	ParamsOnly bool
+}
+
+// PolicyError is returned (wrapped) when an expression breaks a Policy, use errors.As to get it
+type PolicyError struct {
+	Rule   string // one of the Policy* constants
+	Detail string
+}
+
+func (e *PolicyError) Error() string {
+	return "expression not allowed by policy: " + e.Detail
+}
+
+func policyError(rule string, format string, args ...interface{}) *PolicyError {
+	return &PolicyError{Rule: rule, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Check checks the expression text src and its parsed trees (one for a condition,
+// one per item for a list such as ORDER BY) against the policy. A nil policy allows everything.
+func (p *Policy) Check(src string, schema *compiler.Schema, trees ...*compiler.SimpleExprTree) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.CheckLength(src); err != nil {
+		return err
+	}
+	nodes := 0
+	for _, tree := range trees {
+		if err := p.check(tree, schema, 1, &nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckLength checks the length of the expression text src, it is called before src is
+// parsed so an oversized expression is rejected without being read. A nil policy allows everything.
+func (p *Policy) CheckLength(src string) error {
+	if p != nil && p.MaxLength > 0 && len(src) > p.MaxLength {
+		return policyError(PolicyLength, "expression is longer than %d characters", p.MaxLength)
+	}
+	return nil
+}
+
+func (p *Policy) check(n *compiler.SimpleExprTree, schema *compiler.Schema, depth int, nodes *int) error {
+	*nodes++
+	if p.MaxNodes > 0 && *nodes > p.MaxNodes {
+		return policyError(PolicyNodes, "expression has more than %d nodes", p.MaxNodes)
+	}
+	if p.MaxDepth > 0 && depth > p.MaxDepth {
+		return policyError(PolicyDepth, "expression is nested deeper than %d levels", p.MaxDepth)
+	}
+	switch n.Nt {
+	case "field":
+		if !p.fieldAllowed(n.V, schema) {
+			return policyError(PolicyField, "field '%s' is not allowed in %s", n.V, entityName(schema))
+		}
+	case "func":
+		if !p.funcAllowed(n.V) {
+			return policyError(PolicyFunc, "function '%s' is not allowed", n.V)
+		}
+		if compiler.IsQuantifier(n.V) && schema != nil {
+			// the relation is a field of this entity, the condition is on the related entity
+			if rel, err := schema.QuantifierRelation(n); err == nil {
+				if err := p.check(n.Ns[0], schema, depth+1, nodes); err != nil {
+					return err
+				}
+				for _, c := range n.Ns[1:] {
+					if err := p.check(c, rel.Target, depth+1, nodes); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+		if strings.EqualFold(n.V, "cast") && len(n.Ns) == 2 {
+			// the type name of cast(x, 'numeric') is not a value
+			return p.check(n.Ns[0], schema, depth+1, nodes)
+		}
+	case "const":
+		if p.ParamsOnly && n.Lk != "null" {
+			return policyError(PolicyLiteral, "constant %s is not allowed, use a parameter", n.V)
+		}
+		if n.Lk == "string" && p.MaxStringLen > 0 {
+			if s, err := compiler.Unquote(n.V); err == nil && len(s) > p.MaxStringLen {
+				return policyError(PolicyString, "string literal is longer than %d characters", p.MaxStringLen)
+			}
+		}
+	case "json":
+		// the keys of a json path are part of the path, not constants given by the client
+		if err := p.check(n.Ns[0], schema, depth+1, nodes); err != nil {
+			return err
+		}
+		return p.checkRelationPath(n, schema)
+	}
+	for _, c := range n.Ns {
+		if err := p.check(c, schema, depth+1, nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRelationPath checks each field of a path such as User.Department.Name against the
+// entity it belongs to: allowing the relation User does not allow every field of users
+func (p *Policy) checkRelationPath(n *compiler.SimpleExprTree, schema *compiler.Schema) error {
+	if schema == nil || n.Ns[0].Nt != "field" {
+		return nil
+	}
+	rel, ok := schema.Relation(n.Ns[0].V)
+	for _, key := range n.Ns[1:] {
+		if !ok {
+			// the rest of the path is json inside a column
+			return nil
+		}
+		name, err := key.LiteralText()
+		if err != nil || key.Lk != "string" {
+			return nil
+		}
+		if !p.fieldAllowed(name, rel.Target) {
+			return policyError(PolicyField, "field '%s' is not allowed in %s", name, entityName(rel.Target))
+		}
+		rel, ok = rel.Target.Relation(name)
+	}
+	return nil
+}
+
+func (p *Policy) fieldAllowed(name string, schema *compiler.Schema) bool {
+	if p.Fields == nil {
+		return true
+	}
+	allowed, ok := p.Fields[entityName(schema)]
+	if !ok {
+		allowed = p.Fields["*"]
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, name) {
+			return true
+		}
+		// a field may be written by its Go name or by its column name
+		if schema != nil {
+			c1, ok1 := schema.Column(a)
+			c2, ok2 := schema.Column(name)
+			if ok1 && ok2 && c1 == c2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Policy) funcAllowed(name string) bool {
+	if p.Funcs == nil {
+		return true
+	}
+	for _, f := range p.Funcs {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func entityName(schema *compiler.Schema) string {
+	if schema == nil {
+		return "*"
+	}
+	return schema.Name
+}
@@ -0,0 +1,118 @@
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// FuncTranslator rewrites a function node into the sql of a dialect,
+// the same way a resolver does (change n.V, n.Ns, ...)
+type FuncTranslator func(n *compiler.SimpleExprTree) error
+
+// FuncInfo describes a function allowed in expressions
+type FuncInfo struct {
+	Name      string
+	MinArgs   int
+	MaxArgs   int // -1 means no limit
+	Translate FuncTranslator
+}
+
+// FuncRegistry holds the functions a dialect accepts, names are case-insensitive
+type FuncRegistry struct {
+	lock    sync.RWMutex
+	funcs   map[string]*FuncInfo
+	version int
+}
+
+func NewFuncRegistry() *FuncRegistry {
+	return &FuncRegistry{
+		funcs: make(map[string]*FuncInfo),
+	}
+}
+
+// Register adds or replaces a function. translate may be nil, then the function
+// is rendered as is with its name in lower case.
+func (r *FuncRegistry) Register(name string, minArgs int, maxArgs int, translate FuncTranslator) {
+	if translate == nil {
+		translate = SameFunc
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := strings.ToLower(name)
+	r.funcs[key] = &FuncInfo{
+		Name:      key,
+		MinArgs:   minArgs,
+		MaxArgs:   maxArgs,
+		Translate: translate,
+	}
+	r.version++
+}
+
+func (r *FuncRegistry) Lookup(name string) (*FuncInfo, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ret, ok := r.funcs[strings.ToLower(name)]
+	return ret, ok
+}
+
+// Names returns the registered function names in alphabetical order
+func (r *FuncRegistry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ret := make([]string, 0, len(r.funcs))
+	for name := range r.funcs {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Version changes every time a function is registered,
+// it is part of the cache key so cached sql never uses an old translator
+func (r *FuncRegistry) Version() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.version
+}
+
+// Translate checks the number of arguments of the function node n and translates it,
+// unknown functions are rejected
+func (r *FuncRegistry) Translate(n *compiler.SimpleExprTree) error {
+	info, ok := r.Lookup(n.V)
+	if !ok {
+		return fmt.Errorf("unknown function '%s'", n.V)
+	}
+	if len(n.Ns) < info.MinArgs || (info.MaxArgs >= 0 && len(n.Ns) > info.MaxArgs) {
+		return fmt.Errorf("invalid function call: function %s requires %s", n.V, arityText(info))
+	}
+	return info.Translate(n)
+}
+
+// SameFunc renders the function with its name in lower case
+func SameFunc(n *compiler.SimpleExprTree) error {
+	n.V = strings.ToLower(n.V)
+	return nil
+}
+
+// RenameFunc renders the function under another name, such as len -> length
+func RenameFunc(name string) FuncTranslator {
+	return func(n *compiler.SimpleExprTree) error {
+		n.V = name
+		return nil
+	}
+}
+
+func arityText(info *FuncInfo) string {
+	switch {
+	case info.MinArgs == info.MaxArgs:
+		return fmt.Sprintf("%d argument(s)", info.MinArgs)
+	case info.MaxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", info.MinArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", info.MinArgs, info.MaxArgs)
+	}
+}
@@ -0,0 +1,152 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nttlong/regorm/expr/compiler"
+)
+
+// OrderBySQL renders the items of compiler.ParseOrderBy (parsed from src) with the resolver
+// of b after checking them against the policy of b, every item gets an explicit ASC or DESC
+func OrderBySQL(b IExpr, src string, items []compiler.OrderItem, schema *compiler.Schema) (string, error) {
+	trees := make([]*compiler.SimpleExprTree, len(items))
+	for i, item := range items {
+		trees[i] = item.Expr
+	}
+	if err := b.GetPolicy().Check(src, schema, trees...); err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		c, err := compileNoJoins(b, item.Expr, schema, false)
+		if err != nil {
+			return "", err
+		}
+		if item.Desc {
+			parts = append(parts, c.SQL+" DESC")
+		} else {
+			parts = append(parts, c.SQL+" ASC")
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// SelectSQL renders the items of compiler.ParseSelectList (parsed from src) with the resolver
+// of b after checking them against the policy of b.
+// Aliases are turned into snake_case (so gorm maps them to struct fields) and quoted
+// with quoteIdent of the dialect.
+func SelectSQL(b IExpr, src string, items []compiler.SelectItem, schema *compiler.Schema, quoteIdent func(name string) string) (string, error) {
+	trees := make([]*compiler.SimpleExprTree, len(items))
+	for i, item := range items {
+		trees[i] = item.Expr
+	}
+	if err := b.GetPolicy().Check(src, schema, trees...); err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		c, err := compileNoJoins(b, item.Expr, schema, false)
+		if err != nil {
+			return "", err
+		}
+		if item.Alias != "" {
+			parts = append(parts, c.SQL+" AS "+quoteIdent(compiler.ToSnakeCase(item.Alias)))
+		} else {
+			parts = append(parts, c.SQL)
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// CompiledAggregate is the sql of the parts of an aggregate query
+type CompiledAggregate struct {
+	Select  string
+	GroupBy string        // "" when there is no GROUP BY
+	Having  *CompiledExpr // nil when there is no HAVING, it may have parameters
+}
+
+// AggregateSQL compiles the select list, GROUP BY list and HAVING condition of an
+// aggregate query with the resolver of b. Aliases of the select list such as
+// "year(CreatedOn) as Year" can be used in groupBy and having, they are replaced by
+// their expression. Every part is checked against the policy of b.
+func AggregateSQL(b IExpr, selects string, groupBy string, having string, schema *compiler.Schema, quoteIdent func(name string) string) (*CompiledAggregate, error) {
+	// the lengths are checked before anything is parsed
+	for _, part := range []struct{ name, src string }{{"select", selects}, {"group by", groupBy}, {"having", having}} {
+		if err := b.GetPolicy().CheckLength(part.src); err != nil {
+			return nil, fmt.Errorf("error compiling %s %q: %w", part.name, part.src, err)
+		}
+	}
+	items, err := compiler.ParseSelectList(selects)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling select %q: %w", selects, err)
+	}
+	var groups []*compiler.SimpleExprTree
+	if strings.TrimSpace(groupBy) != "" {
+		if groups, err = compiler.ParseExprList(groupBy); err != nil {
+			return nil, fmt.Errorf("error compiling group by %q: %w", groupBy, err)
+		}
+	}
+	var cond *compiler.SimpleExprTree
+	if strings.TrimSpace(having) != "" {
+		if cond, err = compiler.ParseExpr(having); err != nil {
+			return nil, fmt.Errorf("error compiling having %q: %w", having, err)
+		}
+	}
+	// the aliases are replaced before the select list is resolved (the resolver changes the nodes)
+	for i, g := range groups {
+		groups[i] = compiler.ReplaceAliases(g, items)
+	}
+	if cond != nil {
+		cond = compiler.ReplaceAliases(cond, items)
+	}
+	if err := b.GetPolicy().Check(groupBy, schema, groups...); err != nil {
+		return nil, fmt.Errorf("error compiling group by %q: %w", groupBy, err)
+	}
+	if cond != nil {
+		if err := b.GetPolicy().Check(having, schema, cond); err != nil {
+			return nil, fmt.Errorf("error compiling having %q: %w", having, err)
+		}
+	}
+
+	ret := &CompiledAggregate{}
+	if ret.Select, err = SelectSQL(b, selects, items, schema, quoteIdent); err != nil {
+		return nil, fmt.Errorf("error compiling select %q: %w", selects, err)
+	}
+	parts := make([]string, 0, len(groups))
+	for _, g := range groups {
+		c, err := compileNoJoins(b, g, schema, false)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling group by %q: %w", groupBy, err)
+		}
+		parts = append(parts, c.SQL)
+	}
+	ret.GroupBy = strings.Join(parts, ", ")
+	if cond != nil {
+		if ret.Having, err = compileNoJoins(b, cond, schema, true); err != nil {
+			return nil, fmt.Errorf("error compiling having %q: %w", having, err)
+		}
+	}
+	return ret, nil
+}
+
+// compileNoJoins compiles a part of a query which cannot add joins (sort, projection,
+// group by, having), fields of related entities are only supported in conditions.
+// cond is true for having, which is compiled as a condition
+func compileNoJoins(b IExpr, n *compiler.SimpleExprTree, schema *compiler.Schema, cond bool) (*CompiledExpr, error) {
+	src := n.String() // the resolver changes the nodes
+	var c *CompiledExpr
+	var err error
+	if cond {
+		c, err = b.GetCompiledCond(n, schema)
+	} else {
+		c, err = b.GetCompiledExpr(n, schema)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Joins) > 0 {
+		return nil, fmt.Errorf("fields of related entities such as %s are only supported in conditions", src)
+	}
+	return c, nil
+}
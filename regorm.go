@@ -9,6 +9,8 @@ import (
 	_ "github.com/nttlong/regorm/dbconfig/dbconfig_mysql"
 	"github.com/nttlong/regorm/dbconfig/dbconfig_postgres"
 	_ "github.com/nttlong/regorm/dbconfig/dbconfig_postgres"
+	"github.com/nttlong/regorm/dbconfig/dbconfig_sqlite"
+	"github.com/nttlong/regorm/dbconfig/dbconfig_sqlserver"
 )
 
 var (
@@ -35,6 +37,10 @@ func New(driverName string) dbconfig.IDbConfig {
 		ret = &dbconfig_postgres.PostgresDbConfig{}
 	} else if driverName == "mysql" {
 		ret = &dbconfig_mysql.MySqlDbConfig{}
+	} else if driverName == "sqlite" {
+		ret = &dbconfig_sqlite.SqliteDbConfig{}
+	} else if driverName == "sqlserver" {
+		ret = &dbconfig_sqlserver.SqlServerDbConfig{}
 	} else {
 		panic("not support driver")
 	}